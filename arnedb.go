@@ -9,31 +9,83 @@
 package arnedb
 
 import (
+	"crypto/cipher"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Coll represents a single collection of documents. There is no limit for collections
 type Coll struct {
-	dbpath string // Kolleksiyon klasörünün yolu.
-	// Name is the collection name.
+	db         *ArneDB // Kolleksiyonun bağlı olduğu veritabanı
+	hooks      hookRegistry
+	schema     *Schema      // Kolleksiyon şeması, yoksa nil. schemaMu ile korunur
+	meta       collMeta     // Kolleksiyon ayarları
+	stats      *collStats   // Kolleksiyon istatistikleri, yüklenmemişse nil. mu ile korunur
+	statsDirty int          // Yazılmamış istatistik değişikliği sayısı. mu ile korunur
+	metaMu     sync.RWMutex // meta korunur
+	schemaMu   sync.RWMutex // schema korunur
+	mu         sync.Mutex   // Yazma işlemleri sıraya sokulur
+	nameMu     sync.RWMutex // Name korunur
+	// Name is the collection name. It changes when the collection is renamed, so GetName should be
+	// used while the collection may be renamed.
 	Name string
 }
 
+// GetName returns the name of the collection. It is safe to call while the collection is renamed.
+func (coll *Coll) GetName() string {
+	coll.nameMu.RLock()
+	defer coll.nameMu.RUnlock()
+	return coll.Name
+}
+
 // ArneDB represents a single database. There is no limit for databases. (Unless you have enough disk space)
 type ArneDB struct {
 	// Name is the database name
 	Name    string
 	baseDir string           // Veritabanı ana klasörü,
 	path    string           // Veritabanı tam yolu
+	storage Storage          // Dosyaların saklandığı yer
 	colls   map[string]*Coll // içindeki Coll'lar (Kolleksiyonlar)
+	collsMu sync.RWMutex     // colls korunur
+
+	watchMu   sync.Mutex       // watchers, changeSeq ve changeLog korunur
+	watchers  map[int]*watcher // Değişiklikleri dinleyenler
+	watcherID int              // Son verilen watcher numarası
+	changeSeq ChangeToken      // Son değişikliğin sıra numarası
+	changeLog bool             // Değişiklikler diske yazılır mı?
+
+	hooks    hookRegistry        // Bütün kolleksiyonlar için hook'lar
+	readOnly bool                // Değişikliklere izin verilmez
+	parallel ParallelScanOptions // Chunk'ların paralel taranma ayarları
+	cache    *chunkCache         // Okunan chunk'lar, kapalıysa nil
+	oplog    *oplogStorage       // Değişiklik kaydı, kapalıysa nil
+
+	migrations    []Migration // Kayıtlı migration'lar, sürüme göre sıralı
+	migrateOnOpen bool        // Açılışta bekleyen migration'lar uygulanır
+	migrateMu     sync.Mutex
+
+	aead    cipher.AEAD  // Kayıtları şifreler, şifresizse nil
+	cryptMu sync.RWMutex // aead korunur
+
+	sweepInterval time.Duration // Süresi dolan kayıtların silinme periyodu
+	sweeperDone   chan struct{} // Sweeper bittiğinde kapanır, başlamadıysa nil
+	sweeperMu     sync.Mutex    // sweeperDone korunur
+	closing       chan struct{} // Close çağrıldığında kapanır
+	closeOnce     sync.Once
 }
 
-// Open function opens an existing or creates a new database.
-func Open(baseDir, dbName string) (*ArneDB, error) {
+// Option configures a database while opening it.
+type Option func(db *ArneDB) error
+
+// Open function opens an existing or creates a new database. Options are applied in the given order
+// after the collections are loaded.
+func Open(baseDir, dbName string, opts ...Option) (*ArneDB, error) {
 
 	// baseDir var mı? Yoksa oluştur.
 	// TODO: Error tipi oluşturulabilir. Şimdilik sadece metin errorları kullanılır
@@ -66,34 +118,84 @@ func Open(baseDir, dbName string) (*ArneDB, error) {
 	}
 
 	//Kontroller tamam db hazır
+	return openStorage(dbName, baseDir, dbPath, NewDirStorage(dbPath), opts)
+}
+
+// OpenStorage function opens a database kept in the given storage. Open uses a directory storage, this
+// function allows other storages like NewMemStorage or NewFSStorage.
+func OpenStorage(dbName string, storage Storage, opts ...Option) (*ArneDB, error) {
+	return openStorage(dbName, "", "", storage, opts)
+}
+
+func openStorage(dbName, baseDir, dbPath string, storage Storage, opts []Option) (*ArneDB, error) {
 	var db = ArneDB{
-		baseDir,
-		dbName,
-		dbPath,
-		make(map[string]*Coll),
+		Name:     dbName,
+		baseDir:  baseDir,
+		path:     dbPath,
+		storage:  storage,
+		colls:    make(map[string]*Coll),
+		watchers: make(map[int]*watcher),
+
+		sweepInterval: defaultSweepInterval,
+		closing:       make(chan struct{}),
 	}
 
 	// TODO: Veritabanı compact işlemleri yapılması
 
 	// Şimdi (coll) kolleksiyonlar yüklenir.
-	files, err := ioutil.ReadDir(dbPath)
+	collNames, err := storage.ListColls()
 	if err != nil {
 		return nil, errors.New("cannot read db collections")
 	}
 
-	for _, finfo := range files {
-		if finfo.IsDir() {
-			// Bu bizim ilgilendiğimiz kolleksiyondur
-			var c = Coll{
-				Name:   finfo.Name(),
-				dbpath: filepath.Join(dbPath, finfo.Name()),
-			}
-			db.colls[c.Name] = &c
+	// klasörlerin her biri bizim kolleksiyonumuzdur. Yarım kalmış kopyalar yüklenmez.
+	for _, collName := range collNames {
+		if strings.HasPrefix(collName, tmpCollPrefix) {
+			continue
+		}
+		var c = Coll{
+			Name: collName,
+			db:   &db,
+		}
+		if err = c.loadSchema(); err != nil {
+			return nil, err
+		}
+		if err = c.loadMeta(); err != nil {
+			return nil, err
+		}
+		db.colls[c.Name] = &c
+	}
+
+	for _, opt := range opts {
+		if err = opt(&db); err != nil {
+			return nil, err
+		}
+	}
+
+	// Yarıda kalmış anahtar değişimi tamamlanır ve şifreleme anahtarı kontrol edilir. Salt okunur
+	// veritabanında anahtar kontrol dosyası yazılmaz.
+	if err = db.recoverRotation(); err != nil {
+		return nil, err
+	}
+	if err = db.checkKey(); err != nil {
+		return nil, err
+	}
+	if err = db.loadChangeSeq(); err != nil {
+		return nil, err
+	}
+	if db.migrateOnOpen {
+		if _, err = db.Migrate(); err != nil {
+			return nil, err
 		}
-		// dosyalar ile ilgilenmeyiz!
 	}
 
-	// klasörlerin her biri bizim kolleksiyonumuzdur.
+	// Süresi dolan kayıtlar arka planda silinir. Sweeper ilk TTL'li kolleksiyon ile başlar.
+	for _, c := range db.colls {
+		if c.GetTTL() != nil {
+			db.startSweeper()
+			break
+		}
+	}
 
 	return &db, nil // hatasız dönüş
 }
@@ -101,43 +203,112 @@ func Open(baseDir, dbName string) (*ArneDB, error) {
 // TODO: Export işlemi : Zip dosyası olarak export edilir.
 // TODO: Import işlemi : Zip dosyası import edilir.
 
-// Herhangi bir şeyi bellekte tutmadığımız için Close gibi bir işleme ihtiyacımız yok.
+// Close function stops the background work of the database, writes the collection statistics and
+// closes the watcher channels. Data is always committed to disk, so a database which is not closed
+// loses nothing. Calling Close more than once is safe.
+func (db *ArneDB) Close() error {
+	db.closeOnce.Do(func() {
+		close(db.closing)
+		db.sweeperMu.Lock()
+		sweeperDone := db.sweeperDone
+		db.sweeperMu.Unlock()
+		if sweeperDone != nil {
+			<-sweeperDone // devam eden silme işlemi beklenir
+		}
+
+		// Yazılmamış istatistikler kaydedilir
+		colls, unlock := db.lockColls()
+		for _, c := range colls {
+			c.flushStats()
+		}
+		unlock()
+
+		db.watchMu.Lock()
+		for id, w := range db.watchers {
+			delete(db.watchers, id)
+			if !w.replaying {
+				close(w.ch)
+			}
+		}
+		db.watchMu.Unlock()
+	})
+	return nil
+}
 
 // Collection İşlemleri ---------------------------------------------------------------
 
-// CreateColl function creates a collection and returns it.
-func (db *ArneDB) CreateColl(collName string) (*Coll, error) {
-	// Oluşturulmak istenen collection var mı ona bakarız.
-	collPath := filepath.Join(db.path, collName)
-	_, err := os.Stat(collPath)
+// CheckCollName function checks whether the name can be used for a new collection. Names cannot be
+// empty, start with a dot or contain path separators.
+func CheckCollName(name string) error {
+	if name == "" || strings.HasPrefix(name, tmpCollPrefix) || strings.ContainsAny(name, `/\`) {
+		return errors.New(fmt.Sprintf("invalid collection name: %q", name))
+	}
+	return nil
+}
 
-	if os.IsExist(err) {
-		return nil, errors.New(fmt.Sprintf("a dir name exists with the same name: %s -> %s", collName, err.Error()))
+// CreateColl function creates a collection and returns it. Options like WithCap are stored with the
+// collection.
+func (db *ArneDB) CreateColl(collName string, opts ...CollOption) (*Coll, error) {
+	if err := db.checkWritable("CreateColl"); err != nil {
+		return nil, err
+	}
+	if err := CheckCollName(collName); err != nil {
+		return nil, err
 	}
 
-	// Klasör yok demektir.
-	err = os.Mkdir(collPath, 0700)
+	// Oluşturulmak istenen collection var mı ona bakarız. Varsa storage hata döner.
+	err := db.storage.CreateColl(collName)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, errors.New(fmt.Sprintf("a dir name exists with the same name: %s -> %s", collName, err.Error()))
+	}
 	if err != nil {
 		return nil, err
 	} // klasörü oluşturamadı
 
 	var c = Coll{
-		Name:   collName,
-		dbpath: collPath,
+		Name:  collName,
+		db:    db,
+		stats: &collStats{Created: time.Now(), Chunks: make(map[string]*chunkStats)},
+	}
+	c.stats.Modified = c.stats.Created
+	for _, opt := range opts {
+		if err = opt(&c); err != nil {
+			_ = db.storage.RemoveColl(collName)
+			return nil, err
+		}
 	}
+	if len(opts) > 0 {
+		if err = c.saveMeta(); err != nil {
+			_ = db.storage.RemoveColl(collName)
+			return nil, err
+		}
+	}
+
+	c.saveStats()
+
+	db.collsMu.Lock()
 	db.colls[c.Name] = &c
+	db.collsMu.Unlock()
 
 	return &c, nil
 }
 
 // DeleteColl function deletes a given collection.
 func (db *ArneDB) DeleteColl(collName string) error {
+	if err := db.checkWritable("DeleteColl"); err != nil {
+		return err
+	}
+
+	db.collsMu.Lock()
+	defer db.collsMu.Unlock()
+
 	collObj, keyFound := db.colls[collName]
 	if !keyFound {
 		return errors.New("collection does not exist")
 	}
 
-	err := os.RemoveAll(collObj.dbpath)
+	err := db.storage.RemoveColl(collObj.GetName())
+	db.cache.invalidateColl(collObj.GetName())
 	if err == nil { // file system removal success
 		delete(db.colls, collName)
 	}
@@ -149,6 +320,8 @@ func (db *ArneDB) DeleteColl(collName string) error {
 // GetColl gets the collection by the given name. It returns the pointer if it finds a collection
 // with the given name. If not it returns nil
 func (db *ArneDB) GetColl(collName string) *Coll {
+	db.collsMu.RLock()
+	defer db.collsMu.RUnlock()
 
 	if len(db.colls) == 0 {
 		return nil // Return nil if there is no collection
@@ -164,6 +337,9 @@ func (db *ArneDB) GetColl(collName string) *Coll {
 
 // GelCollNames returns all present collection names as []string
 func (db *ArneDB) GelCollNames() (result []string) {
+	db.collsMu.RLock()
+	defer db.collsMu.RUnlock()
+
 	if len(db.colls) == 0 {
 		return nil // Return nil if there is no collection
 	}
@@ -3,6 +3,7 @@ package arnedb
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -422,3 +423,184 @@ func BenchmarkMemAndGenerics(b *testing.B) {
 	}
 
 }
+
+// filterBenchColl fills an in-memory collection for the query benchmarks
+func filterBenchColl(b *testing.B) *Coll {
+	pDb, err := OpenInMemory("benchdb")
+	if err != nil {
+		b.Fatal("OpenInMemory failed with:", err)
+	}
+	coll, err := pDb.CreateColl("people")
+	if err != nil {
+		b.Fatal("CreateColl failed with:", err)
+	}
+
+	cities := []string{"Ankara", "İstanbul", "İzmir", "Bursa"}
+	records := make([]RecordInstance, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		records = append(records, RecordInstance{
+			"id":      i,
+			"name":    fmt.Sprintf("Person %d", i),
+			"age":     i % 90,
+			"address": map[string]interface{}{"city": cities[i%len(cities)], "zip": fmt.Sprintf("%05d", i)},
+			"tags":    []string{"one", "two", "three"},
+		})
+	}
+	if _, err = coll.AddAll(records...); err != nil {
+		b.Fatal("AddAll failed with:", err)
+	}
+	return coll
+}
+
+func BenchmarkQueryPredicate(b *testing.B) {
+	coll := filterBenchColl(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := coll.GetAll(func(instance RecordInstance) bool {
+			address, _ := instance["address"].(map[string]interface{})
+			return address["city"] == "Bursa" && instance["age"].(float64) > 80
+		})
+		if err != nil || len(result) == 0 {
+			b.Fatal("GetAll failed with:", err)
+		}
+	}
+}
+
+func BenchmarkQueryFilter(b *testing.B) {
+	coll := filterBenchColl(b)
+	filter, err := ParseFilter([]byte(`{"address.city": "Bursa", "age": {"$gt": 80}}`))
+	if err != nil {
+		b.Fatal("ParseFilter failed with:", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := coll.Find(filter)
+		if err != nil || len(result) == 0 {
+			b.Fatal("Find failed with:", err)
+		}
+	}
+}
+
+func TestRecordFieldsDoNotLeak(t *testing.T) {
+	_ = os.RemoveAll("testdb/leakdb")
+
+	pDb, err := Open("testdb", "leakdb")
+	if err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	items, err := pDb.CreateColl("items")
+	if err != nil {
+		t.Fatal("Create items failed with:", err)
+	}
+	if _, err = items.AddAll(RecordInstance{"id": 1, "x": 1}, RecordInstance{"id": 2}, RecordInstance{"id": 3, "x": 3}); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	// Kayıtlar aynı map'e okunursa id 2 önceki kaydın x alanı ile görünür
+	second, err := items.GetFirst(func(i RecordInstance) bool { return i["id"] == 2.0 })
+	if err != nil || second == nil || second["x"] != nil {
+		t.Errorf("GetFirst returned fields of another record: %v %v", second, err)
+	}
+	if n, err := items.DeleteFirst(func(i RecordInstance) bool { return i["x"] == nil }); err != nil || n != 1 {
+		t.Errorf("DeleteFirst expected to delete the record without x, got %d %v", n, err)
+	}
+	if n, err := items.ReplaceFirst(func(i RecordInstance) bool { return i["id"] == 3.0 && i["x"] == 3.0 }, RecordInstance{"id": 3}); err != nil || n != 1 {
+		t.Errorf("ReplaceFirst expected to replace the record with id 3, got %d %v", n, err)
+	}
+	if n, _ := items.Count(func(i RecordInstance) bool { return i["x"] != nil }); n != 1 {
+		t.Errorf("expected a single record with x, got %d", n)
+	}
+
+	_ = os.RemoveAll("testdb/leakdb")
+}
+
+func TestUpdateReplaceAll(t *testing.T) {
+	_ = os.RemoveAll("testdb/updatealldb")
+
+	pDb, err := Open("testdb", "updatealldb")
+	if err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	items, err := pDb.CreateColl("items")
+	if err != nil {
+		t.Fatal("Create items failed with:", err)
+	}
+	// Kayıtlar iki chunk'a yayılır
+	_ = os.WriteFile("testdb/updatealldb/items/00.json", []byte("{\"id\":1,\"tag\":\"a\",\"extra\":\"x\"}\n{\"id\":2,\"tag\":\"b\"}\n{\"id\":3,\"tag\":\"a\"}\n"), 0600)
+	_ = os.WriteFile("testdb/updatealldb/items/01.json", []byte("{\"id\":4,\"tag\":\"a\"}\n{\"id\":5,\"tag\":\"b\"}\n"), 0600)
+
+	tagged := func(tag string) QueryPredicate {
+		return func(i RecordInstance) bool { return i["tag"] == tag }
+	}
+	mark := func(field string) UpdateFunc {
+		return func(ptrRecord *RecordInstance) *RecordInstance {
+			(*ptrRecord)[field] = true
+			return ptrRecord
+		}
+	}
+
+	if n, err := items.UpdateAll(tagged("a"), mark("u")); err != nil || n != 3 {
+		t.Errorf("UpdateAll expected to update 3 records, got %d %v", n, err)
+	}
+	if n, _ := items.Count(func(i RecordInstance) bool { return i["u"] == true }); n != 3 {
+		t.Errorf("UpdateAll expected to update the records in every chunk, got %d", n)
+	}
+	if n, err := items.UpdateFirst(tagged("b"), mark("f")); err != nil || n != 1 {
+		t.Errorf("UpdateFirst expected to update 1 record, got %d %v", n, err)
+	}
+	if n, _ := items.Count(func(i RecordInstance) bool { return i["f"] == true }); n != 1 {
+		t.Errorf("UpdateFirst expected to update a single record, got %d", n)
+	}
+	if n, _ := items.Count(func(i RecordInstance) bool { return i["extra"] != nil }); n != 1 {
+		t.Errorf("fields of a record leaked into the other records, %d records have extra", n)
+	}
+
+	if n, err := items.ReplaceAll(tagged("a"), RecordInstance{"tag": "r"}); err != nil || n != 3 {
+		t.Errorf("ReplaceAll expected to replace 3 records, got %d %v", n, err)
+	}
+	if n, _ := items.Count(tagged("r")); n != 3 {
+		t.Errorf("ReplaceAll expected to replace the records in every chunk, got %d", n)
+	}
+	if n, err := items.ReplaceFirst(tagged("b"), RecordInstance{"tag": "s"}); err != nil || n != 1 {
+		t.Errorf("ReplaceFirst expected to replace 1 record, got %d %v", n, err)
+	}
+	if n, _ := items.Count(tagged("b")); n != 1 {
+		t.Errorf("ReplaceFirst expected to replace a single record, %d left", n)
+	}
+
+	_ = os.RemoveAll("testdb/updatealldb")
+}
+
+func TestLargeRecords(t *testing.T) {
+	pDb, err := OpenInMemory("largedb")
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	items, _ := pDb.CreateColl("items")
+
+	// bufio.Scanner varsayılan olarak 64KB'tan uzun satırları okuyamaz
+	big := strings.Repeat("x", 100*1024)
+	if _, err = items.AddAll(RecordInstance{"id": 1, "blob": big}, RecordInstance{"id": 2}); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	all := func(RecordInstance) bool { return true }
+	if records, err := items.GetAll(all); err != nil || len(records) != 2 {
+		t.Errorf("GetAll expected 2 records, got %d %v", len(records), err)
+	}
+	filter, _ := NewFilter(map[string]interface{}{"id": 1})
+	if records, err := items.Find(filter); err != nil || len(records) != 1 || records[0]["blob"] != big {
+		t.Errorf("Find expected the large record, got %d %v", len(records), err)
+	}
+	if values, err := items.Distinct("id", nil); err != nil || len(values) != 2 {
+		t.Errorf("Distinct expected 2 values, got %v %v", values, err)
+	}
+	if n, err := items.UpdateAll(all, func(r *RecordInstance) *RecordInstance { (*r)["seen"] = true; return r }); err != nil || n != 2 {
+		t.Errorf("UpdateAll expected 2 updates, got %d %v", n, err)
+	}
+	if report, err := items.Verify(); err != nil || len(report.Issues) != 0 || report.Docs != 2 {
+		t.Errorf("Verify expected a healthy collection, got %+v %v", report, err)
+	}
+}
@@ -0,0 +1,208 @@
+package arnedb
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// CacheStats holds the counters of the chunk cache. It is returned by ArneDB.CacheStats.
+type CacheStats struct {
+	// Hits is the number of chunk reads served from the cache
+	Hits uint64
+	// Misses is the number of chunk reads which went to the storage
+	Misses uint64
+	// Entries is the number of the cached chunks
+	Entries int
+	// Bytes is the total size of the cached chunks
+	Bytes int64
+	// MaxBytes is the byte budget of the cache
+	MaxBytes int64
+}
+
+// WithCache option keeps the recently read chunks in memory up to maxBytes. Chunks are cached after
+// they are decompressed and decrypted, so a hit saves reading the storage, gzip and decryption. The
+// records are still decoded on every query, because callers may change the returned documents. Least
+// recently used chunks are dropped when the budget is exceeded. Every change to a chunk removes it
+// from the cache. The cache is disabled by default to keep the memory usage low.
+func WithCache(maxBytes int64) Option {
+	return func(db *ArneDB) error {
+		if maxBytes <= 0 {
+			return errors.New(fmt.Sprintf("invalid cache size: %d", maxBytes))
+		}
+		db.cache = newChunkCache(maxBytes)
+		return nil
+	}
+}
+
+// CacheStats function returns the counters of the chunk cache. All the counters are zero if the
+// cache is not enabled.
+func (db *ArneDB) CacheStats() CacheStats {
+	return db.cache.stats()
+}
+
+// cacheKey identifies a chunk of a collection
+type cacheKey struct {
+	coll  string
+	chunk string
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	data []byte
+}
+
+// chunkCache is a LRU cache of the decoded chunk contents. A nil cache caches nothing.
+type chunkCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	lru      *list.List // En son kullanılan en öndedir
+	items    map[cacheKey]*list.Element
+	gens     map[string]uint64 // Kolleksiyon başına değişiklik sayacı
+	epoch    uint64            // Bütün kolleksiyonlar için değişiklik sayacı
+	hits     uint64
+	misses   uint64
+}
+
+func newChunkCache(maxBytes int64) *chunkCache {
+	return &chunkCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[cacheKey]*list.Element),
+		gens:     make(map[string]uint64),
+	}
+}
+
+// get returns the cached content of the chunk. On a miss it returns the generation of the
+// collection which must be passed to put.
+func (c *chunkCache) get(coll, chunk string) ([]byte, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.items[cacheKey{coll: coll, chunk: chunk}]; found {
+		c.hits++
+		c.lru.MoveToFront(e)
+		return e.Value.(*cacheEntry).data, 0, true
+	}
+	c.misses++
+	return nil, c.gens[coll] + c.epoch, false
+}
+
+// put caches the content of the chunk. It is skipped if the collection has changed since gen was
+// returned by get, because the content may be stale then.
+func (c *chunkCache) put(coll, chunk string, data []byte, gen uint64) {
+	if c == nil || int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gens[coll]+c.epoch != gen {
+		return
+	}
+	key := cacheKey{coll: coll, chunk: chunk}
+	if e, found := c.items[key]; found {
+		c.remove(e)
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, data: data})
+	c.bytes += int64(len(data))
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate drops the chunk from the cache. It must be called after every change to a chunk.
+func (c *chunkCache) invalidate(coll, chunk string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gens[coll]++
+	if e, found := c.items[cacheKey{coll: coll, chunk: chunk}]; found {
+		c.remove(e)
+	}
+}
+
+// invalidateColl drops all the chunks of the collection
+func (c *chunkCache) invalidateColl(coll string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gens[coll]++
+	for key, e := range c.items {
+		if key.coll == coll {
+			c.remove(e)
+		}
+	}
+}
+
+// reset drops all the chunks
+func (c *chunkCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	c.items = make(map[cacheKey]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// remove removes the entry. The caller must hold the lock.
+func (c *chunkCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.bytes -= int64(len(entry.data))
+}
+
+func (c *chunkCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Entries:  len(c.items),
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+	}
+}
+
+// openCachedChunk opens the chunk through the cache. The decoded content of a missed chunk is read
+// at once and cached.
+func (coll *Coll) openCachedChunk(name string) (io.ReadCloser, error) {
+	data, gen, found := coll.db.cache.get(coll.GetName(), name)
+	if found {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	r, err := coll.openChunkStorage(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err = io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		return nil, err
+	}
+	coll.db.cache.put(coll.GetName(), name, data, gen)
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
@@ -0,0 +1,192 @@
+package arnedb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	if _, err := OpenInMemory("cachedb", WithCache(0)); err == nil {
+		t.Error("zero cache size expected to fail")
+	}
+
+	pDb, err := OpenInMemory("cachedb", WithCache(1024*1024))
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	coll, err := pDb.CreateColl("items")
+	if err != nil {
+		t.Fatal("CreateColl failed with:", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err = coll.Add(RecordInstance{"id": i}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+
+	all := func(RecordInstance) bool { return true }
+	countAll := func() int {
+		n, err := coll.Count(all)
+		if err != nil {
+			t.Fatal("Count failed with:", err)
+		}
+		return n
+	}
+
+	if n := countAll(); n != 10 {
+		t.Errorf("Count expected 10, got %d", n)
+	}
+	before := pDb.CacheStats()
+	if n := countAll(); n != 10 {
+		t.Errorf("Count expected 10, got %d", n)
+	}
+	stats := pDb.CacheStats()
+	t.Logf("CacheStats: %+v", stats)
+	if stats.Hits != before.Hits+1 || stats.Misses != before.Misses || stats.Entries != 1 || stats.Bytes == 0 {
+		t.Errorf("second read expected a cache hit: before %+v, after %+v", before, stats)
+	}
+
+	// Her değişiklik cache'i geçersiz kılar
+	if err = coll.Add(RecordInstance{"id": 10}); err != nil {
+		t.Fatal("Add failed with:", err)
+	}
+	if n := countAll(); n != 11 {
+		t.Errorf("Count after Add expected 11, got %d", n)
+	}
+	if _, err = coll.UpdateAll(func(i RecordInstance) bool { return i["id"].(float64) < 5 },
+		func(i *RecordInstance) *RecordInstance { (*i)["small"] = true; return i }); err != nil {
+		t.Fatal("UpdateAll failed with:", err)
+	}
+	if n, _ := coll.Count(func(i RecordInstance) bool { return i["small"] == true }); n != 5 {
+		t.Errorf("Count after UpdateAll expected 5, got %d", n)
+	}
+	if _, err = coll.DeleteAll(func(i RecordInstance) bool { return i["id"].(float64) < 5 }); err != nil {
+		t.Fatal("DeleteAll failed with:", err)
+	}
+	if n := countAll(); n != 6 {
+		t.Errorf("Count after DeleteAll expected 6, got %d", n)
+	}
+	if _, err = coll.ReplaceFirst(func(i RecordInstance) bool { return i["id"] == 10.0 }, RecordInstance{"id": 99}); err != nil {
+		t.Fatal("ReplaceFirst failed with:", err)
+	}
+	if r, _ := coll.GetFirst(func(i RecordInstance) bool { return i["id"] == 99.0 }); r == nil {
+		t.Error("GetFirst after ReplaceFirst expected the new record")
+	}
+
+	if err = pDb.DeleteColl("items"); err != nil {
+		t.Fatal("DeleteColl failed with:", err)
+	}
+	if coll, err = pDb.CreateColl("items"); err != nil {
+		t.Fatal("CreateColl failed with:", err)
+	}
+	if err = coll.Add(RecordInstance{"id": 1}); err != nil {
+		t.Fatal("Add failed with:", err)
+	}
+	if n := countAll(); n != 1 {
+		t.Errorf("Count after re-creating expected 1, got %d", n)
+	}
+}
+
+func TestCacheBudget(t *testing.T) {
+	pDb, err := OpenInMemory("cachedb", WithCache(200))
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	if _, err = pDb.CreateColl("items"); err != nil {
+		t.Fatal("CreateColl failed with:", err)
+	}
+
+	// Her biri yaklaşık 80 byte olan chunk'lar yazılır
+	for c := 1; c <= 4; c++ {
+		content := fmt.Sprintf("{\"chunk\":%d,\"pad\":\"%060d\"}\n", c, 0)
+		if err = pDb.storage.Replace("items", fmt.Sprintf("%02x.json", c), []byte(content)); err != nil {
+			t.Fatal("Replace failed with:", err)
+		}
+	}
+	if err = pDb.storage.Replace("items", "05.json", make([]byte, 300)); err != nil {
+		t.Fatal("Replace failed with:", err)
+	}
+
+	coll := pDb.GetColl("items")
+	for i := 0; i < 2; i++ {
+		if _, err = coll.Count(func(RecordInstance) bool { return true }); err != nil {
+			t.Fatal("Count failed with:", err)
+		}
+	}
+
+	stats := pDb.CacheStats()
+	t.Logf("CacheStats: %+v", stats)
+	if stats.Bytes > stats.MaxBytes || stats.Entries != 2 {
+		t.Errorf("cache budget exceeded: %+v", stats)
+	}
+	// Sıralı okumada LRU en eski chunk'ları atar, ikinci okumada isabet olmaz
+	if stats.Hits != 0 || stats.Misses != 10 {
+		t.Errorf("unexpected cache counters: %+v", stats)
+	}
+
+	if stats = (&ArneDB{}).CacheStats(); stats != (CacheStats{}) {
+		t.Errorf("disabled cache expected zero stats, got %+v", stats)
+	}
+}
+
+// BenchmarkCacheHit compares queries with and without the chunk cache. A hit saves reading the
+// chunk from the storage, decrypting and decompressing it; the records are decoded in both cases.
+func BenchmarkCacheHit(b *testing.B) {
+	_ = os.RemoveAll("testdb/cachebenchdb")
+	defer os.RemoveAll("testdb/cachebenchdb")
+	key := bytes.Repeat([]byte{7}, 32)
+
+	pDb, err := Open("testdb", "cachebenchdb", WithEncryptionKey(key))
+	if err != nil {
+		b.Fatal("Open failed with:", err)
+	}
+	plain, _ := pDb.CreateColl("plain")
+	sealed, _ := pDb.CreateColl("sealed", WithCompression(6))
+	records := make([]RecordInstance, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		records = append(records, RecordInstance{"id": i, "name": fmt.Sprintf("Person %d", i), "pad": fmt.Sprintf("%0200d", i)})
+	}
+	// Birkaç chunk dolar, sıkıştırılan koleksiyonda kapanan chunk'lar sıkıştırılıp şifrelenir
+	for i := 0; i < 12; i++ {
+		if _, err = plain.AddAll(records...); err != nil {
+			b.Fatal("AddAll failed with:", err)
+		}
+		if _, err = sealed.AddAll(records...); err != nil {
+			b.Fatal("AddAll failed with:", err)
+		}
+	}
+	_ = pDb.Close()
+
+	for _, name := range []string{"plain", "sealed"} {
+		for _, cached := range []bool{false, true} {
+			opts := []Option{WithEncryptionKey(key)}
+			label := name + "/nocache"
+			if cached {
+				opts = append(opts, WithCache(64*1024*1024))
+				label = name + "/cache"
+			}
+			b.Run(label, func(b *testing.B) {
+				db, err := Open("testdb", "cachebenchdb", opts...)
+				if err != nil {
+					b.Fatal("Open failed with:", err)
+				}
+				defer db.Close()
+				coll := db.GetColl(name)
+				all := func(RecordInstance) bool { return true }
+				if _, err = coll.Count(all); err != nil { // cache doldurulur
+					b.Fatal("Count failed with:", err)
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if n, err := coll.Count(all); err != nil || n != 12000 {
+						b.Fatal("Count failed with:", n, err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package arnedb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// cappedChunkParts is the number of chunks a capped collection is split into. Oldest records are
+// evicted by removing whole chunks, so a collection keeps at least (parts-1)/parts of its cap.
+const cappedChunkParts = 4
+
+// CollOption configures a collection while creating it.
+type CollOption func(coll *Coll) error
+
+// CapOptions describes the limits of a capped collection.
+type CapOptions struct {
+	// MaxDocs is the maximum count of the records. Zero means no limit.
+	MaxDocs int `json:"maxDocs,omitempty"`
+	// MaxBytes is the maximum size of the chunk files in bytes. Zero means no limit.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+}
+
+// WithCap option creates a capped collection which never grows beyond maxDocs records or maxBytes
+// bytes. Zero disables the related limit. When a limit is exceeded by Add or AddAll, the oldest
+// records are evicted by removing the oldest chunks. Evictions do not invoke hooks or watchers.
+func WithCap(maxDocs int, maxBytes int64) CollOption {
+	return func(coll *Coll) error {
+		if maxDocs < 0 || maxBytes < 0 {
+			return errors.New("cap limits cannot be negative")
+		}
+		if maxDocs == 0 && maxBytes == 0 {
+			return errors.New("a capped collection requires a limit")
+		}
+		coll.meta.Cap = &CapOptions{MaxDocs: maxDocs, MaxBytes: maxBytes}
+		return nil
+	}
+}
+
+// GetCap returns the limits of the collection or nil if the collection is not capped.
+func (coll *Coll) GetCap() *CapOptions {
+	coll.metaMu.RLock()
+	defer coll.metaMu.RUnlock()
+	return coll.meta.Cap
+}
+
+// Tail function returns the newest n records of the collection in insertion order. Chunks are read
+// starting from the newest one.
+func (coll *Coll) Tail(n int) ([]RecordInstance, error) {
+	result := make([]RecordInstance, 0)
+	if n <= 0 {
+		return result, nil
+	}
+
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var lines [][]byte // en yeni kayıt en sonda
+	for i := len(chunks) - 1; i >= 0 && len(lines) < n; i-- {
+		content, err := coll.readChunk(chunks[i].Name())
+		if err != nil {
+			return nil, err
+		}
+
+		var chunkLines [][]byte
+		for _, line := range bytes.Split(content, []byte(recordSepStr)) {
+			if len(line) == 0 || coll.expiredLine(line, now) {
+				continue
+			}
+			chunkLines = append(chunkLines, line)
+		}
+		if missing := n - len(lines); len(chunkLines) > missing {
+			chunkLines = chunkLines[len(chunkLines)-missing:]
+		}
+		lines = append(chunkLines, lines...)
+	}
+
+	codec := coll.codec()
+	for _, line := range lines {
+		var data RecordInstance
+		if codec.Unmarshal(line, &data) != nil {
+			continue // skip this record
+		}
+		data, err = coll.afterRead(data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data)
+	}
+
+	return result, nil
+}
+
+// chunkByteLimit returns the size after which a new chunk is started. Capped collections use smaller
+// chunks.
+func (coll *Coll) chunkByteLimit() int64 {
+	limit := int64(maxChunkSize)
+	if capOpts := coll.GetCap(); capOpts != nil && capOpts.MaxBytes > 0 {
+		if l := capOpts.MaxBytes / cappedChunkParts; l < limit {
+			limit = l
+		}
+	}
+	return limit
+}
+
+// chunkDocLimit returns the count of the records after which a new chunk is started. Zero means
+// there is no limit.
+func (coll *Coll) chunkDocLimit() int {
+	capOpts := coll.GetCap()
+	if capOpts == nil || capOpts.MaxDocs <= 0 {
+		return 0
+	}
+	limit := capOpts.MaxDocs / cappedChunkParts
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// chunkDocs returns the count of the records in a chunk from the statistics. The caller must hold
+// the lock of the collection.
+func (coll *Coll) chunkDocs(name string) (int, error) {
+	if err := coll.loadStats(); err != nil {
+		return 0, err
+	}
+	if cs, found := coll.stats.Chunks[name]; found {
+		return cs.Live, nil
+	}
+	return 0, nil
+}
+
+// chunkFull checks whether a new chunk must be created instead of appending to the given one.
+func (coll *Coll) chunkFull(chunk fs.FileInfo) bool {
+	if isCompressedChunk(chunk.Name()) {
+		return true // sıkıştırılmış chunk'a ekleme yapılmaz
+	}
+
+	if chunk.Size() > coll.chunkByteLimit() {
+		return true
+	}
+
+	if limit := coll.chunkDocLimit(); limit > 0 {
+		n, err := coll.chunkDocs(chunk.Name())
+		return err == nil && n >= limit
+	}
+
+	return false
+}
+
+// chunkRoom returns how many of the records are appended to the chunk before a new chunk is
+// started. A chunk which is not full takes at least one record.
+func (coll *Coll) chunkRoom(chunk fs.FileInfo, payloads [][]byte) (int, error) {
+	n := len(payloads)
+	if limit := coll.chunkDocLimit(); limit > 0 {
+		docs, err := coll.chunkDocs(chunk.Name())
+		if err != nil {
+			return 0, err
+		}
+		if room := limit - docs; room < n {
+			n = room
+		}
+	}
+
+	room, size := coll.chunkByteLimit()-chunk.Size(), int64(0)
+	for i := 0; i < n; i++ {
+		size += int64(len(payloads[i]) + 1)
+		if i > 0 && size > room {
+			n = i
+			break
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n, nil
+}
+
+// enforceCap removes the oldest chunks until the collection fits into its limits. The newest chunk
+// is never removed. It fits into the limits since appended records are split at the chunk limits.
+func (coll *Coll) enforceCap() error {
+	capOpts := coll.GetCap()
+	if capOpts == nil {
+		return nil
+	}
+
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return err
+	}
+
+	// Kayıt sayıları istatistiklerden okunur, chunk'lar taranmaz
+	var totalBytes int64
+	totalDocs := 0
+	docs := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		totalBytes += chunk.Size()
+		if capOpts.MaxDocs > 0 {
+			if docs[i], err = coll.chunkDocs(chunk.Name()); err != nil {
+				return err
+			}
+			totalDocs += docs[i]
+		}
+	}
+
+	exceeded := func() bool {
+		return (capOpts.MaxBytes > 0 && totalBytes > capOpts.MaxBytes) ||
+			(capOpts.MaxDocs > 0 && totalDocs > capOpts.MaxDocs)
+	}
+
+	for i := 0; i < len(chunks)-1 && exceeded(); i++ {
+		err = coll.db.storage.Remove(coll.GetName(), chunks[i].Name())
+		coll.db.cache.invalidate(coll.GetName(), chunks[i].Name())
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot evict chunk: %s", err.Error()))
+		}
+		coll.chunkRemoved(chunks[i].Name())
+		totalBytes -= chunks[i].Size()
+		totalDocs -= docs[i]
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package arnedb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCappedColl(t *testing.T) {
+	_ = os.RemoveAll("testdb/cappeddb")
+
+	pDb, err := Open("testdb", "cappeddb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+
+	if _, err = pDb.CreateColl("bad", WithCap(0, 0)); err == nil {
+		t.Error("WithCap accepted no limits")
+	}
+	if pDb.GetColl("bad") != nil {
+		t.Error("Collection is created with invalid options")
+	}
+
+	logs, err := pDb.CreateColl("logs", WithCap(100, 0))
+	if err != nil {
+		t.Fatal("Create logs failed with:", err)
+	}
+	for i := 0; i < 250; i++ {
+		if err = logs.Add(RecordInstance{"seq": i}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+
+	n, err := logs.Count(func(RecordInstance) bool { return true })
+	if err != nil {
+		t.Fatal("Count failed with:", err)
+	}
+	if n < 75 || n > 100 {
+		t.Errorf("Capped collection has %d records", n)
+	}
+	first, err := logs.GetFirst(func(RecordInstance) bool { return true })
+	if err != nil || first == nil || first["seq"].(float64) != float64(250-n) {
+		t.Errorf("Oldest records are not evicted, first is %v", first)
+	}
+
+	tail, err := logs.Tail(30)
+	if err != nil {
+		t.Fatal("Tail failed with:", err)
+	}
+	if len(tail) != 30 || tail[0]["seq"].(float64) != 220 || tail[29]["seq"].(float64) != 249 {
+		t.Errorf("Tail returned wrong records: %v ... %v", tail[0], tail[len(tail)-1])
+	}
+
+	// Ayarlar yeniden açılışta yüklenir
+	pDb, err = Open("testdb", "cappeddb")
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	logs = pDb.GetColl("logs")
+	if c := logs.GetCap(); c == nil || c.MaxDocs != 100 {
+		t.Fatalf("Cap is not loaded on Open: %+v", c)
+	}
+
+	sized, err := pDb.CreateColl("sized", WithCap(0, 2000))
+	if err != nil {
+		t.Fatal("Create sized failed with:", err)
+	}
+	payload := RecordInstance{"text": "0123456789012345678901234567890123456789"}
+	_, err = sized.AddAll(payload, payload, payload, payload, payload, payload, payload, payload)
+	if err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err = sized.Add(payload); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	chunks, _ := sized.getChunks()
+	var total int64
+	for _, c := range chunks {
+		total += c.Size()
+	}
+	if total > 2000 {
+		t.Errorf("Capped collection has %d bytes", total)
+	}
+}
+
+func TestCappedCollBatch(t *testing.T) {
+	_ = os.RemoveAll("testdb/cappedbatchdb")
+
+	pDb, err := Open("testdb", "cappedbatchdb")
+	if err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+
+	// Sınırdan büyük tek bir AddAll de sınıra uyar
+	logs, _ := pDb.CreateColl("logs", WithCap(10, 0))
+	batch := make([]RecordInstance, 0, 50)
+	for i := 0; i < 50; i++ {
+		batch = append(batch, RecordInstance{"seq": i})
+	}
+	if n, err := logs.AddAll(batch...); err != nil || n != 50 {
+		t.Fatalf("AddAll expected to add 50 records, got %d %v", n, err)
+	}
+	if n, _ := logs.Count(func(RecordInstance) bool { return true }); n < 8 || n > 10 {
+		t.Errorf("capped collection has %d records after a large batch", n)
+	}
+	if tail, _ := logs.Tail(1); len(tail) != 1 || tail[0]["seq"] != 49.0 {
+		t.Errorf("newest record expected to be kept: %v", tail)
+	}
+
+	sized, _ := pDb.CreateColl("sized", WithCap(0, 4000))
+	batch = batch[:0]
+	for i := 0; i < 100; i++ {
+		batch = append(batch, RecordInstance{"seq": i, "text": "0123456789012345678901234567890123456789"})
+	}
+	if _, err = sized.AddAll(batch...); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+	chunks, _ := sized.getChunks()
+	var total int64
+	for _, chunk := range chunks {
+		total += chunk.Size()
+	}
+	if total > 4000 || len(chunks) < 2 {
+		t.Errorf("capped collection has %d bytes in %d chunks after a large batch", total, len(chunks))
+	}
+
+	_ = os.RemoveAll("testdb/cappedbatchdb")
+}
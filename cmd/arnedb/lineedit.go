@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the lines of the shell
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// completer returns the start of the word being completed and the candidates for it
+type completer func(line []rune, pos int) (start int, candidates []string)
+
+// plainReader reads lines from a non terminal input like a pipe. Prompts are not written.
+type plainReader struct {
+	scn *bufio.Scanner
+}
+
+func newPlainReader(r io.Reader) *plainReader {
+	scn := bufio.NewScanner(r)
+	scn.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &plainReader{scn: scn}
+}
+
+func (p *plainReader) readLine(string) (string, error) {
+	if p.scn.Scan() {
+		return p.scn.Text(), nil
+	}
+	if err := p.scn.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+// Tuş kodları
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// lineEditor reads lines from a terminal in raw mode. It moves the cursor, walks the history with
+// the arrow keys and completes words with the tab key. Characters are assumed to be one column wide.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  []string
+	complete completer
+
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func newLineEditor(in io.Reader, out io.Writer, complete completer) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out, complete: complete}
+}
+
+// addHistory adds a line to the history unless it repeats the last one
+func (e *lineEditor) addHistory(line string) {
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > historySize {
+		e.history = e.history[len(e.history)-historySize:]
+	}
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	e.prompt, e.buf, e.pos = prompt, e.buf[:0], 0
+	historyIdx := len(e.history)
+	pending := "" // geçmişte gezinirken yazılmakta olan satır
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.buf) > 0 {
+				return string(e.buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			e.write("\r\n")
+			return string(e.buf), nil
+		case keyCtrlC:
+			e.write("^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case keyBackspace, keyDelete:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlB:
+			e.moveCursor(-1)
+		case keyCtrlF:
+			e.moveCursor(1)
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = append(e.buf[:0], e.buf[e.pos:]...)
+			e.pos = 0
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			e.write("\x1b[H\x1b[2J")
+		case keyCtrlP, keyCtrlN:
+			historyIdx, pending = e.walkHistory(historyIdx, pending, r == keyCtrlP)
+		case keyTab:
+			e.completeWord()
+		case keyEscape:
+			historyIdx, pending = e.escape(historyIdx, pending)
+		default:
+			if r >= ' ' {
+				e.buf = append(e.buf, 0)
+				copy(e.buf[e.pos+1:], e.buf[e.pos:])
+				e.buf[e.pos] = r
+				e.pos++
+			}
+		}
+		e.refresh()
+	}
+}
+
+// escape handles the escape sequences of the arrow and the editing keys
+func (e *lineEditor) escape(historyIdx int, pending string) (int, string) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return historyIdx, pending
+	}
+
+	param := ""
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return historyIdx, pending
+		}
+		if r < '0' || r > '9' {
+			break
+		}
+		param += string(r)
+	}
+
+	switch r {
+	case 'A':
+		return e.walkHistory(historyIdx, pending, true)
+	case 'B':
+		return e.walkHistory(historyIdx, pending, false)
+	case 'C':
+		e.moveCursor(1)
+	case 'D':
+		e.moveCursor(-1)
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+	case '~':
+		switch param {
+		case "1", "7":
+			e.pos = 0
+		case "4", "8":
+			e.pos = len(e.buf)
+		case "3":
+			e.deleteAt(e.pos)
+		}
+	}
+	return historyIdx, pending
+}
+
+// walkHistory replaces the line with the previous or the next history entry
+func (e *lineEditor) walkHistory(historyIdx int, pending string, back bool) (int, string) {
+	if back {
+		if historyIdx == 0 {
+			return historyIdx, pending
+		}
+		if historyIdx == len(e.history) {
+			pending = string(e.buf)
+		}
+		historyIdx--
+		e.setLine(e.history[historyIdx])
+		return historyIdx, pending
+	}
+
+	if historyIdx >= len(e.history) {
+		return historyIdx, pending
+	}
+	historyIdx++
+	if historyIdx == len(e.history) {
+		e.setLine(pending)
+	} else {
+		e.setLine(e.history[historyIdx])
+	}
+	return historyIdx, pending
+}
+
+// completeWord completes the word before the cursor. If the candidates share no longer prefix, they
+// are listed under the line.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	start, candidates := e.complete(e.buf, e.pos)
+	if len(candidates) == 0 {
+		return
+	}
+
+	word := string(e.buf[start:e.pos])
+	replacement := candidates[0]
+	if len(candidates) == 1 {
+		replacement += " "
+	} else {
+		for _, candidate := range candidates[1:] {
+			replacement = commonPrefix(replacement, candidate)
+		}
+		if replacement == word {
+			sorted := append([]string{}, candidates...)
+			sort.Strings(sorted)
+			e.write("\r\n" + strings.Join(sorted, "  ") + "\r\n")
+			return
+		}
+	}
+
+	rest := append([]rune(replacement), e.buf[e.pos:]...)
+	e.buf = append(e.buf[:start], rest...)
+	e.pos = start + len([]rune(replacement))
+}
+
+func (e *lineEditor) setLine(line string) {
+	e.buf = append(e.buf[:0], []rune(line)...)
+	e.pos = len(e.buf)
+}
+
+func (e *lineEditor) deleteAt(pos int) {
+	if pos < len(e.buf) {
+		e.buf = append(e.buf[:pos], e.buf[pos+1:]...)
+	}
+}
+
+func (e *lineEditor) moveCursor(delta int) {
+	pos := e.pos + delta
+	if pos >= 0 && pos <= len(e.buf) {
+		e.pos = pos
+	}
+}
+
+// refresh redraws the line and puts the cursor in place
+func (e *lineEditor) refresh() {
+	line := "\r\x1b[K" + e.prompt + string(e.buf)
+	if back := len(e.buf) - e.pos; back > 0 {
+		line += fmt.Sprintf("\x1b[%dD", back)
+	}
+	e.write(line)
+}
+
+func (e *lineEditor) write(s string) {
+	_, _ = io.WriteString(e.out, s)
+}
+
+func commonPrefix(a, b string) string {
+	ra, rb := []rune(a), []rune(b)
+	n := 0
+	for n < len(ra) && n < len(rb) && ra[n] == rb[n] {
+		n++
+	}
+	return string(ra[:n])
+}
@@ -0,0 +1,736 @@
+// Command arnedb inspects and edits arnedb databases from the command line.
+//
+// Usage:
+//
+//	arnedb [flags] <command> [arguments]
+//
+// Filters are declarative filter documents like '{"age": {"$gte": 18}}'. Insert reads the documents
+// from the standard input as a JSON array or as JSON documents one after another. Import reads NDJSON,
+// a JSON array or CSV as selected by -format. Run arnedb without arguments to see the commands and
+// flags.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mgulsoy/arnedb"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cli holds the flags and the streams of a single run
+type cli struct {
+	dir    string
+	dbName string
+	output string
+	pretty bool
+	key    string
+	limit  int
+	format string
+	fields string
+
+	skipErrors bool
+	maxErrors  int
+	batch      int
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a sub command of the tool
+type command struct {
+	args    string // Argüman açıklaması
+	help    string
+	minArgs int
+	maxArgs int
+	run     func(c *cli, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"dbs":     {"", "list the databases in the base directory", 0, 0, (*cli).listDBs},
+		"colls":   {"", "list the collections of the database", 0, 0, (*cli).listColls},
+		"info":    {"[coll]", "show the information of the database or a collection", 0, 1, (*cli).info},
+		"count":   {"<coll> [filter]", "count the documents matching the filter", 1, 2, (*cli).count},
+		"find":    {"<coll> [filter]", "print the documents matching the filter", 1, 2, (*cli).find},
+		"insert":  {"<coll>", "insert the documents read from stdin", 1, 1, (*cli).insert},
+		"delete":  {"<coll> <filter>", "delete the documents matching the filter", 2, 2, (*cli).delete},
+		"update":  {"<coll> <filter> <update>", `update the matching documents, update is like {"$set": {...}, "$unset": [...], "$rename": {...}}`, 3, 3, (*cli).update},
+		"compact": {"[coll]", "remove the blank lines of the deleted documents", 0, 1, (*cli).compact},
+		"verify":  {"[coll]", "check that every document can be read and matches the schema", 0, 1, (*cli).verify},
+		"export":  {"<coll> [filter]", "stream the matching documents to stdout in the -format format", 1, 2, (*cli).export},
+		"import":  {"<coll>", "import the -format documents read from stdin, the collection is created if needed", 1, 1, (*cli).importDocs},
+		"shell":   {"[baseDir db]", "start an interactive shell, -dir and -db are used if not given", 0, 2, (*cli).shell},
+	}
+}
+
+// run runs the tool and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	flags := flag.NewFlagSet("arnedb", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&c.dir, "dir", ".", "base directory of the databases")
+	flags.StringVar(&c.dbName, "db", "", "database name")
+	flags.StringVar(&c.output, "o", "json", "output format: json, ndjson or table")
+	flags.BoolVar(&c.pretty, "pretty", false, "indent the json output")
+	flags.StringVar(&c.key, "key", os.Getenv("ARNEDB_KEY"), "hex encoded encryption key, defaults to $ARNEDB_KEY")
+	flags.IntVar(&c.limit, "limit", 0, "maximum number of the documents printed by find, 0 means all")
+	flags.StringVar(&c.format, "format", "ndjson", "export and import format: ndjson, json or csv")
+	flags.StringVar(&c.fields, "fields", "", "comma separated fields written by export, CSV columns; for import the CSV columns of an input without a header line")
+	flags.BoolVar(&c.skipErrors, "skip-errors", false, "import: report the failing lines and go on instead of stopping")
+	flags.IntVar(&c.maxErrors, "max-errors", 0, "import: stop after so many failing lines with -skip-errors, 0 means no limit")
+	flags.IntVar(&c.batch, "batch", 0, "import: number of the documents written at once, 0 means the default of 1000")
+	flags.Usage = func() { usage(flags) }
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		usage(flags)
+		return 2
+	}
+
+	name, cmdArgs := flags.Arg(0), flags.Args()[1:]
+	cmd, found := commands[name]
+	if !found {
+		fmt.Fprintf(stderr, "arnedb: unknown command %q\n", name)
+		return 2
+	}
+	if len(cmdArgs) < cmd.minArgs || len(cmdArgs) > cmd.maxArgs {
+		fmt.Fprintf(stderr, "usage: arnedb [flags] %s %s\n", name, cmd.args)
+		return 2
+	}
+	if c.output != "json" && c.output != "ndjson" && c.output != "table" {
+		fmt.Fprintf(stderr, "arnedb: unknown output format %q\n", c.output)
+		return 2
+	}
+
+	if err := cmd.run(c, cmdArgs); err != nil {
+		fmt.Fprintln(stderr, "arnedb:", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintln(out, "usage: arnedb [flags] <command> [arguments]")
+	fmt.Fprintln(out, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", name, commands[name].args, commands[name].help)
+	}
+	_ = tw.Flush()
+
+	fmt.Fprintln(out, "\nflags:")
+	flags.PrintDefaults()
+}
+
+// Commands ----------------------------------------------------------------------------------------
+
+func (c *cli) listDBs([]string) error {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]interface{}, 0)
+	for _, finfo := range files {
+		if finfo.IsDir() && !strings.HasPrefix(finfo.Name(), ".") {
+			rows = append(rows, finfo.Name())
+		}
+	}
+	return c.printRows(rows)
+}
+
+func (c *cli) listColls([]string) error {
+	db, err := c.open(false, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return c.printCollNames(db)
+}
+
+// printCollNames prints the collection names sorted
+func (c *cli) printCollNames(db *arnedb.ArneDB) error {
+	names := db.GelCollNames()
+	sort.Strings(names)
+	rows := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, name)
+	}
+	return c.printRows(rows)
+}
+
+func (c *cli) info(args []string) error {
+	db, err := c.open(false, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(args) == 0 {
+		info, err := db.Info()
+		if err != nil {
+			return err
+		}
+		if c.output == "table" {
+			rows := make([]interface{}, 0, len(info.Colls))
+			for _, ci := range info.Colls {
+				rows = append(rows, map[string]interface{}{"name": ci.Name, "docs": ci.Docs,
+					"deadLines": ci.DeadLines, "chunks": len(ci.Chunks), "bytes": ci.Bytes, "modified": ci.Modified})
+			}
+			return c.printRows(rows)
+		}
+		return c.printValue(info)
+	}
+
+	coll, err := getColl(db, args[0])
+	if err != nil {
+		return err
+	}
+	info, err := coll.Info()
+	if err != nil {
+		return err
+	}
+	if c.output == "table" {
+		rows := make([]interface{}, 0, len(info.Chunks))
+		for _, chunk := range info.Chunks {
+			rows = append(rows, chunk)
+		}
+		return c.printRows(rows)
+	}
+	return c.printValue(info)
+}
+
+func (c *cli) count(args []string) error {
+	db, coll, filter, err := c.collAndFilter(args, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := coll.CountFilter(filter)
+	if err != nil {
+		return err
+	}
+	return c.printValue(n)
+}
+
+func (c *cli) find(args []string) error {
+	db, coll, filter, err := c.collAndFilter(args, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	docs, err := coll.Find(filter)
+	if err != nil {
+		return err
+	}
+	if c.limit > 0 && len(docs) > c.limit {
+		docs = docs[:c.limit]
+	}
+	return c.printRows(docRows(docs))
+}
+
+func (c *cli) insert(args []string) error {
+	db, err := c.open(true, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	coll, err := getColl(db, args[0])
+	if err != nil {
+		return err
+	}
+	return c.addDocs(coll)
+}
+
+func (c *cli) importDocs(args []string) error {
+	if c.format != "ndjson" && c.format != "json" && c.format != "csv" {
+		return errors.New(fmt.Sprintf("unknown import format %q", c.format))
+	}
+	if c.batch < 0 || c.maxErrors < 0 {
+		return errors.New("-batch and -max-errors cannot be negative")
+	}
+
+	db, err := c.open(true, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	coll := db.GetColl(args[0])
+	if coll == nil {
+		if coll, err = db.CreateColl(args[0]); err != nil {
+			return err
+		}
+	}
+
+	opts := arnedb.ImportOptions{BatchSize: c.batch, MaxErrors: c.maxErrors}
+	if c.skipErrors {
+		opts.OnError = arnedb.ImportSkip
+	}
+	in := bufio.NewReader(c.stdin)
+	var result *arnedb.ImportResult
+	switch {
+	case c.format == "csv":
+		opts.Header = c.fieldList()
+		result, err = coll.ImportCSV(in, opts)
+	case c.format == "json" || firstByte(in) == '[':
+		// Dizi elemanları satır satır içe aktarılır, eski çıktılar da okunur
+		lines := jsonArrayLines(in)
+		result, err = coll.ImportNDJSON(lines, opts)
+		_ = lines.Close()
+	default:
+		result, err = coll.ImportNDJSON(in, opts)
+	}
+
+	// Yarıda kalan aktarımda da eklenenler gösterilir
+	if result != nil {
+		if printErr := c.printValue(result); err == nil {
+			err = printErr
+		}
+	}
+	return err
+}
+
+func (c *cli) delete(args []string) error {
+	db, coll, filter, err := c.collAndFilter(args, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := coll.DeleteAll(filter.Predicate())
+	if err != nil {
+		return err
+	}
+	return c.printValue(n)
+}
+
+func (c *cli) update(args []string) error {
+	db, coll, filter, err := c.collAndFilter(args[:2], true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	patch, err := arnedb.ParseUpdate([]byte(args[2]))
+	if err != nil {
+		return err
+	}
+	patch.Filter = filter
+
+	n, err := coll.ApplyPatch(patch)
+	if err != nil {
+		return err
+	}
+	return c.printValue(n)
+}
+
+func (c *cli) compact(args []string) error {
+	db, err := c.open(true, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	colls, err := selectColls(db, args)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]interface{}, 0, len(colls))
+	for _, coll := range colls {
+		n, err := coll.Compact()
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot compact %s: %s", coll.GetName(), err.Error()))
+		}
+		rows = append(rows, map[string]interface{}{"coll": coll.GetName(), "removedLines": n})
+	}
+	return c.printRows(rows)
+}
+
+func (c *cli) verify(args []string) error {
+	db, err := c.open(false, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	colls, err := selectColls(db, args)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]interface{}, 0, len(colls))
+	issues := 0
+	for _, coll := range colls {
+		report, err := coll.Verify()
+		if err != nil {
+			return err
+		}
+		issues += len(report.Issues)
+		rows = append(rows, report)
+	}
+	if err = c.printRows(rows); err != nil {
+		return err
+	}
+	if issues > 0 {
+		return errors.New(fmt.Sprintf("%d issues found", issues))
+	}
+	return nil
+}
+
+func (c *cli) export(args []string) error {
+	db, coll, filter, err := c.collAndFilter(args, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = coll.Export(c.stdout, arnedb.ExportFormat(c.format), filter, c.fieldList())
+	return err
+}
+
+// Helpers -----------------------------------------------------------------------------------------
+
+// open opens the database. Databases are opened read-only unless write is set. A missing database is
+// created only if create is set. The caller closes the database.
+func (c *cli) open(write, create bool) (*arnedb.ArneDB, error) {
+	if c.dbName == "" {
+		return nil, errors.New("database name is required, use -db")
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, c.dbName)); err != nil && !create {
+		return nil, errors.New(fmt.Sprintf("database does not exist: %s", c.dbName))
+	}
+
+	opts := []arnedb.Option{arnedb.WithSweepInterval(0)}
+	if !write {
+		opts = append(opts, arnedb.WithReadOnly())
+	}
+	if c.key != "" {
+		key, err := hex.DecodeString(c.key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid key: %s", err.Error()))
+		}
+		opts = append(opts, arnedb.WithEncryptionKey(key))
+	}
+	return arnedb.Open(c.dir, c.dbName, opts...)
+}
+
+// collAndFilter opens the database and returns it with the collection and the filter in the arguments.
+// A missing filter matches all the documents. The caller closes the database.
+func (c *cli) collAndFilter(args []string, write bool) (*arnedb.ArneDB, *arnedb.Coll, *arnedb.Filter, error) {
+	db, err := c.open(write, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	coll, err := getColl(db, args[0])
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, nil, err
+	}
+
+	filterText := "{}"
+	if len(args) > 1 {
+		filterText = args[1]
+	}
+	filter, err := arnedb.ParseFilter([]byte(filterText))
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, nil, err
+	}
+	return db, coll, filter, nil
+}
+
+func getColl(db *arnedb.ArneDB, name string) (*arnedb.Coll, error) {
+	coll := db.GetColl(name)
+	if coll == nil {
+		return nil, errors.New(fmt.Sprintf("collection does not exist: %s", name))
+	}
+	return coll, nil
+}
+
+// selectColls returns the named collection or all the collections sorted by name
+func selectColls(db *arnedb.ArneDB, args []string) ([]*arnedb.Coll, error) {
+	if len(args) > 0 {
+		coll, err := getColl(db, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []*arnedb.Coll{coll}, nil
+	}
+
+	names := db.GelCollNames()
+	sort.Strings(names)
+	colls := make([]*arnedb.Coll, 0, len(names))
+	for _, name := range names {
+		colls = append(colls, db.GetColl(name))
+	}
+	return colls, nil
+}
+
+// addDocs adds the documents read from stdin and prints their count
+func (c *cli) addDocs(coll *arnedb.Coll) error {
+	docs, err := readDocs(c.stdin)
+	if err != nil {
+		return err
+	}
+	n, err := coll.AddAll(docs...)
+	if err != nil {
+		return err
+	}
+	return c.printValue(n)
+}
+
+// fieldList returns the fields given with -fields or nil
+func (c *cli) fieldList() []string {
+	var fields []string
+	if c.fields != "" {
+		for _, field := range strings.Split(c.fields, ",") {
+			fields = append(fields, strings.TrimSpace(field))
+		}
+	}
+	return fields
+}
+
+// firstByte returns the first byte of the input which is not a space without consuming it. It
+// returns 0 if there is none.
+func firstByte(br *bufio.Reader) byte {
+	for i := 1; ; i++ {
+		peeked, err := br.Peek(i)
+		if err != nil {
+			return 0
+		}
+		switch b := peeked[i-1]; b {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return b
+		}
+	}
+}
+
+// jsonArrayLines streams the items of a JSON array as NDJSON lines. The reader must be closed, so the
+// decoding stops if the import ends early.
+func jsonArrayLines(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		dec := json.NewDecoder(r)
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			_ = pw.CloseWithError(errors.New("invalid input: expected a JSON array"))
+			return
+		}
+		var line bytes.Buffer
+		for dec.More() {
+			var item json.RawMessage
+			if err := dec.Decode(&item); err != nil {
+				_ = pw.CloseWithError(errors.New(fmt.Sprintf("invalid input: %s", err.Error())))
+				return
+			}
+			line.Reset()
+			_ = json.Compact(&line, item)
+			line.WriteByte('\n')
+			if _, err := pw.Write(line.Bytes()); err != nil {
+				return // içe aktarma bitti
+			}
+		}
+		_ = pw.Close()
+	}()
+	return pr
+}
+
+// readDocs reads a JSON array of documents or documents one after another
+func readDocs(r io.Reader) ([]arnedb.RecordInstance, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil, errors.New("no documents in the input")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		_ = br.UnreadByte()
+
+		dec := json.NewDecoder(br)
+		if b == '[' {
+			var docs []arnedb.RecordInstance
+			if err = dec.Decode(&docs); err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid input: %s", err.Error()))
+			}
+			return docs, nil
+		}
+
+		docs := make([]arnedb.RecordInstance, 0)
+		for {
+			var doc arnedb.RecordInstance
+			err = dec.Decode(&doc)
+			if err == io.EOF {
+				return docs, nil
+			}
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid input after %d documents: %s", len(docs), err.Error()))
+			}
+			docs = append(docs, doc)
+		}
+	}
+}
+
+func docRows(docs []arnedb.RecordInstance) []interface{} {
+	rows := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		rows = append(rows, map[string]interface{}(doc))
+	}
+	return rows
+}
+
+// Output ------------------------------------------------------------------------------------------
+
+// printValue prints a single value
+func (c *cli) printValue(value interface{}) error {
+	if c.output == "table" {
+		if _, isMap := toMap(value); isMap {
+			return c.printRows([]interface{}{value})
+		}
+	}
+	return c.printJSON(value, c.pretty && c.output == "json")
+}
+
+// printRows prints a list of values in the output format
+func (c *cli) printRows(rows []interface{}) error {
+	switch c.output {
+	case "ndjson":
+		for _, row := range rows {
+			if err := c.printJSON(row, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "table":
+		return c.printTable(rows)
+	}
+	return c.printJSON(rows, c.pretty)
+}
+
+func (c *cli) printJSON(value interface{}, pretty bool) error {
+	var content []byte
+	var err error
+	if pretty {
+		content, err = json.MarshalIndent(value, "", "  ")
+	} else {
+		content, err = json.Marshal(value)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.stdout, string(content))
+	return err
+}
+
+// printTable prints the rows as a table. Columns are the fields of the rows.
+func (c *cli) printTable(rows []interface{}) error {
+	maps := make([]map[string]interface{}, 0, len(rows))
+	columnSet := make(map[string]bool)
+	for _, row := range rows {
+		m, isMap := toMap(row)
+		if !isMap {
+			m = map[string]interface{}{"value": row}
+		}
+		for key := range m {
+			columnSet[key] = true
+		}
+		maps = append(maps, m)
+	}
+
+	columns := make([]string, 0, len(columnSet))
+	for key := range columnSet {
+		columns = append(columns, key)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		// Kimlik alanları önce yazılır
+		ri, rj := columnRank(columns[i]), columnRank(columns[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return columns[i] < columns[j]
+	})
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, m := range maps {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = cellText(m[column])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func columnRank(column string) int {
+	switch column {
+	case "id", "_id", "Id", "ID":
+		return 0
+	case "name", "Name", "coll":
+		return 1
+	}
+	return 2
+}
+
+// toMap converts a value into a map through JSON if it is an object
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, true
+	}
+	content, err := json.Marshal(value)
+	if err != nil || !bytes.HasPrefix(content, []byte("{")) {
+		return nil, false
+	}
+	var m map[string]interface{}
+	if json.Unmarshal(content, &m) != nil {
+		return nil, false
+	}
+	return m, true
+}
+
+func cellText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.NewReplacer("\t", " ", "\n", " ").Replace(v)
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCli runs the tool and returns the exit code and the outputs
+func runCli(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCli(t *testing.T) {
+	dir := t.TempDir()
+	base := []string{"-dir", dir, "-db", "clidb"}
+	with := func(args ...string) []string { return append(append([]string{}, base...), args...) }
+
+	if code, _, _ := runCli(t, "", with("colls")...); code != 1 {
+		t.Error("colls on a missing database expected to fail, code:", code)
+	}
+
+	input := `{"id": 1, "name": "Ada", "age": 36}
+{"id": 2, "name": "Linus", "age": 21}
+{"id": 3, "name": "Grace", "age": 85}`
+	code, out, errOut := runCli(t, input, with("-o", "ndjson", "import", "people")...)
+	if code != 0 || strings.TrimSpace(out) != `{"imported":3,"skipped":0,"errors":[]}` {
+		t.Fatal("import failed:", code, out, errOut)
+	}
+	if code, out, _ = runCli(t, `[{"id": 4, "name": "Ken", "age": 79}]`, with("insert", "people")...); code != 0 || strings.TrimSpace(out) != "1" {
+		t.Error("insert failed:", code, out)
+	}
+	if code, _, _ = runCli(t, "{}", with("insert", "missing")...); code != 1 {
+		t.Error("insert into a missing collection expected to fail, code:", code)
+	}
+
+	if code, out, _ = runCli(t, "", "-dir", dir, "dbs"); code != 0 || strings.TrimSpace(out) != `["clidb"]` {
+		t.Error("dbs unexpected output:", code, out)
+	}
+	if code, out, _ = runCli(t, "", with("-o", "ndjson", "colls")...); code != 0 || out != "\"people\"\n" {
+		t.Error("colls unexpected output:", code, out)
+	}
+
+	if code, out, _ = runCli(t, "", with("count", "people", `{"age": {"$gt": 30}}`)...); code != 0 || strings.TrimSpace(out) != "3" {
+		t.Error("count unexpected output:", code, out)
+	}
+
+	code, out, _ = runCli(t, "", with("-limit", "1", "find", "people", `{"age": {"$gt": 30}}`)...)
+	var docs []map[string]interface{}
+	if code != 0 || json.Unmarshal([]byte(out), &docs) != nil || len(docs) != 1 {
+		t.Error("find unexpected output:", code, out)
+	}
+
+	code, out, _ = runCli(t, "", with("-o", "table", "find", "people", `{"id": 2}`)...)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if code != 0 || len(lines) != 2 || !strings.HasPrefix(lines[0], "id") || !strings.Contains(lines[1], "Linus") {
+		t.Error("find table unexpected output:", code, out)
+	}
+
+	if code, _, errOut = runCli(t, "", with("find", "people", `{"age": {"$foo": 1}}`)...); code != 1 || errOut == "" {
+		t.Error("find with a bad filter expected to fail, code:", code)
+	}
+
+	update := `{"$set": {"retired": true}, "$rename": {"name": "fullName"}}`
+	if code, out, _ = runCli(t, "", with("update", "people", `{"age": {"$gte": 65}}`, update)...); code != 0 || strings.TrimSpace(out) != "2" {
+		t.Error("update unexpected output:", code, out)
+	}
+	if code, out, _ = runCli(t, "", with("count", "people", `{"retired": true, "fullName": {"$exists": true}}`)...); strings.TrimSpace(out) != "2" {
+		t.Error("count after update unexpected output:", code, out)
+	}
+	if code, _, _ = runCli(t, "", with("update", "people", "{}", `{"$inc": {"age": 1}}`)...); code != 1 {
+		t.Error("update with an unknown operator expected to fail, code:", code)
+	}
+
+	if code, out, _ = runCli(t, "", with("delete", "people", `{"id": {"$in": [1, 2]}}`)...); code != 0 || strings.TrimSpace(out) != "2" {
+		t.Error("delete unexpected output:", code, out)
+	}
+	if code, out, _ = runCli(t, "", with("-o", "ndjson", "compact")...); code != 0 || !strings.Contains(out, `"removedLines":2`) {
+		t.Error("compact unexpected output:", code, out)
+	}
+	if code, out, _ = runCli(t, "", with("verify", "people")...); code != 0 || !strings.Contains(out, `"docs":2`) {
+		t.Error("verify unexpected output:", code, out)
+	}
+
+	code, out, _ = runCli(t, "", with("export", "people")...)
+	if code != 0 || len(strings.Split(strings.TrimSpace(out), "\n")) != 2 {
+		t.Fatal("export unexpected output:", code, out)
+	}
+	if code, _, _ = runCli(t, out, with("import", "copy")...); code != 0 {
+		t.Error("import of the export failed, code:", code)
+	}
+	if code, out, _ = runCli(t, "", with("count", "copy")...); strings.TrimSpace(out) != "2" {
+		t.Error("count of the imported collection unexpected output:", code, out)
+	}
+}
+
+func TestCliImport(t *testing.T) {
+	dir := t.TempDir()
+	with := func(args ...string) []string {
+		return append([]string{"-dir", dir, "-db", "importdb", "-o", "ndjson"}, args...)
+	}
+	count := func(coll string) string {
+		_, out, _ := runCli(t, "", with("count", coll)...)
+		return strings.TrimSpace(out)
+	}
+
+	// Hatalı satırda durur, önceki satırlar eklenir
+	input := "{\"id\": 1}\nnot json\n{\"id\": 3}\n"
+	code, out, errOut := runCli(t, input, with("import", "strict")...)
+	if code != 1 || !strings.Contains(out, `"imported":1`) || !strings.Contains(errOut, "line 2") {
+		t.Error("import expected to stop at line 2:", code, out, errOut)
+	}
+	code, out, _ = runCli(t, input, with("-skip-errors", "-batch", "1", "import", "skipping")...)
+	if code != 0 || !strings.Contains(out, `"imported":2,"skipped":1`) || count("skipping") != "2" {
+		t.Error("import with -skip-errors unexpected output:", code, out)
+	}
+
+	// JSON dizileri, -format json olmadan da okunur
+	array := `[{"id": 1, "tags": ["a"]},
+  {"id": 2}, 5]`
+	code, out, _ = runCli(t, array, with("-skip-errors", "import", "array")...)
+	if code != 0 || !strings.Contains(out, `"imported":2,"skipped":1`) {
+		t.Error("import of a JSON array unexpected output:", code, out)
+	}
+	if code, _, errOut = runCli(t, `{"id": 1}`, with("-format", "json", "import", "array")...); code != 1 || !strings.Contains(errOut, "expected a JSON array") {
+		t.Error("-format json expected to require an array:", code, errOut)
+	}
+
+	code, out, _ = runCli(t, "1,Ada\n2,Linus\n", with("-format", "csv", "-fields", "id,name", "import", "csv")...)
+	if code != 0 || !strings.Contains(out, `"imported":2`) {
+		t.Error("CSV import unexpected output:", code, out)
+	}
+	if _, out, _ = runCli(t, "", with("find", "csv", `{"id": 2}`)...); !strings.Contains(out, `"name":"Linus"`) {
+		t.Error("CSV import did not infer the columns:", out)
+	}
+	if code, _, _ = runCli(t, "", with("-format", "xml", "import", "csv")...); code != 1 {
+		t.Error("unknown import format expected to fail, code:", code)
+	}
+
+	if code, _, _ = runCli(t, ""); code != 2 {
+		t.Error("run without a command expected to return 2, got:", code)
+	}
+	if code, _, _ = runCli(t, "", with("nope")...); code != 2 {
+		t.Error("unknown command expected to return 2, got:", code)
+	}
+	if code, _, _ = runCli(t, "", with("count")...); code != 2 {
+		t.Error("missing argument expected to return 2, got:", code)
+	}
+}
+
+func TestCliClosesDatabase(t *testing.T) {
+	dir := t.TempDir()
+	code, out, errOut := runCli(t, `{"id": 1}`, "-dir", dir, "-db", "closedb", "-o", "ndjson", "import", "items")
+	if code != 0 || !strings.Contains(out, `"imported":1`) {
+		t.Fatal("import failed:", code, out, errOut)
+	}
+
+	// İstatistikler yalnızca veritabanı kapatılınca yazılır
+	content, err := ioutil.ReadFile(filepath.Join(dir, "closedb", "items", "info.json"))
+	if err != nil {
+		t.Fatal("statistics are not written, database is not closed:", err)
+	}
+	if !strings.Contains(string(content), `"live":1`) {
+		t.Error("unexpected statistics:", string(content))
+	}
+}
+
+func TestCliExportCSV(t *testing.T) {
+	dir := t.TempDir()
+	input := `{"id": 1, "name": "Ada", "address": {"city": "London"}}
+{"id": 2, "name": "Linus"}`
+	if code, _, errOut := runCli(t, input, "-dir", dir, "-db", "clidb", "import", "people"); code != 0 {
+		t.Fatal("import failed:", errOut)
+	}
+
+	code, out, errOut := runCli(t, "", "-dir", dir, "-db", "clidb", "-format", "csv", "-fields", "id, address.city", "export", "people", `{"id": 1}`)
+	if code != 0 || out != "id,address.city\n1,London\n" {
+		t.Errorf("csv export unexpected output: %d %q %s", code, out, errOut)
+	}
+	if code, _, _ = runCli(t, "", "-dir", dir, "-db", "clidb", "-format", "xml", "export", "people"); code != 1 {
+		t.Error("export with an unknown format expected to fail, code:", code)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mgulsoy/arnedb"
+)
+
+// historySize is the maximum number of the lines kept in the shell history
+const historySize = 500
+
+// shellCommands are the commands of the interactive shell
+var shellCommands = map[string]struct {
+	args string
+	help string
+}{
+	"use":     {"<coll>", "select the collection used by the other commands"},
+	"colls":   {"", "list the collections"},
+	"find":    {"[filter]", "print the documents matching the filter"},
+	"count":   {"[filter]", "count the documents matching the filter"},
+	"insert":  {"<document or array>", "insert documents"},
+	"update":  {"<filter> <update>", `update the matching documents, update is like {"$set": {...}}`},
+	"delete":  {"<filter>", "delete the documents matching the filter"},
+	"history": {"", "list the history"},
+	"help":    {"", "show this help"},
+	"exit":    {"", "leave the shell, Ctrl-D works too"},
+}
+
+// shell is an interactive session on a database
+type shell struct {
+	c       *cli
+	db      *arnedb.ArneDB
+	coll    *arnedb.Coll
+	history []string
+}
+
+// shell command starts an interactive shell. When the input is a terminal, lines can be edited,
+// previous lines are recalled with the arrow keys and collection names are completed with the tab
+// key. Otherwise the lines are read one by one, so the shell can run scripts.
+func (c *cli) shell(args []string) error {
+	switch len(args) {
+	case 0:
+	case 2:
+		c.dir, c.dbName = args[0], args[1]
+	default:
+		return errors.New("usage: arnedb shell <baseDir> <db>")
+	}
+
+	db, err := c.open(true, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	sh := &shell{c: c, db: db}
+	if f, ok := c.stdin.(*os.File); ok {
+		if restore, err := makeRaw(f.Fd()); err == nil {
+			defer restore()
+			editor := newLineEditor(f, c.stdout, sh.complete)
+			editor.history = loadHistory()
+			defer func() { saveHistory(editor.history) }()
+			fmt.Fprintf(c.stdout, "arnedb shell on %s, type help for the commands\n", c.dbName)
+			sh.loop(editor, editor.addHistory)
+			return nil
+		}
+	}
+
+	if failed := sh.loop(newPlainReader(c.stdin), nil); failed > 0 {
+		return errors.New(fmt.Sprintf("%d commands failed", failed))
+	}
+	return nil
+}
+
+// loop runs the commands until the input ends and returns the number of the failed commands
+func (sh *shell) loop(reader lineReader, remember func(string)) (failed int) {
+	for {
+		line, err := reader.readLine(sh.prompt())
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(sh.c.stderr, "error:", err)
+				failed++
+			}
+			return failed
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sh.history = append(sh.history, line)
+		if remember != nil {
+			remember(line)
+		}
+
+		done, err := sh.exec(line)
+		if err != nil {
+			fmt.Fprintln(sh.c.stderr, "error:", err)
+			failed++
+		}
+		if done {
+			return failed
+		}
+	}
+}
+
+func (sh *shell) prompt() string {
+	if sh.coll == nil {
+		return sh.c.dbName + "> "
+	}
+	return sh.c.dbName + ":" + sh.coll.GetName() + "> "
+}
+
+// exec runs a single line. It returns true if the shell should end.
+func (sh *shell) exec(line string) (bool, error) {
+	name, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch name {
+	case "exit", "quit":
+		return true, nil
+	case "help":
+		sh.help()
+		return false, nil
+	case "history":
+		for i, entry := range sh.history {
+			fmt.Fprintf(sh.c.stdout, "%5d  %s\n", i+1, entry)
+		}
+		return false, nil
+	case "colls":
+		return false, sh.c.printCollNames(sh.db)
+	case "use":
+		if rest == "" {
+			if sh.coll == nil {
+				return false, errors.New("no collection selected")
+			}
+			fmt.Fprintln(sh.c.stdout, sh.coll.GetName())
+			return false, nil
+		}
+		coll, err := getColl(sh.db, rest)
+		if err != nil {
+			return false, err
+		}
+		sh.coll = coll
+		return false, nil
+	}
+
+	if _, found := shellCommands[name]; !found {
+		return false, errors.New(fmt.Sprintf("unknown command %q, type help for the commands", name))
+	}
+	if sh.coll == nil {
+		return false, errors.New("no collection selected, type use <coll>")
+	}
+
+	switch name {
+	case "find", "count", "delete":
+		filter, err := parseFilterText(rest)
+		if err != nil {
+			return false, err
+		}
+		return false, sh.query(name, filter)
+	case "insert":
+		docs, err := readDocs(strings.NewReader(rest))
+		if err != nil {
+			return false, err
+		}
+		n, err := sh.coll.AddAll(docs...)
+		if err != nil {
+			return false, err
+		}
+		return false, sh.c.printValue(n)
+	case "update":
+		values, err := splitJSON(rest)
+		if err != nil {
+			return false, err
+		}
+		if len(values) != 2 {
+			return false, errors.New("usage: update <filter> <update>")
+		}
+		filter, err := arnedb.ParseFilter(values[0])
+		if err != nil {
+			return false, err
+		}
+		patch, err := arnedb.ParseUpdate(values[1])
+		if err != nil {
+			return false, err
+		}
+		patch.Filter = filter
+		n, err := sh.coll.ApplyPatch(patch)
+		if err != nil {
+			return false, err
+		}
+		return false, sh.c.printValue(n)
+	}
+	return false, nil
+}
+
+// query runs the find, count and delete commands on the selected collection
+func (sh *shell) query(name string, filter *arnedb.Filter) error {
+	switch name {
+	case "count":
+		n, err := sh.coll.CountFilter(filter)
+		if err != nil {
+			return err
+		}
+		return sh.c.printValue(n)
+	case "delete":
+		n, err := sh.coll.DeleteAll(filter.Predicate())
+		if err != nil {
+			return err
+		}
+		return sh.c.printValue(n)
+	}
+
+	docs, err := sh.coll.Find(filter)
+	if err != nil {
+		return err
+	}
+	if sh.c.limit > 0 && len(docs) > sh.c.limit {
+		docs = docs[:sh.c.limit]
+	}
+	return sh.c.printRows(docRows(docs))
+}
+
+func (sh *shell) help() {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(sh.c.stdout, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s %s\t%s\n", name, shellCommands[name].args, shellCommands[name].help)
+	}
+	_ = tw.Flush()
+}
+
+// complete completes the command names at the start of the line and the collection names after use
+func (sh *shell) complete(line []rune, pos int) (int, []string) {
+	start := pos
+	for start > 0 && line[start-1] != ' ' {
+		start--
+	}
+	word := string(line[start:pos])
+	before := strings.Fields(string(line[:start]))
+
+	var names []string
+	switch {
+	case len(before) == 0:
+		for name := range shellCommands {
+			names = append(names, name)
+		}
+	case len(before) == 1 && before[0] == "use":
+		names = sh.db.GelCollNames()
+	}
+
+	candidates := make([]string, 0)
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+// parseFilterText parses a filter. An empty text matches all the documents.
+func parseFilterText(text string) (*arnedb.Filter, error) {
+	if text == "" {
+		text = "{}"
+	}
+	return arnedb.ParseFilter([]byte(text))
+}
+
+// splitJSON splits the text into the JSON values written one after another
+func splitJSON(text string) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	values := make([]json.RawMessage, 0, 2)
+	for {
+		var value json.RawMessage
+		err := dec.Decode(&value)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid json: %s", err.Error()))
+		}
+		values = append(values, value)
+	}
+}
+
+// historyPath returns the file of the shell history. It is $ARNEDB_HISTORY or .arnedb_history in
+// the home directory.
+func historyPath() string {
+	if path := os.Getenv("ARNEDB_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".arnedb_history")
+}
+
+// loadHistory reads the saved history. A missing file gives an empty history.
+func loadHistory() []string {
+	history := make([]string, 0)
+	path := historyPath()
+	if path == "" {
+		return history
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return history
+	}
+	defer f.Close()
+
+	scn := bufio.NewScanner(f)
+	for scn.Scan() {
+		if line := scn.Text(); line != "" {
+			history = append(history, line)
+		}
+	}
+	if len(history) > historySize {
+		history = history[len(history)-historySize:]
+	}
+	return history
+}
+
+// saveHistory writes the history. Errors are ignored, the history is not essential.
+func saveHistory(history []string) {
+	path := historyPath()
+	if path == "" || len(history) == 0 {
+		return
+	}
+	_ = os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0600)
+}
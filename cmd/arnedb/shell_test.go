@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestShellScript(t *testing.T) {
+	dir := t.TempDir()
+	if code, _, errOut := runCli(t, `{"id": 1, "name": "Ada"}`, "-dir", dir, "-db", "shelldb", "import", "people"); code != 0 {
+		t.Fatal("import failed:", errOut)
+	}
+
+	script := `count
+use people
+# yorum satırı
+insert [{"id": 2, "name": "Linus"}, {"id": 3, "name": "Grace"}]
+count {"id": {"$gt": 1}}
+update {"id": 2} {"$set": {"os": "linux"}}
+find {"os": "linux"}
+delete {"id": 3}
+count
+history
+exit
+count
+`
+	code, out, errOut := runCli(t, script, "-o", "ndjson", "shell", dir, "shelldb")
+	if code != 1 || !strings.Contains(errOut, "no collection selected") || !strings.Contains(errOut, "1 commands failed") {
+		t.Error("shell expected one failed command, got:", code, errOut)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	expected := []string{"2", "2", "1", "", "1", "2"}
+	if len(lines) < len(expected) {
+		t.Fatal("shell output is too short:", out)
+	}
+	for i, want := range expected {
+		if want != "" && lines[i] != want {
+			t.Errorf("shell output line %d expected %q, got %q", i+1, want, lines[i])
+		}
+	}
+	if !strings.Contains(lines[3], `"os":"linux"`) {
+		t.Error("find output unexpected:", lines[3])
+	}
+	if !strings.Contains(out, "    9  history") {
+		t.Error("history output unexpected:", out)
+	}
+
+	if code, _, errOut = runCli(t, "use nothing\n", "shell", dir, "shelldb"); code != 1 || !strings.Contains(errOut, "collection does not exist") {
+		t.Error("use of a missing collection expected to fail:", code, errOut)
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	complete := func(line []rune, pos int) (int, []string) {
+		start := pos
+		for start > 0 && line[start-1] != ' ' {
+			start--
+		}
+		candidates := make([]string, 0)
+		for _, name := range []string{"people", "pets", "orders"} {
+			if strings.HasPrefix(name, string(line[start:pos])) {
+				candidates = append(candidates, name)
+			}
+		}
+		return start, candidates
+	}
+
+	keys := strings.Join([]string{
+		"use o\t\r",           // tek aday tamamlanır
+		"use p\t\tople\t\r",   // ortak önek, liste, sonra tamamlama
+		"fnd\x1b[D\x1b[Di\r",  // imleç hareketi ile ekleme
+		"abc\x7f\x7fx\x01y\r", // silme ve satır başı
+		"\x1b[A\x1b[A\r",      // geçmişte gezinme
+		"zzz\x03",             // Ctrl-C satırı iptal eder
+		"\x04",                // boş satırda Ctrl-D
+	}, "")
+
+	var out bytes.Buffer
+	editor := newLineEditor(strings.NewReader(keys), &out, complete)
+	expected := []string{"use orders ", "use people ", "find", "yax", "find"}
+	for _, want := range expected {
+		line, err := editor.readLine("> ")
+		if err != nil {
+			t.Fatal("readLine failed with:", err)
+		}
+		if line != want {
+			t.Errorf("readLine expected %q, got %q", want, line)
+		}
+		editor.addHistory(line)
+	}
+	if _, err := editor.readLine("> "); err != errInterrupted {
+		t.Error("Ctrl-C expected to interrupt, got:", err)
+	}
+	if _, err := editor.readLine("> "); err != io.EOF {
+		t.Error("Ctrl-D expected to end the input, got:", err)
+	}
+	if !strings.Contains(out.String(), "people  pets") {
+		t.Error("candidates expected to be listed, output:", out.String())
+	}
+	editor.addHistory("find")
+	if len(editor.history) != 5 {
+		t.Error("a repeated line expected to be kept once in the history, got:", editor.history)
+	}
+}
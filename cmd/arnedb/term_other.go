@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "errors"
+
+// makeRaw is not supported on this platform. The shell reads plain lines instead.
+func makeRaw(uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
@@ -0,0 +1,492 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Codec encodes the documents of a collection. Every document is stored as a single line, so an
+// encoded document must not contain '\n' or end with '\r'. Encoded documents must not start with
+// the bytes 0x1b 'E', they mark encrypted records.
+type Codec interface {
+	// Name identifies the codec. It is stored in the collection metadata.
+	Name() string
+	// Marshal encodes a document.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes a document into v like json.Unmarshal does.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default codec. Documents are stored as JSON.
+var JSONCodec Codec = jsonCodec{}
+
+// MsgPackCodec stores the documents in MessagePack binary format. Documents are converted to the
+// JSON data model first, so struct tags of encoding/json apply and numbers are decoded as float64
+// just like JSONCodec does.
+var MsgPackCodec Codec = msgPackCodec{}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		JSONCodec.Name():    JSONCodec,
+		MsgPackCodec.Name(): MsgPackCodec,
+	}
+)
+
+// RegisterCodec makes a codec available by its name. Collections using a codec can only be opened
+// after it is registered. It panics if a codec with the same name is already registered.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if c == nil {
+		panic("arnedb: RegisterCodec codec is nil")
+	}
+	if _, dup := codecs[c.Name()]; dup {
+		panic("arnedb: RegisterCodec called twice for codec " + c.Name())
+	}
+	codecs[c.Name()] = c
+}
+
+// lookupCodec returns the registered codec. An empty name means JSONCodec.
+func lookupCodec(name string) (Codec, error) {
+	if name == "" {
+		return JSONCodec, nil
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, found := codecs[name]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("unknown codec: %s", name))
+	}
+	return c, nil
+}
+
+// WithCodec option selects the codec of a new collection. The codec cannot be changed later.
+func WithCodec(c Codec) CollOption {
+	return func(coll *Coll) error {
+		if _, err := lookupCodec(c.Name()); err != nil {
+			return err // Kayıtlı olmayan codec ile açılamaz
+		}
+		coll.meta.Codec = c.Name()
+		return nil
+	}
+}
+
+// GetCodec returns the codec of the collection.
+func (coll *Coll) GetCodec() Codec {
+	return coll.codec()
+}
+
+// codec returns the codec of the collection. Its existence is checked while loading the metadata.
+func (coll *Coll) codec() Codec {
+	coll.metaMu.RLock()
+	name := coll.meta.Codec
+	coll.metaMu.RUnlock()
+
+	c, err := lookupCodec(name)
+	if err != nil {
+		return JSONCodec
+	}
+	return c
+}
+
+// JSON ---------------------------------------------------------------------------------------------
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// MessagePack --------------------------------------------------------------------------------------
+
+// Satır sonu karakterleri kaçış baytı ile kodlanır:
+// 0x0a -> 0x1b 0x01, 0x0d -> 0x1b 0x02, 0x1b -> 0x1b 0x03
+const msgPackEscape = 0x1b
+
+type msgPackCodec struct{}
+
+func (msgPackCodec) Name() string { return "msgpack" }
+
+func (msgPackCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := make([]byte, 0, 128)
+	buf, err := appendMsgPack(buf, v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kaçış gerektiren bayt yoksa kopyalanmaz
+	escapes := 0
+	for _, b := range buf {
+		if b == '\n' || b == '\r' || b == msgPackEscape {
+			escapes++
+		}
+	}
+	if escapes == 0 {
+		return buf, nil
+	}
+	result := make([]byte, 0, len(buf)+escapes)
+	for _, b := range buf {
+		switch b {
+		case '\n':
+			result = append(result, msgPackEscape, 0x01)
+		case '\r':
+			result = append(result, msgPackEscape, 0x02)
+		case msgPackEscape:
+			result = append(result, msgPackEscape, 0x03)
+		default:
+			result = append(result, b)
+		}
+	}
+	return result, nil
+}
+
+func (msgPackCodec) Unmarshal(data []byte, v interface{}) error {
+	raw := data
+	for i, b := range data {
+		if b == msgPackEscape {
+			raw = unescapeMsgPack(data[i:], append([]byte(nil), data[:i]...))
+			break
+		}
+	}
+
+	d := msgPackDecoder{data: raw}
+	value, err := d.decode()
+	if err != nil {
+		return err
+	}
+	if d.pos != len(raw) {
+		return errors.New("msgpack: unexpected data after document")
+	}
+
+	switch target := v.(type) {
+	case *RecordInstance:
+		m, ok := value.(map[string]interface{})
+		if !ok && value != nil {
+			return errors.New(fmt.Sprintf("msgpack: cannot decode %T into a record", value))
+		}
+		*target = m
+		return nil
+	case *map[string]interface{}:
+		m, ok := value.(map[string]interface{})
+		if !ok && value != nil {
+			return errors.New(fmt.Sprintf("msgpack: cannot decode %T into a map", value))
+		}
+		*target = m
+		return nil
+	case *interface{}:
+		*target = value
+		return nil
+	}
+
+	// Diğer tipler encoding/json kuralları ile doldurulur
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func unescapeMsgPack(data []byte, result []byte) []byte {
+	for i := 0; i < len(data); i++ {
+		if data[i] != msgPackEscape || i+1 == len(data) {
+			result = append(result, data[i])
+			continue
+		}
+		i++
+		switch data[i] {
+		case 0x01:
+			result = append(result, '\n')
+		case 0x02:
+			result = append(result, '\r')
+		default:
+			result = append(result, msgPackEscape)
+		}
+	}
+	return result
+}
+
+// appendMsgPack encodes the value into buf. Types outside the JSON data model are converted with
+// encoding/json first.
+func appendMsgPack(buf []byte, v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if value {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case string:
+		return appendMsgPackString(buf, value), nil
+	case float64:
+		return appendMsgPackFloat(buf, value), nil
+	case float32:
+		return appendMsgPackFloat(buf, float64(value)), nil
+	case int:
+		return appendMsgPackInt(buf, int64(value)), nil
+	case int64:
+		return appendMsgPackInt(buf, value), nil
+	case int32:
+		return appendMsgPackInt(buf, int64(value)), nil
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgPackFloat(buf, f), nil
+	case []interface{}:
+		buf = appendMsgPackHeader(buf, len(value), 0x90, 0xdc)
+		var err error
+		for _, e := range value {
+			if buf, err = appendMsgPack(buf, e); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case RecordInstance:
+		return appendMsgPackMap(buf, value)
+	case map[string]interface{}:
+		return appendMsgPackMap(buf, value)
+	}
+
+	// JSON veri modeline dönüştürülür
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err = json.Unmarshal(payload, &generic); err != nil {
+		return nil, err
+	}
+	return appendMsgPack(buf, generic)
+}
+
+func appendMsgPackMap(buf []byte, m map[string]interface{}) ([]byte, error) {
+	buf = appendMsgPackHeader(buf, len(m), 0x80, 0xde)
+
+	// Aynı dokümanın aynı şekilde kodlanması için anahtarlar sıralanır
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var err error
+	for _, k := range keys {
+		buf = appendMsgPackString(buf, k)
+		if buf, err = appendMsgPack(buf, m[k]); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendMsgPackHeader writes the header of an array or map. fix is the fix format code, code16 is
+// the 16-bit format code which is followed by the 32-bit one.
+func appendMsgPackHeader(buf []byte, n int, fix byte, code16 byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, code16, byte(n>>8), byte(n))
+	default:
+		return append(buf, code16+1, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgPackString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, s...)
+}
+
+// appendMsgPackFloat writes integral numbers as integers since they are smaller
+func appendMsgPackFloat(buf []byte, f float64) []byte {
+	if f == math.Trunc(f) && f >= -(1<<53) && f <= 1<<53 {
+		return appendMsgPackInt(buf, int64(f))
+	}
+	bits := math.Float64bits(f)
+	return append(buf, 0xcb, byte(bits>>56), byte(bits>>48), byte(bits>>40), byte(bits>>32),
+		byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+}
+
+func appendMsgPackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return append(buf, 0xd1, byte(i>>8), byte(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return append(buf, 0xd2, byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+	default:
+		return append(buf, 0xd3, byte(i>>56), byte(i>>48), byte(i>>40), byte(i>>32),
+			byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+	}
+}
+
+// msgPackDecoder decodes MessagePack into the JSON data model. Numbers are decoded as float64.
+type msgPackDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errMsgPackShort = errors.New("msgpack: unexpected end of data")
+
+func (d *msgPackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errMsgPackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes
+func (d *msgPackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *msgPackDecoder) decode() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c & 0x1f))
+	case c >= 0x90 && c <= 0x9f:
+		return d.array(int(c & 0x0f))
+	case c >= 0x80 && c <= 0x8f:
+		return d.object(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (c - 0xcc))
+		return float64(v), err
+	case 0xd0:
+		v, err := d.uint(1)
+		return float64(int8(v)), err
+	case 0xd1:
+		v, err := d.uint(2)
+		return float64(int16(v)), err
+	case 0xd2:
+		v, err := d.uint(4)
+		return float64(int32(v)), err
+	case 0xd3:
+		v, err := d.uint(8)
+		return float64(int64(v)), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(int(n))
+	}
+
+	return nil, errors.New(fmt.Sprintf("msgpack: unsupported type 0x%02x", c))
+}
+
+func (d *msgPackDecoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgPackDecoder) array(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errMsgPackShort // Her eleman en az bir bayttır
+	}
+	result := make([]interface{}, n)
+	for i := range result {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+func (d *msgPackDecoder) object(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errMsgPackShort
+	}
+	result := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.New("msgpack: map keys must be strings")
+		}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		result[key] = v
+	}
+	return result, nil
+}
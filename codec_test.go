@@ -0,0 +1,117 @@
+package arnedb
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMsgPackCodec(t *testing.T) {
+	doc := RecordInstance{
+		"int":    10.0, // 0x0a satır sonu baytıdır
+		"neg":    -1234567.0,
+		"float":  math.Pi,
+		"text":   "line\nbreak\r\x1b",
+		"long":   string(bytes.Repeat([]byte("x"), 300)),
+		"bool":   true,
+		"null":   nil,
+		"list":   []interface{}{1.0, "a", []interface{}{}},
+		"nested": map[string]interface{}{"k": 13.0},
+	}
+
+	encoded, err := MsgPackCodec.Marshal(doc)
+	if err != nil {
+		t.Fatal("Marshal failed with:", err)
+	}
+	if bytes.ContainsAny(encoded, "\n\r") {
+		t.Error("Encoded document contains a line break")
+	}
+
+	var decoded RecordInstance
+	if err = MsgPackCodec.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal("Unmarshal failed with:", err)
+	}
+	if !reflect.DeepEqual(map[string]interface{}(doc), map[string]interface{}(decoded)) {
+		t.Errorf("Round trip mismatch:\n%v\n%v", doc, decoded)
+	}
+
+	var typed SampleRecordType
+	encoded, _ = MsgPackCodec.Marshal(SampleRecordType{Id: 3, Name: "Mert", ArrayValue: []string{"a"}})
+	if err = MsgPackCodec.Unmarshal(encoded, &typed); err != nil || typed.Id != 3 || typed.ArrayValue[0] != "a" {
+		t.Errorf("Typed round trip returned %+v, %v", typed, err)
+	}
+
+	if err = MsgPackCodec.Unmarshal(encoded[:len(encoded)-2], &decoded); err == nil {
+		t.Error("Truncated document is decoded")
+	}
+}
+
+func TestCollCodec(t *testing.T) {
+	_ = os.RemoveAll("testdb/codecdb")
+
+	pDb, err := Open("testdb", "codecdb")
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	people, err := pDb.CreateColl("people", WithCodec(MsgPackCodec))
+	if err != nil {
+		t.Fatal("Create people failed with:", err)
+	}
+	if err = people.SetSchema([]byte(`{"required": ["Id"]}`)); err != nil {
+		t.Fatal("SetSchema failed with:", err)
+	}
+
+	for i := 1; i <= 20; i++ {
+		err = people.Add(SampleRecordType{Id: i, Name: "Person", Nested: SampleNestedType{IntegerValue: i * 10}})
+		if err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	if err = people.Add(RecordInstance{"Name": "nobody"}); err == nil {
+		t.Error("Schema is not enforced")
+	}
+	_, err = people.UpdateAll(func(i RecordInstance) bool { return i["Id"].(float64) > 10 },
+		func(ptrRecord *RecordInstance) *RecordInstance {
+			(*ptrRecord)["Name"] = "Updated"
+			return ptrRecord
+		})
+	if err != nil {
+		t.Fatal("UpdateAll failed with:", err)
+	}
+	if _, err = people.DeleteFirst(func(i RecordInstance) bool { return i["Id"].(float64) == 1 }); err != nil {
+		t.Fatal("DeleteFirst failed with:", err)
+	}
+
+	raw, _ := os.ReadFile("testdb/codecdb/people/" + firstChunkName)
+	if bytes.Contains(raw, []byte(`"Name"`)) {
+		t.Error("Chunk is stored as JSON")
+	}
+
+	// Codec yeniden açılışta metadata'dan okunur
+	pDb, err = Open("testdb", "codecdb")
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	people = pDb.GetColl("people")
+	if people.GetCodec() != MsgPackCodec {
+		t.Fatal("Codec is not loaded")
+	}
+	found, err := GetFirstAs[SampleRecordType](people, func(i *SampleRecordType) bool { return i.Nested.IntegerValue == 150 })
+	if err != nil || found == nil || found.Name != "Updated" {
+		t.Errorf("GetFirstAs returned %+v, %v", found, err)
+	}
+	n, err := people.Count(func(i RecordInstance) bool { return i["Name"] == "Person" })
+	if err != nil || n != 9 {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+
+	if _, err = pDb.CreateColl("bad", WithCodec(unknownCodec{})); err == nil {
+		t.Error("Unregistered codec is accepted")
+	}
+}
+
+type unknownCodec struct{ jsonCodec }
+
+func (unknownCodec) Name() string { return "unknown" }
@@ -3,17 +3,15 @@ package arnedb
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const firstChunkName = "00.json"
@@ -21,6 +19,10 @@ const maxChunkSize = 1024 * 1024 // 1MB
 const recordSepChar = 10         // --> \n
 const recordSepStr = "\n"
 
+// maxRecordSize is the longest record line read from a chunk. A chunk grows over maxChunkSize with
+// the record appended last, so a record line can be about as long as the chunk limit.
+const maxRecordSize = 2 * maxChunkSize
+
 // RecordInstance represents a record instance read from data file. It is actually a map.
 type RecordInstance map[string]interface{}
 
@@ -35,56 +37,60 @@ type UpdateFunc func(ptrRecord *RecordInstance) *RecordInstance
 
 // Add function appends data into a collection
 func (coll *Coll) Add(data interface{}) error {
+	if err := coll.db.checkWritable("Add"); err != nil {
+		return err
+	}
+	codec := coll.codec()
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
 
 	// Kolleksiyonlar chunkXX.json adı verilen yığınlara ayrılır. Her bir yığın max 1 MB büyüklüğe kadar
 	// büyüyebilir.
 
-	payload, err := json.Marshal(data)
+	payload, err := codec.Marshal(data)
 	if err != nil {
 		// veriyi paketlemekte sorun
 		return errors.New(fmt.Sprintf("cannot marshal data: %s", err.Error()))
 	}
 
-	// Coll var mı ona bakılır. Yoksa hata...
-	_, err = os.Stat(coll.dbpath)
-	if os.IsNotExist(err) {
-		return errors.New(fmt.Sprintf("collection does not exist: %s", err.Error()))
+	payload, err = coll.prepareWrite(BeforeInsert, payload, nil)
+	if err != nil {
+		return err
 	}
 
-	// Coll var. En son chunk bulunur.
+	// En son chunk bulunur. Coll yoksa hata...
 	lastChunk, err := coll.createChunk()
 	if err != nil {
 		return err
 	}
 
-	// Elimizde en son chunk var.
-	chunkPath := filepath.Join(coll.dbpath, (*lastChunk).Name())
-	f, err := os.OpenFile(chunkPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	// Kayıt sonu karakteri eklenir. Şifreleme varsa kayıt şifrelenir.
+	line, err := sealLines(coll.db.cipher(), append(payload, byte(recordSepChar)))
 	if err != nil {
-		return errors.New(fmt.Sprintf("cannot open chunk to add data: %s", err.Error()))
+		return err
 	}
 
-	// Kayıt sonu karakteri eklenir
-	payload = append(payload, byte(recordSepChar))
-	write, err := f.Write(payload)
+	// Elimizde en son chunk var.
+	err = coll.db.storage.Append(coll.GetName(), (*lastChunk).Name(), line)
+	coll.db.cache.invalidate(coll.GetName(), (*lastChunk).Name())
 	if err != nil {
 		return errors.New(fmt.Sprintf("cannot append chunk: %s", err.Error()))
 	}
+	coll.chunkAppended((*lastChunk).Name(), 1, len(line))
 
-	if write != len(payload) {
-		return errors.New(fmt.Sprintf("append to chunk failed with: %d bytes diff", len(payload)-write))
-	}
-	err = f.Close()
-	if err != nil {
-		return errors.New(fmt.Sprintf("append failed to clos file: %s", err.Error()))
+	// Sınırlı kolleksiyonlarda en eski chunk'lar silinir.
+	if err = coll.enforceCap(); err != nil {
+		return err
 	}
 
 	// işlem başarılı
-	return nil
+	return coll.commit(ChangeInsert, []recordChange{{doc: payload}})
 }
 
 // AddAll function appends multiple data into a collection. If one fails, no data will be committed to storage. Thus,
-// this function acts like a transaction. This function is a variadic function which accepts a SLICE as an argument:
+// this function acts like a transaction. Large batches are split into new chunks at the chunk limits, so capped
+// collections stay in their limits. This function is a variadic function which accepts a SLICE as an argument:
 //
 //	d := []RecordInstance{ a, b, c}
 //	AddAll(d...)
@@ -93,66 +99,106 @@ func (coll *Coll) Add(data interface{}) error {
 //
 //	AddAll(d1,d2,d3)
 func (coll *Coll) AddAll(data ...RecordInstance) (int, error) {
-
-	n := 0
-	_, err := os.Stat(coll.dbpath)
-	if os.IsNotExist(err) {
-		return n, errors.New(fmt.Sprintf("collection does not exist: %s", err.Error()))
+	if err := coll.db.checkWritable("AddAll"); err != nil {
+		return 0, err
 	}
+	codec := coll.codec()
 
-	// Coll var. En son chunk bulunur.
-	lastChunk, err := coll.createChunk()
-	if err != nil {
-		return n, err
-	}
-
-	bufferStore := make([]byte, 512*len(data)) // her eleman için 512 byte ayır
-	buffer := bytes.NewBuffer(bufferStore)
-	buffer.Reset()
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
 
-	// Ekleme işlemini hafızada gerçekleştir.
-	// TODO: Test payload allocation performance
+	// Kayıtlar önce hafızada hazırlanır
+	payloads := make([][]byte, 0, len(data))
 	for _, dataElement := range data {
-		payload, err := json.Marshal(dataElement)
+		payload, err := codec.Marshal(dataElement)
 		if err != nil {
 			// veriyi paketlemekte sorun
 			return 0, errors.New(fmt.Sprintf("cannot marshal data: %s", err.Error()))
 		}
 
-		// Tampon belleğe kaydı ekle
-		buffer.Write(payload)
-		// Kayıt sonu karakterini ekle
-		buffer.WriteString(recordSepStr)
-		n++
+		payload, err = coll.prepareWrite(BeforeInsert, payload, nil)
+		if err != nil {
+			return 0, err // Bir kayıt reddedilirse veya şemaya uymazsa hiçbiri yazılmaz
+		}
+		payloads = append(payloads, payload)
 	}
 
-	// Buraya kadar kod kırılmamışsa diske yazabiliriz.
-	// Elimizde en son chunk var.
-	chunkPath := filepath.Join(coll.dbpath, (*lastChunk).Name())
-	f, err := os.OpenFile(chunkPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	// En son chunk bulunur. Coll yoksa hata...
+	lastChunk, err := coll.createChunk()
 	if err != nil {
-		return 0, errors.New(fmt.Sprintf("cannot open chunk to add data: %s", err.Error()))
+		return 0, err
 	}
+	return coll.appendRecords(lastChunk, payloads)
+}
 
-	// Şimdilik yazılan byte sayısı ile ilgilenmiyoruz
-	_, err = buffer.WriteTo(f)
-	if err != nil {
-		_ = f.Close()
-		return 0, errors.New(fmt.Sprintf("cannot append chunk: %s", err.Error()))
-	}
+// appendRecords appends the prepared records starting with the given chunk and sends the change
+// events. Records are split at the chunk limits, so new chunks are started as the chunks fill up.
+// coll.mu must be held.
+func (coll *Coll) appendRecords(lastChunk *fs.FileInfo, payloads [][]byte) (n int, err error) {
+	var changes []recordChange
+	tracking := coll.tracking(ChangeInsert)
+	defer func() {
+		// Yazılan kayıtların değişiklikleri hata olsa da gönderilir
+		if commitErr := coll.commit(ChangeInsert, changes); err == nil {
+			err = commitErr
+		}
+	}()
 
-	err = f.Close()
-	if err != nil {
-		return 0, errors.New(fmt.Sprintf("append failed to close file: %s", err.Error()))
+	for len(payloads) > 0 {
+		if n > 0 {
+			// Önceki chunk doldu
+			if lastChunk, err = coll.createChunk(); err != nil {
+				return n, err
+			}
+		}
+		count, err := coll.chunkRoom(*lastChunk, payloads)
+		if err != nil {
+			return n, err
+		}
+
+		size := 0
+		for _, payload := range payloads[:count] {
+			size += len(payload) + 1
+		}
+		buffer := bytes.NewBuffer(make([]byte, 0, size))
+		for _, payload := range payloads[:count] {
+			// Tampon belleğe kaydı ekle
+			buffer.Write(payload)
+			// Kayıt sonu karakterini ekle
+			buffer.WriteString(recordSepStr)
+		}
+
+		// Buraya kadar kod kırılmamışsa diske yazabiliriz.
+		content, err := sealLines(coll.db.cipher(), buffer.Bytes())
+		if err != nil {
+			return n, err
+		}
+
+		// Elimizde en son chunk var.
+		err = coll.db.storage.Append(coll.GetName(), (*lastChunk).Name(), content)
+		coll.db.cache.invalidate(coll.GetName(), (*lastChunk).Name())
+		if err != nil {
+			return n, errors.New(fmt.Sprintf("cannot append chunk: %s", err.Error()))
+		}
+		coll.chunkAppended((*lastChunk).Name(), count, len(content))
+
+		if tracking {
+			for _, payload := range payloads[:count] {
+				changes = append(changes, recordChange{doc: payload})
+			}
+		}
+		n += count
+		payloads = payloads[count:]
 	}
 
-	// işlem başarılı
-	return n, nil
+	// Sınırlı kolleksiyonlarda en eski chunk'lar silinir.
+	return n, coll.enforceCap()
 }
 
 // GetFirst function queries and gets the first match of the query.
 // The function returns nil if no data found.
 func (coll *Coll) GetFirst(predicate QueryPredicate) (result RecordInstance, err error) {
+	codec := coll.codec()
 	chunks, err := coll.getChunks()
 	if err != nil {
 		return nil, err
@@ -162,8 +208,11 @@ func (coll *Coll) GetFirst(predicate QueryPredicate) (result RecordInstance, err
 		// İçeride hiç veri yok
 		return nil, nil
 	}
+	if opts, parallel := coll.parallelScan(chunks); parallel {
+		return coll.getFirstParallel(chunks, opts, predicate)
+	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -178,22 +227,26 @@ func (coll *Coll) GetFirst(predicate QueryPredicate) (result RecordInstance, err
 	}()
 
 	var data RecordInstance
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return nil, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		dataMatched := false
 		for scn.Scan() {
 			line := scn.Bytes()
 			if len(line) == 0 {
 				continue
 			}
-			_ = json.Unmarshal(line, &data) // TODO: Handle error
+			data = nil                       // önceki kaydın alanları karışmasın
+			_ = codec.Unmarshal(line, &data) // TODO: Handle error
+			if coll.expired(data, now) {
+				continue
+			}
 			dataMatched = predicate(data)
 			if dataMatched {
 				break
@@ -201,8 +254,11 @@ func (coll *Coll) GetFirst(predicate QueryPredicate) (result RecordInstance, err
 		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if scanErr := scn.Err(); scanErr != nil {
+			return nil, scanErr // okunamayan kayıtlar atlanmaz
+		}
 		if dataMatched {
-			return data, nil
+			return coll.afterRead(data)
 		}
 	}
 
@@ -212,6 +268,7 @@ func (coll *Coll) GetFirst(predicate QueryPredicate) (result RecordInstance, err
 // GetFirstAs function queries given coll and gets the first match of the query. This function uses generics.
 // Returns nil if no data found.
 func GetFirstAs[T any](coll *Coll, predicate func(i *T) bool) (result *T, err error) {
+	codec := coll.codec()
 	chunks, err := coll.getChunks()
 	if err != nil {
 		return nil, err // marks not found
@@ -222,7 +279,7 @@ func GetFirstAs[T any](coll *Coll, predicate func(i *T) bool) (result *T, err er
 		return nil, nil // no data
 	}
 
-	var f *os.File
+	var f io.ReadCloser
 	defer func() { // predicate içindeki hatayı yakala
 		if r := recover(); r != nil {
 			//fmt.Errorf("recover??? %+v", r)
@@ -233,36 +290,43 @@ func GetFirstAs[T any](coll *Coll, predicate func(i *T) bool) (result *T, err er
 		}
 	}()
 
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return nil, err
 		}
 
-		dec := json.NewDecoder(f)
+		scn := newRecordScanner(f)
 		var m T
 		predicateResult := false
-		for {
-			err = dec.Decode(&m)
-			if err == io.EOF {
-				// eof
-				break
-			} else if err != nil {
-				//return false, err
+		for scn.Scan() {
+			line := scn.Bytes()
+			if len(line) == 0 || coll.expiredLine(line, now) {
+				continue
+			}
+			m = *new(T) // önceki kaydın alanları kalmasın
+			if codec.Unmarshal(line, &m) != nil {
 				continue // skip this record
 			}
 			predicateResult = predicate(&m)
 			if predicateResult == true {
+				err = coll.afterReadInto(line, &m)
 				break
 			}
 		}
 
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if scanErr := scn.Err(); scanErr != nil {
+			return nil, scanErr
+		}
 
 		if predicateResult == true {
+			if err != nil {
+				return nil, err
+			}
 			return &m, nil
 		}
 	}
@@ -274,6 +338,7 @@ func GetFirstAs[T any](coll *Coll, predicate func(i *T) bool) (result *T, err er
 // GetAllAs function queries given coll and returns all for the predicate match. This function uses generics.
 // Returns a slice of data pointers. If nothing is found then empty slice is returned
 func GetAllAs[T any](coll *Coll, predicate func(i *T) bool) (result []*T, err error) {
+	codec := coll.codec()
 	chunks, err := coll.getChunks()
 	if err != nil {
 		return nil, err // marks not found
@@ -285,8 +350,11 @@ func GetAllAs[T any](coll *Coll, predicate func(i *T) bool) (result []*T, err er
 		// İçeride hiç veri yok
 		return result, nil // no data
 	}
+	if opts, parallel := coll.parallelScan(chunks); parallel {
+		return getAllAsParallel(coll, chunks, opts, predicate)
+	}
 
-	var f *os.File
+	var f io.ReadCloser
 	defer func() { // predicate içindeki hatayı yakala
 		if r := recover(); r != nil {
 			//fmt.Errorf("recover??? %+v", r)
@@ -297,36 +365,41 @@ func GetAllAs[T any](coll *Coll, predicate func(i *T) bool) (result []*T, err er
 		}
 	}()
 
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return nil, err
 		}
 
-		dec := json.NewDecoder(f)
+		scn := newRecordScanner(f)
 		predicateResult := false
-		for {
+		for scn.Scan() {
+			line := scn.Bytes()
+			if len(line) == 0 || coll.expiredLine(line, now) {
+				continue
+			}
 			var m T
-			err = dec.Decode(&m)
-			if err == io.EOF {
-				// eof
-				break
-			} else if err != nil {
-				//return false, err
+			if codec.Unmarshal(line, &m) != nil {
 				continue // skip this record
 			}
 			predicateResult = predicate(&m)
 			if predicateResult == true {
+				if err = coll.afterReadInto(line, &m); err != nil {
+					_ = f.Close()
+					f = nil
+					return nil, err
+				}
 				result = append(result, &m)
 			}
 		}
 
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
-
-		return result, nil
+		if scanErr := scn.Err(); scanErr != nil {
+			return nil, scanErr
+		}
 	}
 
 	return result, nil
@@ -335,6 +408,7 @@ func GetAllAs[T any](coll *Coll, predicate func(i *T) bool) (result []*T, err er
 // GetFirstAsInterface function queries and gets the first match of the query. The query result can be found in the
 // holder argument. The function returns a boolean value indicating data is found or not.
 func (coll *Coll) GetFirstAsInterface(predicate QueryPredicateAsInterface, holder interface{}) (found bool, err error) {
+	codec := coll.codec()
 	chunks, err := coll.getChunks()
 	if err != nil {
 		return false, err // marks not found
@@ -345,7 +419,7 @@ func (coll *Coll) GetFirstAsInterface(predicate QueryPredicateAsInterface, holde
 		return false, nil // no data
 	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -359,22 +433,22 @@ func (coll *Coll) GetFirstAsInterface(predicate QueryPredicateAsInterface, holde
 		}
 	}()
 
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return false, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		dataMatched := false
 		for scn.Scan() {
 			line := scn.Bytes()
-			if len(line) == 0 {
+			if len(line) == 0 || coll.expiredLine(line, now) {
 				continue
 			}
-			err = json.Unmarshal(line, holder)
+			err = codec.Unmarshal(line, holder)
 			if err != nil {
 				// error on unmarshal operation
 				continue // skip this record
@@ -382,14 +456,18 @@ func (coll *Coll) GetFirstAsInterface(predicate QueryPredicateAsInterface, holde
 			el := holder
 			dataMatched = predicate(el) // evaluate predicate
 			if dataMatched {
-				found = true
+				err = coll.afterReadInto(line, holder)
+				found = err == nil
 				break
 			}
 		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if scanErr := scn.Err(); scanErr != nil {
+			return false, scanErr
+		}
 		if dataMatched {
-			return true, nil
+			return found, err
 		}
 	}
 
@@ -400,6 +478,7 @@ func (coll *Coll) GetFirstAsInterface(predicate QueryPredicateAsInterface, holde
 
 // GetAll function queries and gets all the matches of the query predicate.
 func (coll *Coll) GetAll(predicate QueryPredicate) (result []RecordInstance, err error) {
+	codec := coll.codec()
 
 	chunks, err := coll.getChunks()
 	if err != nil {
@@ -410,8 +489,11 @@ func (coll *Coll) GetAll(predicate QueryPredicate) (result []RecordInstance, err
 		// İçeride hiç veri yok
 		return nil, nil
 	}
+	if opts, parallel := coll.parallelScan(chunks); parallel {
+		return coll.getAllParallel(chunks, opts, predicate)
+	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -428,29 +510,41 @@ func (coll *Coll) GetAll(predicate QueryPredicate) (result []RecordInstance, err
 	result = make([]RecordInstance, 0)
 	dataMatched := false
 
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return nil, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		for scn.Scan() {
 			line := scn.Bytes()
 			if len(line) == 0 {
 				continue
 			}
 			var data RecordInstance
-			_ = json.Unmarshal(line, &data) // TODO: Handle error
+			_ = codec.Unmarshal(line, &data) // TODO: Handle error
+			if coll.expired(data, now) {
+				continue // çözülmüş kayıt üzerinden bakılır
+			}
 			dataMatched = predicate(data)
 			if dataMatched {
+				data, err = coll.afterRead(data)
+				if err != nil {
+					_ = f.Close()
+					f = nil
+					return nil, err
+				}
 				result = append(result, data)
 			}
 		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if scanErr := scn.Err(); scanErr != nil {
+			return nil, scanErr
+		}
 	}
 
 	return result, nil
@@ -458,6 +552,7 @@ func (coll *Coll) GetAll(predicate QueryPredicate) (result []RecordInstance, err
 
 // Count function returns the count of matched records with the predicate function
 func (coll *Coll) Count(predicate QueryPredicate) (n int, err error) {
+	codec := coll.codec()
 	n = 0
 	chunks, err := coll.getChunks()
 	if err != nil {
@@ -468,8 +563,11 @@ func (coll *Coll) Count(predicate QueryPredicate) (n int, err error) {
 		// İçeride hiç veri yok
 		return n, nil
 	}
+	if opts, parallel := coll.parallelScan(chunks); parallel {
+		return coll.countParallel(chunks, opts, predicate)
+	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -484,22 +582,25 @@ func (coll *Coll) Count(predicate QueryPredicate) (n int, err error) {
 	}()
 
 	dataMatched := false
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return 0, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		for scn.Scan() {
 			line := scn.Bytes()
 			if len(line) == 0 {
 				continue
 			}
 			var data RecordInstance
-			_ = json.Unmarshal(line, &data) // TODO: Handle error
+			_ = codec.Unmarshal(line, &data) // TODO: Handle error
+			if coll.expired(data, now) {
+				continue
+			}
 			dataMatched = predicate(data)
 			if dataMatched {
 				n++
@@ -507,6 +608,9 @@ func (coll *Coll) Count(predicate QueryPredicate) (n int, err error) {
 		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // cleanup
+		if scanErr := scn.Err(); scanErr != nil {
+			return 0, scanErr
+		}
 	}
 
 	return n, nil
@@ -516,6 +620,7 @@ func (coll *Coll) Count(predicate QueryPredicate) (n int, err error) {
 // number of record found or 0 if not. Data is sent into harvestCallback function. So you can harvest
 // the data. There is no generics in GO. So user must handle the type conversion.
 func (coll *Coll) GetAllAsInterface(predicate QueryPredicateAsInterface, harvestCallback QueryPredicateAsInterface, holder interface{}) (n int, err error) {
+	codec := coll.codec()
 
 	n = 0 // init
 	chunks, err := coll.getChunks()
@@ -528,7 +633,7 @@ func (coll *Coll) GetAllAsInterface(predicate QueryPredicateAsInterface, harvest
 		return n, nil
 	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -543,34 +648,42 @@ func (coll *Coll) GetAllAsInterface(predicate QueryPredicateAsInterface, harvest
 	}()
 
 	dataMatched := false
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return 0, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		for scn.Scan() {
 			line := scn.Bytes()
-			if len(line) == 0 {
+			if len(line) == 0 || coll.expiredLine(line, now) {
 				continue
 			}
 
-			err = json.Unmarshal(line, holder) // TODO: Handle error
+			err = codec.Unmarshal(line, holder) // TODO: Handle error
 			if err != nil {
 				// if an error occurs skip it
 				continue
 			}
 			dataMatched = predicate(holder)
 			if dataMatched {
+				if err = coll.afterReadInto(line, holder); err != nil {
+					_ = f.Close()
+					f = nil
+					return 0, err
+				}
 				harvestCallback(holder)
 				n++
 			}
 		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if scanErr := scn.Err(); scanErr != nil {
+			return 0, scanErr
+		}
 	}
 
 	return n, nil
@@ -579,6 +692,14 @@ func (coll *Coll) GetAllAsInterface(predicate QueryPredicateAsInterface, harvest
 // DeleteFirst function deletes the first match of the predicate and returns the count of deleted
 // records. n = 1 if a deletion occurred, n = 0 if none.
 func (coll *Coll) DeleteFirst(predicate QueryPredicate) (n int, err error) {
+	if err := coll.db.checkWritable("DeleteFirst"); err != nil {
+		return 0, err
+	}
+	codec := coll.codec()
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
 	chunks, err := coll.getChunks()
 	n = 0
 	if err != nil {
@@ -590,7 +711,7 @@ func (coll *Coll) DeleteFirst(predicate QueryPredicate) (n int, err error) {
 		return n, nil
 	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -604,27 +725,31 @@ func (coll *Coll) DeleteFirst(predicate QueryPredicate) (n int, err error) {
 	var data RecordInstance
 	var bufferStore = make([]byte, 2*1024*1024) // 2 mb buffer
 	buffer := bytes.NewBuffer(bufferStore)
+	tracking := coll.tracking(ChangeDelete)
+	now := time.Now() // süresi dolan kayıtlar silinmez, süpürücüye bırakılır
 
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return n, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		buffer.Reset()
 		dataMatched := false
 		anyMatchesOccured := false
+		var changes []recordChange
+		var vetoErr error
 
 		for scn.Scan() {
 			line := scn.Bytes()
 			if len(line) == 0 {
 				dataMatched = false
 			} else {
-				_ = json.Unmarshal(line, &data) // TODO: Handle error
-				dataMatched = predicate(data)
+				data = nil                       // önceki kaydın alanları karışmasın
+				_ = codec.Unmarshal(line, &data) // TODO: Handle error
+				dataMatched = !coll.expired(data, now) && predicate(data)
 			}
 			if !dataMatched {
 				// predicate sonucu olumsuz. Bu durumda orjinal data yerine yazılır.
@@ -635,38 +760,58 @@ func (coll *Coll) DeleteFirst(predicate QueryPredicate) (n int, err error) {
 				// ilk sonuç için yapılır.
 				// Satır numarası daha sonradan indexleme için kullanılacak!
 				if !anyMatchesOccured {
+					if _, vetoErr = coll.beforeWrite(BeforeDelete, line, nil); vetoErr != nil {
+						break // silme işlemi reddedildi
+					}
 					buffer.WriteString(recordSepStr)
+					if tracking {
+						changes = append(changes, recordChange{doc: append([]byte(nil), line...)})
+					}
 				}
 			}
 			anyMatchesOccured = anyMatchesOccured || dataMatched
 		}
+		if vetoErr == nil {
+			vetoErr = scn.Err() // Okunamayan bir chunk üzerine yazılmaz
+		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if vetoErr != nil {
+			return n, vetoErr
+		}
 		if anyMatchesOccured {
 			//dosyada düzeltme yapılmış demektir. Bu durumda buffer, işlem yapılan chunk üzerine yazılır.
-			f, err = os.Create(chunkPath) // Truncate file
-			if err != nil {
-				return n, err
-			}
-			//_, err := f.Write(bufferStore)
-			_, err = buffer.WriteTo(f)
+			err = coll.writeChunk(chunk.Name(), buffer.Bytes())
 			if err != nil {
 				// yazma hatası
 				return n, err
 			}
-			_ = f.Close()
-			f = nil
 			n++
+			err = coll.commit(ChangeDelete, changes)
 			break // Chunk loop kır.
 		}
 	} //end chunks
 
-	return n, nil
+	return n, err
 }
 
 // DeleteAll function deletes all the matches of the predicate and returns the count of deletions.
 // n = 0 if no deletions occurred.
 func (coll *Coll) DeleteAll(predicate QueryPredicate) (n int, err error) {
+	return coll.deleteAll("DeleteAll", predicate, false)
+}
+
+// deleteAll deletes the matches of the predicate. Expired records are hidden from the predicate
+// unless withExpired is set, which is only used for removing them. op names the caller in errors.
+func (coll *Coll) deleteAll(op string, predicate QueryPredicate, withExpired bool) (n int, err error) {
+	if err := coll.db.checkWritable(op); err != nil {
+		return 0, err
+	}
+	codec := coll.codec()
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
 	chunks, err := coll.getChunks()
 	n = 0
 	if err != nil {
@@ -678,70 +823,82 @@ func (coll *Coll) DeleteAll(predicate QueryPredicate) (n int, err error) {
 		return n, nil
 	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
 		if r := recover(); r != nil {
-			n = 0
 			err = errors.New(fmt.Sprintf("predicate error: %s", r.(error).Error()))
 			if f != nil { // dosya kapanmamışsa kapat
 				_ = f.Close()
 			}
 		}
 	}()
-	var data RecordInstance
 	var bufferStore = make([]byte, 2*1024*1024) // 2 mb buffer
 	buffer := bytes.NewBuffer(bufferStore)
+	tracking := coll.tracking(ChangeDelete)
+	now := time.Now()
 
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
-			return 0, err
+			return n, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		buffer.Reset()
 		dataMatched := false
 		anyMatchesOccured := false
+		deleted := 0 // bu chunk'ta silinen kayıtlar, chunk yazılınca n'e eklenir
+		var changes []recordChange
+		var vetoErr error
 		for scn.Scan() {
 			line := scn.Bytes()
 			if len(line) == 0 {
 				dataMatched = false
 			} else {
 				// Satır boş değil
-				_ = json.Unmarshal(line, &data) // TODO: Handle error
-				dataMatched = predicate(data)
+				var data RecordInstance          // önceki kaydın alanları karışmasın
+				_ = codec.Unmarshal(line, &data) // TODO: Handle error
+				dataMatched = (withExpired || !coll.expired(data, now)) && predicate(data)
 			}
 
 			if !dataMatched {
 				// predicate sonucu olumsuz. Bu durumda orjinal data yerine yazılır.
 				buffer.Write(line)
 			} else {
-				n++
+				if _, vetoErr = coll.beforeWrite(BeforeDelete, line, nil); vetoErr != nil {
+					break // silme işlemi reddedildi
+				}
+				deleted++
+				if tracking {
+					changes = append(changes, recordChange{doc: append([]byte(nil), line...)})
+				}
 			}
 			buffer.WriteString(recordSepStr)
 
 			anyMatchesOccured = anyMatchesOccured || dataMatched
 		}
+		if vetoErr == nil {
+			vetoErr = scn.Err() // Okunamayan bir chunk üzerine yazılmaz
+		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if vetoErr != nil {
+			return n, vetoErr // önceki chunk'lar yazılmış olabilir
+		}
 		if anyMatchesOccured {
 			//dosyada düzeltme yapılmış demektir. Bu durumda buffer, işlem yapılan chunk üzerine yazılır.
-			f, err = os.Create(chunkPath) // Truncate file
-			if err != nil {
-				return 0, err
-			}
-			//_, err := f.Write(bufferStore)
-			_, err = buffer.WriteTo(f)
+			err = coll.writeChunk(chunk.Name(), buffer.Bytes())
 			if err != nil {
 				// yazma hatası
-				return 0, err
+				return n, err
+			}
+			n += deleted
+			if err = coll.commit(ChangeDelete, changes); err != nil {
+				return n, err
 			}
-			_ = f.Close()
-			f = nil
 		}
 	} //end chunks
 
@@ -777,6 +934,14 @@ func (coll *Coll) UpdateAll(predicate QueryPredicate, updateFunction UpdateFunc)
 }
 
 func (coll *Coll) updater(pred QueryPredicate, uf UpdateFunc, updateAll bool) (n int, err error) {
+	if err := coll.db.checkWritable("Update"); err != nil {
+		return 0, err
+	}
+	codec := coll.codec()
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
 	chunks, err := coll.getChunks()
 	n = 0
 	if err != nil {
@@ -788,7 +953,7 @@ func (coll *Coll) updater(pred QueryPredicate, uf UpdateFunc, updateAll bool) (n
 		return n, nil
 	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -800,22 +965,24 @@ func (coll *Coll) updater(pred QueryPredicate, uf UpdateFunc, updateAll bool) (n
 		}
 	}()
 
-	var data RecordInstance
 	var bufferStore = make([]byte, 2*1024*1024) // 2 mb buffer
 	buffer := bytes.NewBuffer(bufferStore)
+	tracking := coll.tracking(ChangeUpdate)
+	now := time.Now() // süresi dolan kayıtlar değiştirilmez
 
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return n, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		buffer.Reset()
 		predicateMatched := false
 		anyMatchesOccured := false
+		var changes []recordChange
+		var vetoErr error
 
 		// chunk verisi taranır ve bütün kayıtlar mem buffer içine yazılır.
 		// Bu durumda kayıt değişikliği yerinde yapılır.
@@ -824,16 +991,25 @@ func (coll *Coll) updater(pred QueryPredicate, uf UpdateFunc, updateAll bool) (n
 			if len(line) == 0 {
 				predicateMatched = false
 			} else {
-				_ = json.Unmarshal(line, &data) // TODO: Handle error
-				predicateMatched = pred(data)
+				var data RecordInstance          // önceki kaydın alanları karışmasın
+				_ = codec.Unmarshal(line, &data) // TODO: Handle error
+				predicateMatched = !coll.expired(data, now) && pred(data)
 
 				if predicateMatched && (!anyMatchesOccured || updateAll) {
 					newData := uf(&data)
-					newDataBytes, err := json.Marshal(newData)
+					newDataBytes, err := codec.Marshal(newData)
 					if err != nil {
 						panic(fmt.Sprintf("updateFunction result cannot be marshalled: %s", err.Error()))
 					}
+					newDataBytes, vetoErr = coll.prepareWrite(BeforeUpdate, newDataBytes, line)
+					if vetoErr != nil {
+						break // güncelleme reddedildi veya şemaya uymuyor
+					}
 					buffer.Write(newDataBytes)
+					n++
+					if tracking {
+						changes = append(changes, recordChange{doc: newDataBytes, prev: append([]byte(nil), line...)})
+					}
 				} else {
 					buffer.Write(line)
 				}
@@ -842,32 +1018,41 @@ func (coll *Coll) updater(pred QueryPredicate, uf UpdateFunc, updateAll bool) (n
 			buffer.WriteString(recordSepStr)
 			anyMatchesOccured = anyMatchesOccured || predicateMatched
 		}
+		if vetoErr == nil {
+			vetoErr = scn.Err() // Okunamayan bir chunk üzerine yazılmaz
+		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if vetoErr != nil {
+			return n, vetoErr
+		}
 		if anyMatchesOccured {
 			// Kayıt bir dosyada bulunmuş ve silinmiş demektir.
 			// Bu durumda buffer, işlem yapılan chunk üzerine yazılır.
-			f, err = os.Create(chunkPath) // Truncate file
-			if err != nil {
-				return n, err
-			}
-			//_, err := f.Write(bufferStore)
-			_, err = buffer.WriteTo(f)
+			err = coll.writeChunk(chunk.Name(), buffer.Bytes())
 			if err != nil {
 				// yazma hatası
 				return n, err
 			}
-			_ = f.Close()
-			n++ // bu aşamada veri commit olmuş, değişiklik gerçekleşmiştir.
-			f = nil
-			break // Chunk loop kır.
+			// bu aşamada veri commit olmuş, değişiklik gerçekleşmiştir.
+			if err = coll.commit(ChangeUpdate, changes); err != nil || !updateAll {
+				break // Chunk loop kır.
+			}
 		}
 	} //end chunks
 
-	return n, nil
+	return n, err
 }
 
 func (coll *Coll) replacer(pred QueryPredicate, nData interface{}, replaceAll bool) (n int, err error) {
+	if err := coll.db.checkWritable("Replace"); err != nil {
+		return 0, err
+	}
+	codec := coll.codec()
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
 	chunks, err := coll.getChunks()
 	n = 0
 	if err != nil {
@@ -880,13 +1065,13 @@ func (coll *Coll) replacer(pred QueryPredicate, nData interface{}, replaceAll bo
 	}
 
 	// Yeni kayıt kontrol edilir
-	newDataBytes, err := json.Marshal(nData)
+	newDataBytes, err := codec.Marshal(nData)
 	if err != nil {
 		// Yeni kayıt dönüştürülemiyor demektir.
 		return n, err
 	}
 
-	var f *os.File
+	var f io.ReadCloser
 	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
 	// Hata olursa isimli return value'ları buna göre düzenleriz.
 	defer func() {
@@ -898,22 +1083,24 @@ func (coll *Coll) replacer(pred QueryPredicate, nData interface{}, replaceAll bo
 		}
 	}()
 
-	var data RecordInstance
 	var bufferStore = make([]byte, 2*1024*1024) // 2 mb buffer
 	buffer := bytes.NewBuffer(bufferStore)
+	tracking := coll.tracking(ChangeReplace)
+	now := time.Now() // süresi dolan kayıtlar değiştirilmez
 
 	for _, chunk := range chunks {
 		// Veri aranır. Bunun için bütün chunklara bakılır
-		chunkPath := filepath.Join(coll.dbpath, chunk.Name())
-		f, err = os.Open(chunkPath)
+		f, err = coll.openChunk(chunk.Name())
 		if err != nil {
 			return n, err
 		}
 
-		scn := bufio.NewScanner(f)
+		scn := newRecordScanner(f)
 		buffer.Reset()
 		predicateMatched := false
 		anyMatchesOccured := false
+		var changes []recordChange
+		var vetoErr error
 
 		// chunk verisi taranır ve bütün kayıtlar mem buffer içine yazılır.
 		// Bu durumda kayıt değişikliği yerinde yapılır.
@@ -922,13 +1109,23 @@ func (coll *Coll) replacer(pred QueryPredicate, nData interface{}, replaceAll bo
 			if len(line) == 0 {
 				predicateMatched = false
 			} else {
-				_ = json.Unmarshal(line, &data) // TODO: Handle error
-				predicateMatched = pred(data)
+				var data RecordInstance          // önceki kaydın alanları karışmasın
+				_ = codec.Unmarshal(line, &data) // TODO: Handle error
+				predicateMatched = !coll.expired(data, now) && pred(data)
 
 				if predicateMatched && (!anyMatchesOccured || replaceAll) {
 					// Eğer daha önce bir değişiklik olmamışsa ve predicate eşleme yaptıysa
 					// yani ilk defa bir eşleme gerçekleşiyorsa...
-					buffer.Write(newDataBytes)
+					var replacement []byte
+					replacement, vetoErr = coll.prepareWrite(BeforeReplace, newDataBytes, line)
+					if vetoErr != nil {
+						break // değişiklik reddedildi veya şemaya uymuyor
+					}
+					buffer.Write(replacement)
+					n++
+					if tracking {
+						changes = append(changes, recordChange{doc: replacement, prev: append([]byte(nil), line...)})
+					}
 				} else {
 					buffer.Write(line)
 				}
@@ -937,49 +1134,62 @@ func (coll *Coll) replacer(pred QueryPredicate, nData interface{}, replaceAll bo
 			buffer.WriteString(recordSepStr)
 			anyMatchesOccured = anyMatchesOccured || predicateMatched
 		}
+		if vetoErr == nil {
+			vetoErr = scn.Err() // Okunamayan bir chunk üzerine yazılmaz
+		}
 		_ = f.Close() // TODO: Handle error
 		f = nil       // temizle
+		if vetoErr != nil {
+			return n, vetoErr
+		}
 		if anyMatchesOccured {
 			// Kayıt bir dosyada bulunmuş ve silinmiş demektir.
 			// Bu durumda buffer, işlem yapılan chunk üzerine yazılır.
-			f, err = os.Create(chunkPath) // Truncate file
-			if err != nil {
-				return n, err
-			}
-			//_, err := f.Write(bufferStore)
-			_, err = buffer.WriteTo(f)
+			err = coll.writeChunk(chunk.Name(), buffer.Bytes())
 			if err != nil {
 				// yazma hatası
 				return n, err
 			}
-			_ = f.Close()
-			n++ // bu aşamada veri commit olmuş, değişiklik gerçekleşmiştir.
-			f = nil
-			break // Chunk loop kır.
+			// bu aşamada veri commit olmuş, değişiklik gerçekleşmiştir.
+			if err = coll.commit(ChangeReplace, changes); err != nil || !replaceAll {
+				break // Chunk loop kır.
+			}
 		}
 	} //end chunks
 
-	return n, nil
+	return n, err
+}
+
+// newRecordScanner returns a scanner reading the record lines of r. Every scan of the records uses
+// it, so readers accept the same record sizes.
+func newRecordScanner(r io.Reader) *bufio.Scanner {
+	scn := bufio.NewScanner(r)
+	scn.Buffer(make([]byte, 64*1024), maxRecordSize)
+	return scn
 }
 
 // createChunk Creates a new chunk for storing data
 func (coll *Coll) createChunk() (*fs.FileInfo, error) {
-	lastChunk, _ := coll.getLastChunk()
+	lastChunk, err := coll.getLastChunk()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("collection does not exist: %s", err.Error()))
+	}
 	if lastChunk == nil {
 		// Diskte başka chunk yok
-		chunkPath := filepath.Join(coll.dbpath, firstChunkName)
-		f, err := os.Create(chunkPath)
+		err = coll.db.storage.Append(coll.GetName(), firstChunkName, nil)
+		coll.db.cache.invalidate(coll.GetName(), firstChunkName)
 		if err != nil {
 			// Dosya oluşturmada hata
 			return nil, err
 		}
-		fstat, _ := f.Stat()
-		defer f.Close()
+		coll.chunkAppended(firstChunkName, 0, 0)
+		var fstat fs.FileInfo = fileInfo{name: firstChunkName}
 		return &fstat, nil
 	}
 
 	// lastChunk var. Bu durumda dosya boyutu kontrol edilir. Eğer maxChunkSize'dan büyükse yeni bir chunk yapılır.
-	if (*lastChunk).Size() > maxChunkSize {
+	// Sınırlı (capped) kolleksiyonlarda chunk sınırları daha küçüktür.
+	if coll.chunkFull(*lastChunk) {
 		// yeni bir chunk yap
 		chunkNrStr := strings.Split((*lastChunk).Name(), ".")[0]
 		chunkNr, err := strconv.ParseUint(chunkNrStr, 16, 32)
@@ -990,13 +1200,20 @@ func (coll *Coll) createChunk() (*fs.FileInfo, error) {
 		//yeni chunk yap
 		chunkNr += 1
 		newChunkName := fmt.Sprintf("%02x.json", chunkNr)
-		chunkPath := filepath.Join(coll.dbpath, newChunkName)
-		f, err := os.Create(chunkPath)
+		err = coll.db.storage.Append(coll.GetName(), newChunkName, nil)
+		coll.db.cache.invalidate(coll.GetName(), newChunkName)
 		if err != nil {
 			return nil, errors.New(fmt.Sprintf("cannot create chunk: %s", err.Error()))
 		}
-		fstat, _ := f.Stat()
-		defer f.Close()
+		coll.chunkAppended(newChunkName, 0, 0)
+		var fstat fs.FileInfo = fileInfo{name: newChunkName}
+
+		// Önceki chunk mühürlendi. Ayarlanmışsa sıkıştırılır.
+		if coll.GetCompression() != nil {
+			if err = coll.sealChunk((*lastChunk).Name()); err != nil {
+				return nil, err
+			}
+		}
 		lastChunk = &fstat
 	}
 
@@ -1004,47 +1221,66 @@ func (coll *Coll) createChunk() (*fs.FileInfo, error) {
 	return lastChunk, nil
 }
 
-// getChunks checks disk storage and returns the chunk files if any.
+// getChunks checks the storage and returns the chunk files if any. Chunks are sorted by their
+// numbers, so the oldest chunk is the first.
 func (coll *Coll) getChunks() ([]fs.FileInfo, error) {
-	fileElements, err := ioutil.ReadDir(coll.dbpath)
+	fileElements, err := coll.db.storage.List(coll.GetName())
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("cannot read chunks: %s", err.Error()))
 	}
-
-	// Dosya adları kontrol edilir.
-	reFileName, _ := regexp.Compile("^[\\da-fA-F]{2}\\.json$")
+	// Sıkıştırılmış chunk'lar .json.gz uzantılıdır.
+	reFileName, _ := regexp.Compile("^[\\da-fA-F]{2,8}\\.json(\\.gz)?$")
 	resultArray := make([]fs.FileInfo, len(fileElements))
+	plainNames := make(map[string]bool)
 	idx := 0
 	for _, finfo := range fileElements {
 		if !finfo.IsDir() {
 			if reFileName.MatchString(finfo.Name()) {
 				resultArray[idx] = finfo
 				idx += 1
+				if !isCompressedChunk(finfo.Name()) {
+					plainNames[finfo.Name()] = true
+				}
 			}
 		}
 	}
 
-	return resultArray[:idx], nil
+	// Sıkıştırma yarıda kalmışsa düz chunk geçerlidir, sıkıştırılmış kopya yok sayılır.
+	n := 0
+	for _, finfo := range resultArray[:idx] {
+		if isCompressedChunk(finfo.Name()) && plainNames[strings.TrimSuffix(finfo.Name(), compressedChunkExt)] {
+			continue
+		}
+		resultArray[n] = finfo
+		n++
+	}
+	idx = n
+
+	// ReadDir isme göre sıralar. ff.json'dan sonra 100.json gelir, bu yüzden numaraya göre sıralanır.
+	resultArray = resultArray[:idx]
+	sort.Slice(resultArray, func(i, j int) bool {
+		return chunkNumber(resultArray[i].Name()) < chunkNumber(resultArray[j].Name())
+	})
+
+	return resultArray, nil
 }
 
 // getLastChunk returns a chunk to store data if there are any.
 func (coll *Coll) getLastChunk() (*fs.FileInfo, error) {
-	chunks, err := ioutil.ReadDir(coll.dbpath)
+	chunks, err := coll.getChunks()
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("cannot read chunks: %s", err.Error()))
+		return nil, err
 	}
 
-	var lastChunk *fs.FileInfo = nil
-	reFileName, _ := regexp.Compile("^[\\da-fA-F]{2}\\.json$")
-
-	for _, finfo := range chunks {
-		if !finfo.IsDir() {
-			//aradığımız dosya
-			if reFileName.MatchString(finfo.Name()) {
-				lastChunk = &finfo
-			}
-		}
+	if len(chunks) == 0 {
+		return nil, nil
 	}
 
-	return lastChunk, nil
+	return &chunks[len(chunks)-1], nil
+}
+
+// chunkNumber returns the number of the chunk from its file name
+func chunkNumber(name string) uint64 {
+	chunkNr, _ := strconv.ParseUint(strings.Split(name, ".")[0], 16, 32)
+	return chunkNr
 }
@@ -0,0 +1,234 @@
+package arnedb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const compressedChunkExt = ".gz"
+
+// CompressionOptions describes the compression of the sealed chunks of a collection.
+type CompressionOptions struct {
+	// Level is a compress/gzip level like gzip.BestSpeed or gzip.BestCompression.
+	Level int `json:"level"`
+}
+
+// WithCompression option stores the sealed chunks of the collection compressed with gzip at the given
+// level. A chunk is sealed when a new chunk is created after it. The last chunk always stays plain, so
+// appending data stays cheap. Queries decompress the chunks transparently.
+func WithCompression(level int) CollOption {
+	return func(coll *Coll) error {
+		if err := checkCompressionLevel(level); err != nil {
+			return err
+		}
+		coll.meta.Compression = &CompressionOptions{Level: level}
+		return nil
+	}
+}
+
+// SetCompression enables the compression of the sealed chunks of an existing collection. Already
+// sealed chunks are compressed immediately. Passing gzip.NoCompression disables compression for new
+// chunks; the compressed ones stay compressed and remain readable.
+func (coll *Coll) SetCompression(level int) error {
+	if err := coll.db.checkWritable("SetCompression"); err != nil {
+		return err
+	}
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	var opts *CompressionOptions
+	if level != gzip.NoCompression {
+		if err := checkCompressionLevel(level); err != nil {
+			return err
+		}
+		opts = &CompressionOptions{Level: level}
+	}
+
+	coll.metaMu.Lock()
+	old := coll.meta.Compression
+	coll.meta.Compression = opts
+	if err := coll.saveMeta(); err != nil {
+		coll.meta.Compression = old
+		coll.metaMu.Unlock()
+		return err
+	}
+	coll.metaMu.Unlock()
+
+	if opts == nil {
+		return nil
+	}
+
+	// Daha önce mühürlenmiş chunk'lar sıkıştırılır. Son chunk düz kalır.
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(chunks)-1; i++ {
+		if err = coll.sealChunk(chunks[i].Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCompression returns the compression settings of the collection or nil if chunks are not
+// compressed.
+func (coll *Coll) GetCompression() *CompressionOptions {
+	coll.metaMu.RLock()
+	defer coll.metaMu.RUnlock()
+	return coll.meta.Compression
+}
+
+func checkCompressionLevel(level int) error {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression || level == gzip.NoCompression {
+		return errors.New(fmt.Sprintf("invalid compression level: %d", level))
+	}
+	return nil
+}
+
+// isCompressedChunk checks whether the chunk file is compressed by its name
+func isCompressedChunk(name string) bool {
+	return strings.HasSuffix(name, compressedChunkExt)
+}
+
+// compressedChunkReader decompresses a chunk file and closes both the decompressor and the file
+type compressedChunkReader struct {
+	*gzip.Reader
+	f io.Closer
+}
+
+func (r *compressedChunkReader) Close() error {
+	_ = r.Reader.Close()
+	return r.f.Close()
+}
+
+// openChunk opens a chunk for reading. Compressed chunks are decompressed and encrypted records are
+// decrypted while reading. The chunk is read from the cache if it is enabled.
+func (coll *Coll) openChunk(name string) (io.ReadCloser, error) {
+	if coll.db.cache != nil {
+		return coll.openCachedChunk(name)
+	}
+	return coll.openChunkStorage(name)
+}
+
+// openChunkStorage opens the chunk in the storage bypassing the cache
+func (coll *Coll) openChunkStorage(name string) (io.ReadCloser, error) {
+	f, aead, err := coll.db.openFile(coll.GetName(), name)
+	if err != nil {
+		return nil, err
+	}
+	if !isCompressedChunk(name) {
+		return decryptReader(f, aead), nil
+	}
+
+	// Şifreli chunk'lar sıkıştırıldıktan sonra tek blok olarak şifrelenir
+	br := bufio.NewReader(f)
+	var src io.Reader = br
+	if magic, _ := br.Peek(len(sealedBlockMagic)); string(magic) == sealedBlockMagic {
+		sealed, err := io.ReadAll(br)
+		var compressed []byte
+		if err == nil {
+			compressed, err = openBlock(aead, sealed)
+		}
+		if err != nil {
+			_ = f.Close()
+			return nil, errors.New(fmt.Sprintf("cannot decrypt chunk %s: %s", name, err.Error()))
+		}
+		src = bytes.NewReader(compressed)
+	}
+
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.New(fmt.Sprintf("cannot decompress chunk %s: %s", name, err.Error()))
+	}
+	return &compressedChunkReader{Reader: zr, f: f}, nil
+}
+
+// readChunk returns the whole content of a chunk
+func (coll *Coll) readChunk(name string) ([]byte, error) {
+	r, err := coll.openChunk(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// writeChunk replaces the content of a chunk atomically. Compressed chunks stay compressed.
+func (coll *Coll) writeChunk(name string, content []byte) error {
+	encoded, err := coll.encodeChunk(name, content, coll.db.cipher())
+	if err != nil {
+		return err
+	}
+	err = coll.db.storage.Replace(coll.GetName(), name, encoded)
+	coll.db.cache.invalidate(coll.GetName(), name)
+	if err != nil {
+		return err
+	}
+	coll.chunkWritten(name, content, len(encoded))
+	return nil
+}
+
+// encodeChunk encrypts and compresses the content of the named chunk as needed. Compressed chunks
+// are compressed first and then encrypted as a single block, plain chunks are encrypted record by
+// record so records can be appended.
+func (coll *Coll) encodeChunk(name string, content []byte, aead cipher.AEAD) ([]byte, error) {
+	if !isCompressedChunk(name) {
+		return sealLines(aead, content)
+	}
+
+	level := gzip.DefaultCompression
+	if opts := coll.GetCompression(); opts != nil {
+		level = opts.Level
+	}
+	content, err := gzipBytes(content, level)
+	if err != nil {
+		return nil, err
+	}
+	return sealBlock(aead, content)
+}
+
+// sealChunk compresses a plain chunk and removes the plain one
+func (coll *Coll) sealChunk(name string) error {
+	if isCompressedChunk(name) {
+		return nil
+	}
+
+	content, err := coll.readChunk(name)
+	if err != nil {
+		return err
+	}
+	if err = coll.writeChunk(name+compressedChunkExt, content); err != nil {
+		return errors.New(fmt.Sprintf("cannot compress chunk %s: %s", name, err.Error()))
+	}
+	err = coll.db.storage.Remove(coll.GetName(), name)
+	coll.db.cache.invalidate(coll.GetName(), name)
+	if err != nil {
+		return err
+	}
+	coll.chunkRemoved(name)
+	return nil
+}
+
+func gzipBytes(content []byte, level int) ([]byte, error) {
+	var buffer bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buffer, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,102 @@
+package arnedb
+
+import (
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	_ = os.RemoveAll("testdb/compressdb")
+
+	pDb, err := Open("testdb", "compressdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+
+	if _, err = pDb.CreateColl("bad", WithCompression(42)); err == nil {
+		t.Error("WithCompression accepted an invalid level")
+	}
+
+	logs, err := pDb.CreateColl("logs", WithCompression(gzip.BestSpeed))
+	if err != nil {
+		t.Fatal("Create logs failed with:", err)
+	}
+
+	// İki chunk oluşacak kadar veri eklenir
+	text := strings.Repeat("arnedb ", 100)
+	for i := 0; i < 2000; i++ {
+		if err = logs.Add(RecordInstance{"seq": i, "text": text}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+
+	chunks, err := logs.getChunks()
+	if err != nil {
+		t.Fatal("getChunks failed with:", err)
+	}
+	if len(chunks) != 2 || chunks[0].Name() != firstChunkName+compressedChunkExt || chunks[1].Name() != "01.json" {
+		t.Fatalf("Unexpected chunks: %v", chunks)
+	}
+	if chunks[0].Size() > maxChunkSize/10 {
+		t.Errorf("Sealed chunk is not compressed: %d bytes", chunks[0].Size())
+	}
+
+	all := func(RecordInstance) bool { return true }
+	n, err := logs.Count(all)
+	if err != nil || n != 2000 {
+		t.Fatalf("Count returned %d, %v", n, err)
+	}
+
+	n, err = logs.DeleteAll(func(i RecordInstance) bool { return int(i["seq"].(float64))%2 == 0 })
+	if err != nil || n != 1000 {
+		t.Fatalf("DeleteAll returned %d, %v", n, err)
+	}
+	_, err = logs.UpdateFirst(func(i RecordInstance) bool { return i["seq"].(float64) == 1 },
+		func(ptrRecord *RecordInstance) *RecordInstance {
+			(*ptrRecord)["text"] = "short"
+			return ptrRecord
+		})
+	if err != nil {
+		t.Fatal("UpdateFirst failed with:", err)
+	}
+
+	first, err := logs.GetFirst(all)
+	if err != nil || first["seq"].(float64) != 1 || first["text"] != "short" {
+		t.Fatalf("GetFirst returned %v, %v", first, err)
+	}
+	if _, err = os.Stat("testdb/compressdb/logs/00.json.gz"); err != nil {
+		t.Error("Rewritten chunk is not compressed:", err)
+	}
+
+	// Mevcut bir kolleksiyonda sıkıştırma açılır
+	plain, err := pDb.CreateColl("plain")
+	if err != nil {
+		t.Fatal("Create plain failed with:", err)
+	}
+	for i := 0; i < 2000; i++ {
+		if err = plain.Add(RecordInstance{"seq": i, "text": text}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	if err = plain.SetCompression(gzip.DefaultCompression); err != nil {
+		t.Fatal("SetCompression failed with:", err)
+	}
+	if _, err = os.Stat("testdb/compressdb/plain/00.json.gz"); err != nil {
+		t.Error("Sealed chunk is not compressed by SetCompression:", err)
+	}
+
+	pDb, err = Open("testdb", "compressdb")
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	plain = pDb.GetColl("plain")
+	if plain.GetCompression() == nil {
+		t.Error("Compression is not loaded on Open")
+	}
+	n, err = plain.Count(all)
+	if err != nil || n != 2000 {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+}
@@ -0,0 +1,451 @@
+package arnedb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// keyCheckName is the file used to verify the encryption key. It holds a known text encrypted with
+// the key.
+const keyCheckName = "keycheck"
+const keyCheckText = "arnedb"
+
+// rotateExt is the extension of the files written while rotating the encryption key. The key check
+// of the new key is written with this extension last. Once it exists the rotation is committed, and
+// an interrupted rotation is finished by the next RotateKey or Open.
+const rotateExt = ".rotate"
+
+// ErrWrongKey is returned by Open when the database is encrypted with another key.
+var ErrWrongKey = errors.New("wrong encryption key")
+
+// ErrKeyRequired is returned by Open when the database is encrypted but no key is given.
+var ErrKeyRequired = errors.New("database is encrypted, an encryption key is required")
+
+// WithEncryptionKey option encrypts the records with AES-GCM using the given key. The key must be 16,
+// 24 or 32 bytes long to select AES-128, AES-192 or AES-256. Every record is encrypted on its own, so
+// adding data stays an append. Sealed chunks of compressed collections are compressed first and
+// encrypted as a whole. Opening an existing plain database with a key encrypts only the new records;
+// RotateKey encrypts the old ones. The change log is encrypted too.
+func WithEncryptionKey(key []byte) Option {
+	return func(db *ArneDB) error {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return err
+		}
+		db.cryptMu.Lock()
+		db.aead = aead
+		db.cryptMu.Unlock()
+		return nil
+	}
+}
+
+// RotateKey re-encrypts all the records and the change log with the new key. A nil key decrypts the
+// database. Writes are blocked during the rotation. The records are re-encrypted into temporary files
+// first, so a failure while writing them leaves the database untouched. If a temporary file cannot
+// be put in place afterwards, the rotation is finished by calling RotateKey again or by opening the
+// database with the new key.
+func (db *ArneDB) RotateKey(newKey []byte) error {
+	if err := db.checkWritable("RotateKey"); err != nil {
+		return err
+	}
+
+	var newAead cipher.AEAD
+	if newKey != nil {
+		var err error
+		if newAead, err = newAEAD(newKey); err != nil {
+			return err
+		}
+	}
+
+	// Bütün yazma işlemleri durdurulur
+	colls, unlock := db.lockColls()
+	defer unlock()
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	// Yarıda kalmış bir değişim önce tamamlanır
+	if err := db.finishRotationLocked(); err != nil {
+		return err
+	}
+
+	// 1. Aşama: Yeni anahtarla geçici dosyalar yazılır
+	type rotatedFile struct{ coll, name string }
+	var rotated []rotatedFile
+	cleanup := func() {
+		for _, r := range rotated {
+			_ = db.storage.Remove(r.coll, r.name+rotateExt)
+		}
+	}
+	for _, c := range colls {
+		chunks, err := c.getChunks()
+		if err != nil {
+			cleanup()
+			return err
+		}
+		for _, chunk := range chunks {
+			content, err := c.readChunk(chunk.Name())
+			if err == nil {
+				content, err = c.encodeChunk(chunk.Name(), content, newAead)
+			}
+			if err == nil {
+				err = db.storage.Replace(c.Name, chunk.Name()+rotateExt, content)
+			}
+			if err != nil {
+				cleanup()
+				return errors.New(fmt.Sprintf("cannot rotate chunk %s of %s: %s", chunk.Name(), c.Name, err.Error()))
+			}
+			rotated = append(rotated, rotatedFile{coll: c.Name, name: chunk.Name()})
+		}
+	}
+
+	if f, aead, err := db.openFile("", changeLogName); err == nil {
+		content, err := io.ReadAll(decryptReader(f, aead))
+		_ = f.Close()
+		if err == nil {
+			content, err = sealLines(newAead, content)
+		}
+		if err == nil {
+			err = db.storage.Replace("", changeLogName+rotateExt, content)
+		}
+		if err != nil {
+			cleanup()
+			return errors.New(fmt.Sprintf("cannot rotate change log: %s", err.Error()))
+		}
+		rotated = append(rotated, rotatedFile{name: changeLogName})
+	}
+
+	// 2. Aşama: Yeni anahtarın kontrol dosyası yazılır. Bundan sonra değişim geri alınmaz.
+	var keyCheck []byte
+	if newAead != nil {
+		var err error
+		if keyCheck, err = sealLine(newAead, []byte(keyCheckText)); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	if err := db.storage.Replace("", keyCheckName+rotateExt, keyCheck); err != nil {
+		cleanup()
+		return errors.New(fmt.Sprintf("cannot write key check: %s", err.Error()))
+	}
+
+	// 3. Aşama: Anahtar ve dosyalar birlikte değiştirilir. Okuyucular dosyayı açarken cryptMu
+	// alır, bu yüzden eski dosyayı yeni anahtarla okuyamazlar.
+	defer db.cache.reset()
+	for _, c := range colls {
+		c.stats = nil // chunk boyutları değişir, istatistikler yeniden yüklenir
+	}
+	db.cryptMu.Lock()
+	defer db.cryptMu.Unlock()
+	db.aead = newAead
+	return db.finishRotation()
+}
+
+// finishRotationLocked finishes an interrupted rotation while holding cryptMu
+func (db *ArneDB) finishRotationLocked() error {
+	db.cryptMu.Lock()
+	defer db.cryptMu.Unlock()
+	return db.finishRotation()
+}
+
+// finishRotation puts the rotated files in place if the rotation is committed, otherwise it removes
+// the files left by a failed rotation. db.cryptMu must be held for writing.
+func (db *ArneDB) finishRotation() error {
+	keyCheck, err := readStorageFile(db.storage, "", keyCheckName+rotateExt)
+	committed := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.New(fmt.Sprintf("cannot read key check: %s", err.Error()))
+	}
+
+	collNames, err := db.storage.ListColls()
+	if err != nil {
+		return errors.New("cannot read db collections")
+	}
+	for _, collName := range append([]string{""}, collNames...) {
+		files, err := db.storage.List(collName)
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot finish key rotation: %s", err.Error()))
+		}
+		for _, f := range files {
+			name := f.Name()
+			if !strings.HasSuffix(name, rotateExt) || (collName == "" && name == keyCheckName+rotateExt) {
+				continue
+			}
+			if committed {
+				err = db.storage.Rename(collName, name, strings.TrimSuffix(name, rotateExt))
+			} else {
+				err = db.storage.Remove(collName, name)
+			}
+			if err != nil {
+				return errors.New(fmt.Sprintf("cannot finish key rotation: %s", err.Error()))
+			}
+		}
+	}
+	if !committed {
+		return nil
+	}
+
+	// Kontrol dosyası en son değiştirilir. Boşsa veritabanı artık şifresizdir.
+	if len(keyCheck) == 0 {
+		if err = db.writeKeyCheck(nil); err == nil {
+			err = db.storage.Remove("", keyCheckName+rotateExt)
+		}
+	} else {
+		err = db.storage.Rename("", keyCheckName+rotateExt, keyCheckName)
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot finish key rotation: %s", err.Error()))
+	}
+	return nil
+}
+
+// recoverRotation finishes or cleans up a key rotation interrupted in an earlier run. It is called
+// by Open before the key is checked. A read-only database cannot finish a committed rotation.
+func (db *ArneDB) recoverRotation() error {
+	if db.readOnly {
+		_, err := readStorageFile(db.storage, "", keyCheckName+rotateExt)
+		if err == nil {
+			return errors.New("key rotation is not finished, open the database writable first")
+		}
+		return nil
+	}
+	return db.finishRotationLocked()
+}
+
+// newAEAD creates the AES-GCM cipher of the key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid encryption key: %s", err.Error()))
+	}
+	return cipher.NewGCM(block)
+}
+
+// cipher returns the cipher of the database or nil if the database is not encrypted
+func (db *ArneDB) cipher() cipher.AEAD {
+	db.cryptMu.RLock()
+	defer db.cryptMu.RUnlock()
+	return db.aead
+}
+
+// openFile opens a file of the storage and returns the cipher its records are encrypted with.
+// RotateKey replaces the files and the key while holding cryptMu, so they always match.
+func (db *ArneDB) openFile(coll, name string) (io.ReadCloser, cipher.AEAD, error) {
+	db.cryptMu.RLock()
+	defer db.cryptMu.RUnlock()
+
+	f, err := db.storage.Open(coll, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, db.aead, nil
+}
+
+// checkKey verifies the key of the database. The key check file is created when an unencrypted
+// database is opened with a key.
+func (db *ArneDB) checkKey() error {
+	aead := db.cipher()
+	content, err := readStorageFile(db.storage, "", keyCheckName)
+	if errors.Is(err, fs.ErrNotExist) {
+		if aead == nil || db.readOnly {
+			return nil // Şifresiz veritabanı
+		}
+		return db.writeKeyCheck(aead)
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot read key check: %s", err.Error()))
+	}
+
+	if aead == nil {
+		return ErrKeyRequired
+	}
+	text, err := openLine(aead, bytes.TrimSpace(content))
+	if err != nil || string(text) != keyCheckText {
+		return ErrWrongKey
+	}
+	return nil
+}
+
+// writeKeyCheck writes the key check file of the key. A nil cipher removes the file.
+func (db *ArneDB) writeKeyCheck(aead cipher.AEAD) error {
+	if aead == nil {
+		err := db.storage.Remove("", keyCheckName)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	content, err := sealLine(aead, []byte(keyCheckText))
+	if err != nil {
+		return err
+	}
+	if err = db.storage.Replace("", keyCheckName, content); err != nil {
+		return errors.New(fmt.Sprintf("cannot write key check: %s", err.Error()))
+	}
+	return nil
+}
+
+// sealedLineMarker starts every encrypted record. Codecs never produce it: JSON does not start with a
+// control character and MsgPackCodec only writes 0x1b before 0x01, 0x02 or 0x03.
+const sealedLineMarker = "\x1bE"
+
+// sealLine encrypts a single record. The result is the marker followed by the base64 encoded nonce
+// and cipher text, so it never contains a record separator.
+func sealLine(aead cipher.AEAD, line []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(line)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot create nonce: %s", err.Error()))
+	}
+	sealed := aead.Seal(nonce, nonce, line, nil)
+
+	result := make([]byte, len(sealedLineMarker)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(result, sealedLineMarker)
+	base64.StdEncoding.Encode(result[len(sealedLineMarker):], sealed)
+	return result, nil
+}
+
+// openLine decrypts a single record. Plain records are returned as they are, so a database can hold
+// both until the key is rotated. Encrypted records start with sealedLineMarker.
+func openLine(aead cipher.AEAD, line []byte) ([]byte, error) {
+	if !bytes.HasPrefix(line, []byte(sealedLineMarker)) {
+		return line, nil
+	}
+	if aead == nil {
+		return nil, errors.New("cannot decrypt record: " + ErrKeyRequired.Error())
+	}
+	line = line[len(sealedLineMarker):]
+
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, line)
+	if err != nil || n < aead.NonceSize() {
+		return nil, errors.New("cannot decrypt record: invalid record")
+	}
+	sealed = sealed[:n]
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt record: wrong key or corrupted data")
+	}
+	return plain, nil
+}
+
+// sealLines encrypts every record in the content. Blank lines of the deleted records stay blank.
+func sealLines(aead cipher.AEAD, content []byte) ([]byte, error) {
+	if aead == nil {
+		return content, nil
+	}
+
+	lines := bytes.Split(content, []byte(recordSepStr))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		sealed, err := sealLine(aead, line)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = sealed
+	}
+	return bytes.Join(lines, []byte(recordSepStr)), nil
+}
+
+// sealedBlockMagic starts the compressed chunks which are encrypted as a whole. Plain compressed
+// chunks start with the gzip header instead.
+const sealedBlockMagic = "arnedb-gcm\n"
+
+// sealBlock encrypts the content as a single block. A nil cipher returns the content as it is.
+func sealBlock(aead cipher.AEAD, content []byte) ([]byte, error) {
+	if aead == nil {
+		return content, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot create nonce: %s", err.Error()))
+	}
+	result := make([]byte, 0, len(sealedBlockMagic)+len(nonce)+len(content)+aead.Overhead())
+	result = append(result, sealedBlockMagic...)
+	result = append(result, nonce...)
+	return aead.Seal(result, nonce, content, nil), nil
+}
+
+// openBlock decrypts a block encrypted by sealBlock
+func openBlock(aead cipher.AEAD, block []byte) ([]byte, error) {
+	if aead == nil {
+		return nil, ErrKeyRequired
+	}
+	block = block[len(sealedBlockMagic):]
+	if len(block) < aead.NonceSize() {
+		return nil, errors.New("invalid block")
+	}
+
+	plain, err := aead.Open(nil, block[:aead.NonceSize()], block[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("wrong key or corrupted data")
+	}
+	return plain, nil
+}
+
+// decryptReader returns a reader which decrypts the records read from r. Closing it closes r.
+func decryptReader(r io.ReadCloser, aead cipher.AEAD) io.ReadCloser {
+	if aead == nil {
+		return r
+	}
+	return &decryptingReader{src: r, br: bufio.NewReader(r), aead: aead}
+}
+
+// decryptingReader decrypts the records line by line
+type decryptingReader struct {
+	src     io.ReadCloser
+	br      *bufio.Reader
+	aead    cipher.AEAD
+	pending []byte // Okunmayı bekleyen çözülmüş veri
+	err     error
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		line, err := r.br.ReadBytes(recordSepChar)
+		if err != nil {
+			r.err = err // io.EOF dahil. Son satır yine de işlenir.
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		hasSep := line[len(line)-1] == recordSepChar
+		if hasSep {
+			line = line[:len(line)-1]
+		}
+		plain, err := openLine(r.aead, line)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		if hasSep {
+			plain = append(plain, recordSepChar)
+		}
+		r.pending = plain
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *decryptingReader) Close() error {
+	return r.src.Close()
+}
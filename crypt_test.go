@@ -0,0 +1,270 @@
+package arnedb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	_ = os.RemoveAll("testdb/cryptdb")
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	if _, err := Open("testdb", "cryptdb", WithEncryptionKey([]byte("short"))); err == nil {
+		t.Error("Open accepted an invalid key")
+	}
+
+	pDb, err := Open("testdb", "cryptdb", WithEncryptionKey(key), WithChangeLog())
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	secrets, err := pDb.CreateColl("secrets", WithCompression(gzip.BestSpeed))
+	if err != nil {
+		t.Fatal("Create secrets failed with:", err)
+	}
+
+	text := strings.Repeat("classified ", 100)
+	for i := 0; i < 1500; i++ {
+		if err = secrets.Add(RecordInstance{"seq": i, "text": text}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	if _, err = secrets.AddAll(RecordInstance{"seq": 1500}, RecordInstance{"seq": 1501}); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+	if _, err = secrets.DeleteAll(func(i RecordInstance) bool { return i["seq"].(float64) < 10 }); err != nil {
+		t.Fatal("DeleteAll failed with:", err)
+	}
+
+	// Diskte düz metin olmamalı
+	last, _ := secrets.getLastChunk()
+	chunk, err := os.ReadFile("testdb/cryptdb/secrets/" + (*last).Name())
+	if err != nil {
+		t.Fatal("Cannot read chunk:", err)
+	}
+	if bytes.Contains(chunk, []byte("classified")) || bytes.Contains(chunk, []byte(`"seq"`)) {
+		t.Error("Chunk is not encrypted")
+	}
+
+	// Mühürlenmiş chunk şifrelenmeden önce sıkıştırılır
+	sealed, err := os.ReadFile("testdb/cryptdb/secrets/" + firstChunkName + compressedChunkExt)
+	if err != nil {
+		t.Fatal("Cannot read sealed chunk:", err)
+	}
+	plain, err := secrets.readChunk(firstChunkName + compressedChunkExt)
+	if err != nil || len(plain) < maxChunkSize/2 {
+		t.Fatalf("Cannot read sealed chunk content: %d bytes %v", len(plain), err)
+	}
+	if len(sealed) > len(plain)/10 || bytes.Contains(sealed, []byte("classified")) {
+		t.Errorf("Sealed chunk is not compressed before encryption: %d bytes of %d", len(sealed), len(plain))
+	}
+
+	all := func(RecordInstance) bool { return true }
+	n, err := secrets.Count(all)
+	if err != nil || n != 1492 {
+		t.Fatalf("Count returned %d, %v", n, err)
+	}
+
+	if _, err = Open("testdb", "cryptdb"); !errors.Is(err, ErrKeyRequired) {
+		t.Error("Open without a key returned:", err)
+	}
+	if _, err = Open("testdb", "cryptdb", WithEncryptionKey([]byte("fedcba9876543210"))); !errors.Is(err, ErrWrongKey) {
+		t.Error("Open with a wrong key returned:", err)
+	}
+
+	newKey := []byte("fedcba9876543210")
+	if err = pDb.RotateKey(newKey); err != nil {
+		t.Fatal("RotateKey failed with:", err)
+	}
+	if _, err = Open("testdb", "cryptdb", WithEncryptionKey(key)); !errors.Is(err, ErrWrongKey) {
+		t.Error("Open with the old key returned:", err)
+	}
+
+	pDb, err = Open("testdb", "cryptdb", WithChangeLog(), WithEncryptionKey(newKey))
+	if err != nil {
+		t.Fatal("Open with the new key failed with:", err)
+	}
+	secrets = pDb.GetColl("secrets")
+	first, err := secrets.GetFirst(all)
+	if err != nil || first["seq"].(float64) != 10 {
+		t.Fatalf("GetFirst returned %v, %v", first, err)
+	}
+	if pDb.changeSeq != 1512 {
+		t.Errorf("Change log is not readable, last token is %d", pDb.changeSeq)
+	}
+
+	// Şifre kaldırılır
+	if err = pDb.RotateKey(nil); err != nil {
+		t.Fatal("RotateKey failed with:", err)
+	}
+	pDb, err = Open("testdb", "cryptdb")
+	if err != nil {
+		t.Fatal("Open without a key failed with:", err)
+	}
+	n, err = pDb.GetColl("secrets").Count(all)
+	if err != nil || n != 1492 {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+}
+
+// renameFailingStorage fails renaming the named file
+type renameFailingStorage struct {
+	Storage
+	fail string
+}
+
+func (s *renameFailingStorage) Rename(coll, oldName, newName string) error {
+	if oldName == s.fail {
+		return errors.New("rename failed")
+	}
+	return s.Storage.Rename(coll, oldName, newName)
+}
+
+func TestRotateKeyInterrupted(t *testing.T) {
+	keyA, keyB := []byte("0123456789abcdef"), []byte("fedcba9876543210")
+	storage := &renameFailingStorage{Storage: NewMemStorage()}
+	pDb, err := OpenStorage("rotatedb", storage, WithEncryptionKey(keyA))
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	items, _ := pDb.CreateColl("items")
+	others, _ := pDb.CreateColl("others")
+	_, _ = items.AddAll(RecordInstance{"a": 1}, RecordInstance{"a": 2})
+	_ = others.Add(RecordInstance{"b": 1})
+	all := func(RecordInstance) bool { return true }
+
+	// Bir dosya yerine konamazsa değişim tekrar çağrıldığında tamamlanır
+	storage.fail = firstChunkName + rotateExt
+	if err = pDb.RotateKey(keyB); err == nil {
+		t.Fatal("RotateKey expected to fail")
+	}
+	storage.fail = ""
+	if err = pDb.RotateKey(keyB); err != nil {
+		t.Fatal("RotateKey again failed with:", err)
+	}
+	for _, c := range []*Coll{items, others} {
+		if n, err := c.Count(all); err != nil || n == 0 {
+			t.Errorf("%s is not readable after the rotation: %d %v", c.GetName(), n, err)
+		}
+	}
+
+	// Open yarıda kalan değişimi tamamlar
+	storage.fail = firstChunkName + rotateExt
+	if err = pDb.RotateKey(nil); err == nil {
+		t.Fatal("RotateKey expected to fail")
+	}
+	storage.fail = ""
+	_ = pDb.Close()
+	pDb, err = OpenStorage("rotatedb", storage)
+	if err != nil {
+		t.Fatal("Open without a key failed with:", err)
+	}
+	if n, err := pDb.GetColl("items").Count(all); err != nil || n != 2 {
+		t.Errorf("Count after the recovered rotation returned %d %v", n, err)
+	}
+	files, _ := storage.List("items")
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), rotateExt) {
+			t.Error("rotated file is left:", f.Name())
+		}
+	}
+
+	// Başarısız bir değişimin dosyaları silinir
+	_ = storage.Replace("items", firstChunkName+rotateExt, []byte("stale"))
+	_ = pDb.Close()
+	if pDb, err = OpenStorage("rotatedb", storage); err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	defer pDb.Close()
+	if content, _ := readStorageFile(storage, "items", firstChunkName); bytes.Contains(content, []byte("stale")) {
+		t.Error("uncommitted rotated file is put in place")
+	}
+	if _, err = readStorageFile(storage, "items", firstChunkName+rotateExt); err == nil {
+		t.Error("uncommitted rotated file is not removed")
+	}
+}
+
+func TestRotateKeyWhileReading(t *testing.T) {
+	keys := [][]byte{[]byte("0123456789abcdef"), []byte("fedcba9876543210")}
+	pDb, err := OpenInMemory("rotatedb", WithEncryptionKey(keys[0]))
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	defer pDb.Close()
+	var colls []*Coll
+	for c := 0; c < 20; c++ {
+		coll, _ := pDb.CreateColl(fmt.Sprintf("items%d", c))
+		for i := 0; i < 10; i++ {
+			_ = coll.Add(RecordInstance{"i": i})
+		}
+		colls = append(colls, coll)
+	}
+
+	done := make(chan struct{})
+	failed := make(chan error, 1)
+	go func() {
+		defer close(failed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, coll := range colls {
+				if n, err := coll.Count(func(RecordInstance) bool { return true }); err != nil || n != 10 {
+					failed <- errors.New(fmt.Sprintf("count of %s %d: %v", coll.GetName(), n, err))
+					return
+				}
+			}
+		}
+	}()
+	for i := 1; i <= 40; i++ {
+		if err = pDb.RotateKey(keys[i%2]); err != nil {
+			t.Fatal("RotateKey failed with:", err)
+		}
+	}
+	close(done)
+	if err = <-failed; err != nil {
+		t.Error("query failed during the rotation:", err)
+	}
+}
+
+func TestEncryptionKeepsPlainScalars(t *testing.T) {
+	storage := NewMemStorage()
+	pDb, err := OpenStorage("scalardb", storage)
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	items, _ := pDb.CreateColl("items")
+	for _, v := range []interface{}{42, true, "text", RecordInstance{"a": 1}} {
+		if err = items.Add(v); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	_ = pDb.Close()
+
+	// Şifresiz kayıtlar anahtar verildikten sonra da okunur
+	key := []byte("0123456789abcdef")
+	pDb, err = OpenStorage("scalardb", storage, WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal("Open with a key failed with:", err)
+	}
+	defer pDb.Close()
+	items = pDb.GetColl("items")
+	_ = items.Add(RecordInstance{"b": 2})
+	content, err := items.readChunk(firstChunkName)
+	if err != nil || string(content) != "42\ntrue\n\"text\"\n{\"a\":1}\n{\"b\":2}\n" {
+		t.Errorf("plain records are not readable with a key: %q %v", content, err)
+	}
+	if err = pDb.RotateKey(key); err != nil {
+		t.Fatal("RotateKey failed with:", err)
+	}
+	raw, _ := readStorageFile(storage, "items", firstChunkName)
+	if bytes.Count(raw, []byte(sealedLineMarker)) != 5 || countNonBlankLines(raw) != 5 {
+		t.Errorf("records are not encrypted by RotateKey: %q", raw)
+	}
+}
@@ -0,0 +1,217 @@
+package arnedb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportFormat is the output format of Export.
+type ExportFormat string
+
+const (
+	// ExportNDJSON writes one JSON document per line
+	ExportNDJSON ExportFormat = "ndjson"
+	// ExportJSON writes an indented JSON array
+	ExportJSON ExportFormat = "json"
+	// ExportCSV writes a header line and one row per document
+	ExportCSV ExportFormat = "csv"
+)
+
+// Export function writes the documents matching the filter to w and returns their count. A nil
+// filter exports all the documents. Documents are read and written chunk by chunk, so the collection
+// is not loaded into memory.
+//
+// If projection is not empty, only the listed fields are written. Fields can be dotted paths. For CSV
+// the projection is the column list. Without a projection the CSV columns are the nested fields
+// flattened into dotted paths, found by an extra pass over the collection. Arrays and objects which
+// are not flattened are written as JSON text, missing fields as empty cells.
+func (coll *Coll) Export(w io.Writer, format ExportFormat, filter *Filter, projection []string) (n int, err error) {
+	if filter == nil {
+		filter = &Filter{root: andNode{}}
+	}
+
+	bw := bufio.NewWriter(w)
+	switch format {
+	case ExportNDJSON:
+		n, err = coll.exportJSON(bw, filter, projection, false)
+	case ExportJSON:
+		n, err = coll.exportJSON(bw, filter, projection, true)
+	case ExportCSV:
+		n, err = coll.exportCSV(bw, filter, projection)
+	default:
+		return 0, errors.New(fmt.Sprintf("unknown export format: %s", format))
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// exportJSON writes the documents as NDJSON or as an indented JSON array
+func (coll *Coll) exportJSON(w *bufio.Writer, filter *Filter, projection []string, array bool) (n int, err error) {
+	if array {
+		_, _ = w.WriteString("[")
+	}
+
+	var writeErr error
+	err = coll.exportScan(filter, func(data RecordInstance) bool {
+		var content []byte
+		if array {
+			content, writeErr = json.MarshalIndent(project(data, projection), "  ", "  ")
+		} else {
+			content, writeErr = json.Marshal(project(data, projection))
+		}
+		if writeErr != nil {
+			return false
+		}
+
+		if array {
+			if n > 0 {
+				_, _ = w.WriteString(",")
+			}
+			_, _ = w.WriteString("\n  ")
+		}
+		_, _ = w.Write(content)
+		if !array {
+			writeErr = w.WriteByte('\n')
+		}
+		n++
+		return writeErr == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if array {
+		if n > 0 {
+			_, _ = w.WriteString("\n")
+		}
+		_, err = w.WriteString("]\n")
+	}
+	return n, err
+}
+
+// exportCSV writes the documents as CSV rows
+func (coll *Coll) exportCSV(w *bufio.Writer, filter *Filter, projection []string) (n int, err error) {
+	columns := projection
+	if len(columns) == 0 {
+		// Sütunlar için koleksiyon bir kez taranır, sadece alan adları tutulur
+		seen := make(map[string]bool)
+		err = coll.exportScan(filter, func(data RecordInstance) bool {
+			flattenKeys(data, "", seen)
+			return true
+		})
+		if err != nil {
+			return 0, err
+		}
+		for column := range seen {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+	}
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(columns); err != nil {
+		return 0, err
+	}
+
+	row := make([]string, len(columns))
+	var writeErr error
+	err = coll.exportScan(filter, func(data RecordInstance) bool {
+		for i, column := range columns {
+			value, found := lookupField(data, column)
+			if !found {
+				row[i] = ""
+				continue
+			}
+			row[i] = csvCell(value)
+		}
+		if writeErr = cw.Write(row); writeErr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// exportScan walks the matching documents. The read hooks are applied like Find does.
+func (coll *Coll) exportScan(filter *Filter, fn func(data RecordInstance) bool) error {
+	var hookErr error
+	err := coll.scanFilter(filter, func(data RecordInstance) bool {
+		data, hookErr = coll.afterRead(data)
+		if hookErr != nil {
+			return false
+		}
+		return fn(data)
+	})
+	if err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+// project returns a document with only the listed fields. Missing fields are left out.
+func project(data RecordInstance, fields []string) RecordInstance {
+	if len(fields) == 0 {
+		return data
+	}
+	result := make(RecordInstance, len(fields))
+	for _, field := range fields {
+		if value, found := lookupField(data, field); found {
+			setField(result, field, value)
+		}
+	}
+	return result
+}
+
+// flattenKeys collects the dotted paths of the leaf fields. Arrays are leaves.
+func flattenKeys(doc map[string]interface{}, prefix string, seen map[string]bool) {
+	for key, value := range doc {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, isDoc := value.(map[string]interface{}); isDoc && len(nested) > 0 {
+			flattenKeys(nested, path, seen)
+			continue
+		}
+		seen[path] = true
+	}
+}
+
+// csvCell formats a value for a CSV cell
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if content, err := json.Marshal(value); err == nil {
+		return strings.TrimSpace(string(content))
+	}
+	return fmt.Sprint(value)
+}
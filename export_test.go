@@ -0,0 +1,98 @@
+package arnedb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	_ = os.RemoveAll("testdb/exportdb")
+
+	pDb, err := Open("testdb", "exportdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	people, err := pDb.CreateColl("people")
+	if err != nil {
+		t.Fatal("Create people failed with:", err)
+	}
+	data := []RecordInstance{
+		{"id": 1, "name": "Ada", "age": 36, "address": map[string]interface{}{"city": "London", "zip": "N1"}},
+		{"id": 2, "name": "Linus, Jr.", "age": 1000000, "tags": []string{"a", "b"}},
+		{"id": 3, "name": "Grace", "age": 85, "active": true},
+	}
+	if _, err = people.AddAll(data...); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+	filter, _ := ParseFilter([]byte(`{"age": {"$gt": 40}}`))
+
+	// NDJSON
+	var out bytes.Buffer
+	n, err := people.Export(&out, ExportNDJSON, filter, []string{"name", "address.city"})
+	if err != nil || n != 2 {
+		t.Fatal("Export NDJSON unexpected result:", n, err)
+	}
+	if out.String() != "{\"name\":\"Linus, Jr.\"}\n{\"name\":\"Grace\"}\n" {
+		t.Errorf("Export NDJSON unexpected output: %q", out.String())
+	}
+
+	// JSON dizisi
+	out.Reset()
+	if n, err = people.Export(&out, ExportJSON, nil, []string{"id", "address.city"}); err != nil || n != 3 {
+		t.Fatal("Export JSON unexpected result:", n, err)
+	}
+	var docs []map[string]interface{}
+	if err = json.Unmarshal(out.Bytes(), &docs); err != nil || len(docs) != 3 {
+		t.Fatalf("Export JSON output is not an array of 3: %v %s", err, out.String())
+	}
+	if address, _ := docs[0]["address"].(map[string]interface{}); address == nil || address["city"] != "London" || address["zip"] != nil {
+		t.Errorf("Export JSON projection unexpected: %v", docs[0])
+	}
+	if !strings.HasPrefix(out.String(), "[\n  {\n    ") {
+		t.Errorf("Export JSON expected to be indented: %q", out.String())
+	}
+	out.Reset()
+	none, _ := ParseFilter([]byte(`{"id": 99}`))
+	if n, err = people.Export(&out, ExportJSON, none, nil); err != nil || n != 0 || out.String() != "[]\n" {
+		t.Errorf("Export JSON of nothing unexpected: %d %v %q", n, err, out.String())
+	}
+
+	// CSV, sütunlar iç içe alanlardan çıkarılır
+	out.Reset()
+	if n, err = people.Export(&out, ExportCSV, nil, nil); err != nil || n != 3 {
+		t.Fatal("Export CSV unexpected result:", n, err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil || len(rows) != 4 {
+		t.Fatal("Export CSV output is not valid:", err, rows)
+	}
+	expected := [][]string{
+		{"active", "address.city", "address.zip", "age", "id", "name", "tags"},
+		{"", "London", "N1", "36", "1", "Ada", ""},
+		{"", "", "", "1000000", "2", "Linus, Jr.", `["a","b"]`},
+		{"true", "", "", "85", "3", "Grace", ""},
+	}
+	for i := range expected {
+		if strings.Join(rows[i], "|") != strings.Join(expected[i], "|") {
+			t.Errorf("Export CSV row %d expected %v, got %v", i, expected[i], rows[i])
+		}
+	}
+
+	out.Reset()
+	if _, err = people.Export(&out, ExportCSV, filter, []string{"name", "address"}); err != nil {
+		t.Fatal("Export CSV with columns failed with:", err)
+	}
+	if out.String() != "name,address\n\"Linus, Jr.\",\nGrace,\n" {
+		t.Errorf("Export CSV with columns unexpected output: %q", out.String())
+	}
+
+	if _, err = people.Export(&out, "xml", nil, nil); err == nil {
+		t.Error("Export with an unknown format expected to fail")
+	}
+
+	_ = os.RemoveAll("testdb/exportdb")
+}
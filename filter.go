@@ -0,0 +1,577 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a declarative query. It is created from a document whose keys are field paths and
+// values are either the expected value or an operator document:
+//
+//	{"city": "Ankara", "age": {"$gte": 18, "$lt": 65}, "address.zip": {"$exists": true}}
+//
+// Supported operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin and $exists. Conditions can
+// be combined with $and and $or lists. Arrays and objects are compared as a whole.
+//
+// Collections using the JSON codec are scanned without decoding the records. Only the fields used
+// by the filter are extracted from the record text and a record is decoded only if it matches.
+type Filter struct {
+	root filterNode
+}
+
+// NewFilter function creates a filter from the given document.
+func NewFilter(doc map[string]interface{}) (*Filter, error) {
+	// Değerler JSON veri modeline dönüştürülür. Böylece 5 ile 5.0 eşit olur.
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid filter: %s", err.Error()))
+	}
+	return ParseFilter(payload)
+}
+
+// ParseFilter function creates a filter from the JSON text of the filter document.
+func ParseFilter(data []byte) (*Filter, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid filter: %s", err.Error()))
+	}
+
+	root, err := compileFilter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{root: root}, nil
+}
+
+// Match function reports whether the record matches the filter.
+func (f *Filter) Match(data RecordInstance) bool {
+	return f.root.match(func(path string) (interface{}, bool) {
+		return lookupField(data, path)
+	})
+}
+
+// Predicate function returns the filter as a query predicate, so it can be used with the other
+// query and manipulation functions like DeleteAll.
+func (f *Filter) Predicate() QueryPredicate {
+	return f.Match
+}
+
+// Find function returns all the records matching the filter.
+func (coll *Coll) Find(filter *Filter) (result []RecordInstance, err error) {
+	result = make([]RecordInstance, 0)
+	var hookErr error
+	err = coll.scanFilter(filter, func(data RecordInstance) bool {
+		data, hookErr = coll.afterRead(data)
+		if hookErr != nil {
+			return false
+		}
+		result = append(result, data)
+		return true
+	})
+	if err == nil {
+		err = hookErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindFirst function returns the first record matching the filter. It returns nil if no record
+// matches.
+func (coll *Coll) FindFirst(filter *Filter) (result RecordInstance, err error) {
+	err = coll.scanFilter(filter, func(data RecordInstance) bool {
+		result = data
+		return false
+	})
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return coll.afterRead(result)
+}
+
+// CountFilter function returns the count of the records matching the filter.
+func (coll *Coll) CountFilter(filter *Filter) (n int, err error) {
+	err = coll.scanFilter(filter, func(RecordInstance) bool {
+		n++
+		return true
+	})
+	return n, err
+}
+
+// SortField is a sort key used by SortRecords.
+type SortField struct {
+	// Field is the field path
+	Field string `json:"field"`
+	// Desc sorts in descending order
+	Desc bool `json:"desc,omitempty"`
+}
+
+// SortRecords function sorts the records by the given fields. Later fields break the ties of the
+// earlier ones and the order of equal records is kept. Values of different types are ordered by type:
+// missing and null values come first, then booleans, numbers and strings.
+func SortRecords(records []RecordInstance, by ...SortField) {
+	if len(by) == 0 {
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, key := range by {
+			a, _ := lookupField(records[i], key.Field)
+			b, _ := lookupField(records[j], key.Field)
+			if c := compareValues(a, b); c != 0 {
+				return (c < 0) != key.Desc
+			}
+		}
+		return false
+	})
+}
+
+// scanFilter walks the records matching the filter and calls fn for each one. Walking stops when fn
+// returns false. JSON records are matched before they are decoded.
+func (coll *Coll) scanFilter(filter *Filter, fn func(data RecordInstance) bool) error {
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return err
+	}
+
+	codec := coll.codec()
+	lazy := codec == JSONCodec
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
+	for _, chunk := range chunks {
+		var f io.ReadCloser
+		f, err = coll.openChunk(chunk.Name())
+		if err != nil {
+			return err
+		}
+
+		scn := newRecordScanner(f)
+		goOn := true
+		for goOn && scn.Scan() {
+			line := scn.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			if lazy && !filter.root.match(rawLineGetter(line)) {
+				continue // kayıt çözülmeden elenir
+			}
+
+			var data RecordInstance
+			if codec.Unmarshal(line, &data) != nil {
+				continue // skip this record
+			}
+			if coll.expired(data, now) || (!lazy && !filter.Match(data)) {
+				continue
+			}
+			goOn = fn(data)
+		}
+		err = scn.Err()
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+		if !goOn {
+			break
+		}
+	}
+
+	return nil
+}
+
+// rawLineGetter returns the field getter of a JSON record line. Fields are extracted on demand.
+func rawLineGetter(line []byte) func(path string) (interface{}, bool) {
+	return func(path string) (interface{}, bool) {
+		raw, found := rawField(line, path)
+		if !found {
+			return nil, false
+		}
+		value, err := decodeRawValue(raw)
+		if err != nil {
+			return nil, false
+		}
+		return value, true
+	}
+}
+
+// isRawObject reports whether the line is a valid JSON object without decoding it.
+func isRawObject(line []byte) bool {
+	i := skipSpace(line, 0)
+	return i < len(line) && line[i] == '{' && json.Valid(line)
+}
+
+// Filter compilation -------------------------------------------------------------------------------
+
+// filterNode is a compiled part of a filter. get returns the value of a field path.
+type filterNode interface {
+	match(get func(path string) (interface{}, bool)) bool
+}
+
+type andNode []filterNode
+type orNode []filterNode
+
+type condNode struct {
+	path string
+	op   string
+	arg  interface{}
+}
+
+func (n andNode) match(get func(path string) (interface{}, bool)) bool {
+	for _, node := range n {
+		if !node.match(get) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n orNode) match(get func(path string) (interface{}, bool)) bool {
+	for _, node := range n {
+		if node.match(get) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n condNode) match(get func(path string) (interface{}, bool)) bool {
+	value, found := get(n.path)
+	switch n.op {
+	case "$exists":
+		return found == n.arg.(bool)
+	case "$eq":
+		return found && equalValues(value, n.arg)
+	case "$ne":
+		return !found || !equalValues(value, n.arg)
+	case "$in", "$nin":
+		in := false
+		if found {
+			for _, item := range n.arg.([]interface{}) {
+				if equalValues(value, item) {
+					in = true
+					break
+				}
+			}
+		}
+		return in == (n.op == "$in")
+	}
+
+	// Sıralama operatörleri sadece aynı tipteki değerleri karşılaştırır
+	if !found || valueTypeName(value) != valueTypeName(n.arg) {
+		return false
+	}
+	cmp := compareValues(value, n.arg)
+	switch n.op {
+	case "$gt":
+		return cmp > 0
+	case "$gte":
+		return cmp >= 0
+	case "$lt":
+		return cmp < 0
+	default: // $lte
+		return cmp <= 0
+	}
+}
+
+// filterOps is the set of the field operators
+var filterOps = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true,
+}
+
+// compileFilter compiles a filter document. Conditions are sorted by the field path so the order of
+// the evaluation does not depend on the map order.
+func compileFilter(doc map[string]interface{}) (filterNode, error) {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make(andNode, 0, len(keys))
+	for _, key := range keys {
+		value := doc[key]
+
+		if key == "$and" || key == "$or" {
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, errors.New(fmt.Sprintf("invalid filter: %s requires a non empty list", key))
+			}
+			nodes := make([]filterNode, 0, len(list))
+			for _, item := range list {
+				sub, ok := item.(map[string]interface{})
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("invalid filter: %s items must be documents", key))
+				}
+				node, err := compileFilter(sub)
+				if err != nil {
+					return nil, err
+				}
+				nodes = append(nodes, node)
+			}
+			if key == "$or" {
+				result = append(result, orNode(nodes))
+			} else {
+				result = append(result, andNode(nodes))
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			return nil, errors.New(fmt.Sprintf("invalid filter: unknown operator %s", key))
+		}
+
+		ops, isOps := value.(map[string]interface{})
+		if !isOps || !isOperatorDoc(ops) {
+			result = append(result, condNode{path: key, op: "$eq", arg: value})
+			continue
+		}
+
+		opNames := make([]string, 0, len(ops))
+		for op := range ops {
+			opNames = append(opNames, op)
+		}
+		sort.Strings(opNames)
+		for _, op := range opNames {
+			arg := ops[op]
+			if !filterOps[op] {
+				return nil, errors.New(fmt.Sprintf("invalid filter: unknown operator %s on %s", op, key))
+			}
+			if _, ok := arg.([]interface{}); !ok && (op == "$in" || op == "$nin") {
+				return nil, errors.New(fmt.Sprintf("invalid filter: %s on %s requires a list", op, key))
+			}
+			if _, ok := arg.(bool); !ok && op == "$exists" {
+				return nil, errors.New(fmt.Sprintf("invalid filter: $exists on %s requires a bool", key))
+			}
+			result = append(result, condNode{path: key, op: op, arg: arg})
+		}
+	}
+
+	if len(result) == 1 {
+		return result[0], nil
+	}
+	return result, nil
+}
+
+// isOperatorDoc reports whether the document holds operators instead of an expected value
+func isOperatorDoc(doc map[string]interface{}) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// equalValues compares two decoded values. Arrays and objects are compared deeply.
+func equalValues(a, b interface{}) bool {
+	ta := valueTypeName(a)
+	if ta != valueTypeName(b) {
+		return false
+	}
+	if ta == "array" || ta == "object" {
+		return reflect.DeepEqual(a, b)
+	}
+	return compareValues(a, b) == 0
+}
+
+// Raw JSON field extraction -------------------------------------------------------------------------
+
+// rawField returns the raw JSON text of a field in the record line without decoding the record.
+// Dotted paths are resolved through nested documents. A key containing dots itself is matched first
+// just like lookupField does.
+func rawField(data []byte, path string) ([]byte, bool) {
+	if value, found := rawMember(data, path); found {
+		return value, true
+	}
+	if strings.IndexByte(path, '.') < 0 {
+		return nil, false
+	}
+
+	current := data
+	for path != "" {
+		part := path
+		if i := strings.IndexByte(path, '.'); i >= 0 {
+			part, path = path[:i], path[i+1:]
+		} else {
+			path = ""
+		}
+		var found bool
+		if current, found = rawMember(current, part); !found {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// rawMember returns the raw JSON text of the member of an object. Other members are skipped
+// without being decoded. If the key is repeated the last one is returned, as encoding/json does.
+func rawMember(obj []byte, key string) ([]byte, bool) {
+	i := skipSpace(obj, 0)
+	if i >= len(obj) || obj[i] != '{' {
+		return nil, false
+	}
+	i++
+
+	var member []byte
+	found := false
+	for {
+		i = skipSpace(obj, i)
+		if i >= len(obj) || obj[i] != '"' {
+			return nil, false // '{}' veya bozuk kayıt
+		}
+		end, escaped := scanString(obj, i)
+		if end < 0 {
+			return nil, false
+		}
+		matched := keyEquals(obj[i:end], escaped, key)
+
+		i = skipSpace(obj, end)
+		if i >= len(obj) || obj[i] != ':' {
+			return nil, false
+		}
+		i = skipSpace(obj, i+1)
+		valueEnd := skipValue(obj, i)
+		if valueEnd < 0 {
+			return nil, false
+		}
+		if matched {
+			// taramaya devam edilir, tekrar eden anahtarda sonuncusu geçerlidir
+			member, found = obj[i:valueEnd], true
+		}
+
+		i = skipSpace(obj, valueEnd)
+		if i < len(obj) && obj[i] == '}' {
+			return member, found
+		}
+		if i >= len(obj) || obj[i] != ',' {
+			return nil, false
+		}
+		i++
+	}
+}
+
+// keyEquals compares a quoted JSON key with the given key
+func keyEquals(quoted []byte, escaped bool, key string) bool {
+	if !escaped {
+		return string(quoted[1:len(quoted)-1]) == key
+	}
+	var s string
+	if json.Unmarshal(quoted, &s) != nil {
+		return false
+	}
+	return s == key
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// scanString returns the index after the string starting at i and whether it has escapes. It
+// returns -1 if the string is not terminated.
+func scanString(data []byte, i int) (int, bool) {
+	escaped := false
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			escaped = true
+			j++
+		case '"':
+			return j + 1, escaped
+		}
+	}
+	return -1, escaped
+}
+
+// skipValue returns the index after the value starting at i or -1 if the value is broken
+func skipValue(data []byte, i int) int {
+	if i >= len(data) {
+		return -1
+	}
+
+	switch data[i] {
+	case '"':
+		end, _ := scanString(data, i)
+		return end
+	case '{', '[':
+		depth := 0
+		for i < len(data) {
+			switch data[i] {
+			case '"':
+				end, _ := scanString(data, i)
+				if end < 0 {
+					return -1
+				}
+				i = end
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+		return -1
+	}
+
+	// Sayı, true, false veya null
+	start := i
+	for i < len(data) {
+		switch data[i] {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			if i == start {
+				return -1
+			}
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+// decodeRawValue decodes the raw JSON text of a value. Scalars are decoded without encoding/json.
+func decodeRawValue(raw []byte) (interface{}, error) {
+	switch raw[0] {
+	case '"':
+		end, escaped := scanString(raw, 0)
+		if !escaped && end == len(raw) {
+			return string(raw[1 : len(raw)-1]), nil
+		}
+	case 't', 'f', 'n':
+		switch string(raw) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	case '{', '[':
+	default:
+		if f, err := strconv.ParseFloat(string(raw), 64); err == nil {
+			return f, nil
+		}
+	}
+
+	var value interface{}
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
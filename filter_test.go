@@ -0,0 +1,193 @@
+package arnedb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	_ = os.RemoveAll("testdb/filterdb")
+
+	pDb, err := Open("testdb", "filterdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+
+	data := []RecordInstance{
+		{"id": 1, "city": "Ankara", "age": 30, "address": map[string]interface{}{"zip": "06000"}, "tags": []string{"a", "b"}},
+		{"id": 2, "city": "İzmir", "age": 17, "note": "say \"hi\", {ok}"},
+		{"id": 3, "city": "Ankara", "age": 65, "address": map[string]interface{}{"zip": "06100"}},
+		{"id": 4, "city": "Bursa", "age": nil, "address.zip": "16000"},
+		{"id": 5, "city": 34, "age": "old"},
+	}
+
+	for _, codec := range []Codec{JSONCodec, MsgPackCodec} {
+		coll, err := pDb.CreateColl("people_"+codec.Name(), WithCodec(codec))
+		if err != nil {
+			t.Fatal("Create coll failed with:", err)
+		}
+		if _, err = coll.AddAll(data...); err != nil {
+			t.Fatal("AddAll failed with:", err)
+		}
+
+		cases := []struct {
+			filter string
+			ids    []float64
+		}{
+			{`{}`, []float64{1, 2, 3, 4, 5}},
+			{`{"city": "Ankara"}`, []float64{1, 3}},
+			{`{"city": "Ankara", "age": {"$lt": 65}}`, []float64{1}},
+			{`{"age": {"$gte": 17, "$lte": 30}}`, []float64{1, 2}},
+			{`{"age": {"$gt": "a"}}`, []float64{5}},
+			{`{"age": null}`, []float64{4}},
+			{`{"age": {"$exists": false}}`, nil},
+			{`{"address": {"$exists": true}}`, []float64{1, 3}},
+			{`{"address.zip": "06100"}`, []float64{3}},
+			{`{"address.zip": {"$in": ["06000", "16000"]}}`, []float64{1, 4}},
+			{`{"city": {"$nin": ["Ankara", 34]}}`, []float64{2, 4}},
+			{`{"city": {"$ne": "Ankara"}}`, []float64{2, 4, 5}},
+			{`{"tags": ["a", "b"]}`, []float64{1}},
+			{`{"address": {"zip": "06000"}}`, []float64{1}},
+			{`{"note": "say \"hi\", {ok}"}`, []float64{2}},
+			{`{"$or": [{"id": 2}, {"age": {"$gt": 60}}]}`, []float64{2, 3}},
+			{`{"$and": [{"city": "Ankara"}, {"$or": [{"id": 1}, {"id": 4}]}]}`, []float64{1}},
+		}
+		for _, c := range cases {
+			filter, err := ParseFilter([]byte(c.filter))
+			if err != nil {
+				t.Fatalf("%s: ParseFilter %s failed with: %s", codec.Name(), c.filter, err)
+			}
+			result, err := coll.Find(filter)
+			if err != nil {
+				t.Fatalf("%s: Find %s failed with: %s", codec.Name(), c.filter, err)
+			}
+			if len(result) != len(c.ids) {
+				t.Errorf("%s: Find %s expected %v, got %v", codec.Name(), c.filter, c.ids, result)
+				continue
+			}
+			for i, record := range result {
+				if record["id"] != c.ids[i] {
+					t.Errorf("%s: Find %s expected %v, got %v", codec.Name(), c.filter, c.ids, result)
+					break
+				}
+				if !filter.Match(record) {
+					t.Errorf("%s: Match %s disagrees with Find on %v", codec.Name(), c.filter, record)
+				}
+			}
+
+			n, err := coll.CountFilter(filter)
+			if err != nil || n != len(c.ids) {
+				t.Errorf("%s: CountFilter %s expected %d, got %d %v", codec.Name(), c.filter, len(c.ids), n, err)
+			}
+		}
+
+		filter, _ := NewFilter(map[string]interface{}{"age": map[string]interface{}{"$gt": 18}})
+		first, err := coll.FindFirst(filter)
+		if err != nil || first == nil || first["id"] != 1.0 {
+			t.Errorf("%s: FindFirst expected id 1, got %v %v", codec.Name(), first, err)
+		}
+		n, err := coll.DeleteAll(filter.Predicate())
+		if err != nil || n != 2 {
+			t.Errorf("%s: DeleteAll with filter expected 2, got %d %v", codec.Name(), n, err)
+		}
+		if first, _ = coll.FindFirst(filter); first != nil {
+			t.Errorf("%s: FindFirst after delete expected nil, got %v", codec.Name(), first)
+		}
+	}
+
+	for _, bad := range []string{`[1]`, `{"$nope": 1}`, `{"a": {"$regex": "x"}}`, `{"a": {"$in": 1}}`,
+		`{"a": {"$exists": 1}}`, `{"$or": []}`, `{"$or": [1]}`} {
+		if _, err = ParseFilter([]byte(bad)); err == nil {
+			t.Errorf("ParseFilter %s expected to fail", bad)
+		}
+	}
+}
+
+func TestRawField(t *testing.T) {
+	line := []byte(`{ "a" : 1, "s": "x\"}", "o": {"b": [1, {"c": 2}], "d": {"e": true}}, "x.y": "dot", "x": {"y": "nested"}, "uA": 3 }`)
+
+	cases := map[string]string{
+		"a":     `1`,
+		"s":     `"x\"}"`,
+		"o.b":   `[1, {"c": 2}]`,
+		"o.d.e": `true`,
+		"x.y":   `"dot"`,
+		"uA":    `3`,
+	}
+	for path, expected := range cases {
+		raw, found := rawField(line, path)
+		if !found || string(raw) != expected {
+			t.Errorf("rawField %s expected %s, got %s %v", path, expected, raw, found)
+		}
+	}
+	for _, path := range []string{"b", "o.c", "a.b", "o.b.c"} {
+		if raw, found := rawField(line, path); found {
+			t.Errorf("rawField %s expected not found, got %s", path, raw)
+		}
+	}
+	if raw, found := rawField([]byte(`{"a": 1, "b": 2, "a": 3}`), "a"); !found || string(raw) != "3" {
+		t.Errorf("rawField on a repeated key expected the last value, got %s %v", raw, found)
+	}
+	if _, found := rawField([]byte(`{"a": `), "a"); found {
+		t.Error("rawField on broken record expected not found")
+	}
+}
+
+func TestFindDuplicateKeys(t *testing.T) {
+	_ = os.RemoveAll("testdb/dupkeydb")
+
+	pDb, err := Open("testdb", "dupkeydb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	coll, err := pDb.CreateColl("items")
+	if err != nil {
+		t.Fatal("Create items failed with:", err)
+	}
+	if err = coll.Add(RecordInstance{"id": 1, "status": "new"}); err != nil {
+		t.Fatal("Add failed with:", err)
+	}
+
+	// Dışarıdan yazılan kayıtta anahtar tekrar eder, encoding/json sonuncusunu alır
+	f, err := os.OpenFile("testdb/dupkeydb/items/00.json", os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal("OpenFile failed with:", err)
+	}
+	_, _ = f.WriteString("{\"id\":2,\"status\":\"new\",\"status\":\"done\"}\n")
+	_ = f.Close()
+
+	for _, status := range []string{"new", "done"} {
+		filter, _ := NewFilter(map[string]interface{}{"status": status})
+		found, err := coll.Find(filter)
+		if err != nil {
+			t.Fatal("Find failed with:", err)
+		}
+		all, err := coll.GetAll(filter.Predicate())
+		if err != nil {
+			t.Fatal("GetAll failed with:", err)
+		}
+		if len(found) != 1 || len(all) != 1 || found[0]["id"] != all[0]["id"] {
+			t.Errorf("Find and GetAll disagree on status %s: %v %v", status, found, all)
+		}
+	}
+
+	_ = os.RemoveAll("testdb/dupkeydb")
+}
+
+func TestSortRecords(t *testing.T) {
+	records := []RecordInstance{
+		{"id": 1, "city": "Bursa", "age": 30.0},
+		{"id": 2, "city": "Ankara", "age": 17.0},
+		{"id": 3, "city": "Bursa", "age": 65.0},
+		{"id": 4, "age": 40.0},
+		{"id": 5, "city": "Ankara", "age": 17.0},
+	}
+
+	SortRecords(records, SortField{Field: "city"}, SortField{Field: "age", Desc: true})
+	expected := []int{4, 2, 5, 3, 1}
+	for i, id := range expected {
+		if records[i]["id"] != id {
+			t.Fatalf("SortRecords position %d expected id %d, got %v", i, id, records[i]["id"])
+		}
+	}
+}
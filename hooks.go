@@ -0,0 +1,235 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// HookPoint is the point of an operation where hooks are invoked.
+type HookPoint int
+
+const (
+	// BeforeInsert hooks are invoked by Add and AddAll before the document is written
+	BeforeInsert HookPoint = iota
+	// AfterInsert hooks are invoked by Add and AddAll after the document is written
+	AfterInsert
+	// BeforeUpdate hooks are invoked by UpdateFirst and UpdateAll with the updated document
+	BeforeUpdate
+	// AfterUpdate hooks are invoked by UpdateFirst and UpdateAll after the document is written
+	AfterUpdate
+	// BeforeReplace hooks are invoked by ReplaceFirst and ReplaceAll with the new document
+	BeforeReplace
+	// AfterReplace hooks are invoked by ReplaceFirst and ReplaceAll after the document is written
+	AfterReplace
+	// BeforeDelete hooks are invoked by DeleteFirst and DeleteAll for each matched document
+	BeforeDelete
+	// AfterDelete hooks are invoked by DeleteFirst and DeleteAll after the document is removed
+	AfterDelete
+	// AfterRead hooks are invoked by the query functions for each document returned to the caller
+	AfterRead
+)
+
+// HookEvent is handed to the hooks.
+type HookEvent struct {
+	// Point is the point the hook is invoked at
+	Point HookPoint
+	// Coll is the name of the collection
+	Coll string
+	// Doc is the document being written, deleted or read. Before hooks and AfterRead hooks may alter
+	// it. Alterations are written to the storage or returned to the caller.
+	Doc RecordInstance
+	// Prev is the previous version of the document for update and replace operations
+	Prev RecordInstance
+}
+
+// HookFunc is a function invoked around collection operations. Returning an error from a before hook
+// vetoes the operation and the error is returned to the caller. An error returned from an after hook
+// is also returned to the caller but the operation is already committed.
+//
+// Hooks must not write into the collection they are invoked for.
+type HookFunc func(e *HookEvent) error
+
+// hookRegistry holds the registered hooks
+type hookRegistry struct {
+	mu    sync.RWMutex
+	hooks map[HookPoint][]HookFunc
+}
+
+// add registers a hook
+func (r *hookRegistry) add(point HookPoint, fn HookFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hooks == nil {
+		r.hooks = make(map[HookPoint][]HookFunc)
+	}
+	r.hooks[point] = append(r.hooks[point], fn)
+}
+
+// get returns the hooks of the given point
+func (r *hookRegistry) get(point HookPoint) []HookFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hooks[point]
+}
+
+// AddHook registers a hook invoked at the given point for all the collections of the database.
+// Database hooks are invoked before collection hooks.
+func (db *ArneDB) AddHook(point HookPoint, fn HookFunc) {
+	db.hooks.add(point, fn)
+}
+
+// AddHook registers a hook invoked at the given point for the collection.
+func (coll *Coll) AddHook(point HookPoint, fn HookFunc) {
+	coll.hooks.add(point, fn)
+}
+
+// hasHooks reports whether there is any hook for the given points
+func (coll *Coll) hasHooks(points ...HookPoint) bool {
+	for _, point := range points {
+		if coll.db != nil && len(coll.db.hooks.get(point)) > 0 {
+			return true
+		}
+		if len(coll.hooks.get(point)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// runHooks invokes the database and collection hooks in order. It returns the document which may be
+// altered by the hooks.
+func (coll *Coll) runHooks(point HookPoint, doc RecordInstance, prev RecordInstance) (RecordInstance, error) {
+	e := HookEvent{
+		Point: point,
+		Coll:  coll.GetName(),
+		Doc:   doc,
+		Prev:  prev,
+	}
+
+	var hooks []HookFunc
+	if coll.db != nil {
+		hooks = append(hooks, coll.db.hooks.get(point)...)
+	}
+	hooks = append(hooks, coll.hooks.get(point)...)
+
+	for _, hook := range hooks {
+		if err := hook(&e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.Doc, nil
+}
+
+// beforeWrite runs the before hooks on a marshalled document and returns the document marshalled
+// again with the alterations.
+func (coll *Coll) beforeWrite(point HookPoint, payload []byte, prev []byte) ([]byte, error) {
+	if !coll.hasHooks(point) {
+		return payload, nil
+	}
+
+	codec := coll.codec()
+	var doc, prevDoc RecordInstance
+	if err := codec.Unmarshal(payload, &doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("hooks require a document: %s", err.Error()))
+	}
+	if prev != nil {
+		_ = codec.Unmarshal(prev, &prevDoc)
+	}
+
+	doc, err := coll.runHooks(point, doc, prevDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err = codec.Marshal(doc)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot marshal hook result: %s", err.Error()))
+	}
+	return payload, nil
+}
+
+// afterRead runs the AfterRead hooks on a document returned to the caller
+func (coll *Coll) afterRead(data RecordInstance) (RecordInstance, error) {
+	if !coll.hasHooks(AfterRead) {
+		return data, nil
+	}
+	return coll.runHooks(AfterRead, data, nil)
+}
+
+// afterReadInto runs the AfterRead hooks for typed queries. The record line is decoded as a document
+// for the hooks and the altered document is decoded into holder again.
+func (coll *Coll) afterReadInto(line []byte, holder interface{}) error {
+	if !coll.hasHooks(AfterRead) {
+		return nil
+	}
+
+	var doc RecordInstance
+	if err := coll.codec().Unmarshal(line, &doc); err != nil {
+		return err
+	}
+	doc, err := coll.runHooks(AfterRead, doc, nil)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot marshal hook result: %s", err.Error()))
+	}
+	return json.Unmarshal(payload, holder)
+}
+
+// recordChange is a committed change of a single record. Documents are kept encoded by the codec of
+// the collection.
+type recordChange struct {
+	doc  []byte
+	prev []byte
+}
+
+// afterHooks maps the change types to their after hook points
+var afterHooks = map[ChangeType]HookPoint{
+	ChangeInsert:  AfterInsert,
+	ChangeUpdate:  AfterUpdate,
+	ChangeReplace: AfterReplace,
+	ChangeDelete:  AfterDelete,
+}
+
+// tracking reports whether the committed changes of the given type must be collected
+func (coll *Coll) tracking(changeType ChangeType) bool {
+	return coll.watching() || coll.hasHooks(afterHooks[changeType])
+}
+
+// commit publishes the change events and runs the after hooks for the committed changes.
+func (coll *Coll) commit(changeType ChangeType, changes []recordChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if coll.watching() {
+		events := make([]ChangeEvent, len(changes))
+		for i, c := range changes {
+			events[i] = coll.newChangeEvent(changeType, c.doc, c.prev)
+		}
+		coll.publish(events)
+	}
+
+	point := afterHooks[changeType]
+	if !coll.hasHooks(point) {
+		return nil
+	}
+	codec := coll.codec()
+	for _, c := range changes {
+		var doc, prev RecordInstance
+		_ = codec.Unmarshal(c.doc, &doc)
+		if c.prev != nil {
+			_ = codec.Unmarshal(c.prev, &prev)
+		}
+		if _, err := coll.runHooks(point, doc, prev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
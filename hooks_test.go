@@ -0,0 +1,168 @@
+package arnedb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	_ = os.RemoveAll("testdb/hooksdb")
+
+	pDb, err := Open("testdb", "hooksdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	coll, err := pDb.CreateColl("stamped")
+	if err != nil {
+		t.Fatal("Create stamped failed with:", err)
+	}
+
+	var audit []HookPoint
+	errProtected := errors.New("protected record")
+
+	// Veritabanı hook'ları kolleksiyon hook'larından önce çalışır
+	pDb.AddHook(BeforeInsert, func(e *HookEvent) error {
+		e.Doc["createdAt"] = "now"
+		return nil
+	})
+	coll.AddHook(BeforeInsert, func(e *HookEvent) error {
+		if e.Doc["createdAt"] != "now" {
+			t.Error("Database hook is not invoked before collection hook")
+		}
+		if e.Doc["id"] == nil {
+			return errors.New("id is required")
+		}
+		return nil
+	})
+	coll.AddHook(BeforeUpdate, func(e *HookEvent) error {
+		e.Doc["updatedAt"] = "later"
+		if e.Prev["updatedAt"] != nil {
+			t.Error("Previous version is altered")
+		}
+		return nil
+	})
+	coll.AddHook(BeforeDelete, func(e *HookEvent) error {
+		if e.Doc["protected"] == true {
+			return errProtected
+		}
+		return nil
+	})
+	coll.AddHook(AfterRead, func(e *HookEvent) error {
+		e.Doc["read"] = true
+		return nil
+	})
+	for _, point := range []HookPoint{AfterInsert, AfterUpdate, AfterReplace, AfterDelete} {
+		p := point
+		coll.AddHook(p, func(e *HookEvent) error {
+			audit = append(audit, p)
+			return nil
+		})
+	}
+
+	if err = coll.Add(RecordInstance{"name": "no id"}); err == nil {
+		t.Error("BeforeInsert veto is not returned")
+	}
+	if _, err = coll.AddAll(RecordInstance{"id": 1}, RecordInstance{"name": "no id"}); err == nil {
+		t.Error("BeforeInsert veto is not returned by AddAll")
+	}
+	if n, _ := coll.Count(func(instance RecordInstance) bool { return true }); n != 0 {
+		t.Errorf("Vetoed records are written: %d", n)
+	}
+
+	if err = coll.Add(RecordInstance{"id": 1}); err != nil {
+		t.Fatal("Add failed with:", err)
+	}
+	if _, err = coll.AddAll(RecordInstance{"id": 2, "protected": true}, RecordInstance{"id": 3}); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	_, err = coll.UpdateAll(func(instance RecordInstance) bool { return instance["id"].(float64) == 1 },
+		func(ptrRecord *RecordInstance) *RecordInstance { return ptrRecord })
+	if err != nil {
+		t.Fatal("UpdateAll failed with:", err)
+	}
+	_, err = coll.ReplaceFirst(func(instance RecordInstance) bool { return instance["id"].(float64) == 3 },
+		RecordInstance{"id": 3, "replaced": true})
+	if err != nil {
+		t.Fatal("ReplaceFirst failed with:", err)
+	}
+
+	_, err = coll.DeleteAll(func(instance RecordInstance) bool { return true })
+	if !errors.Is(err, errProtected) {
+		t.Error("BeforeDelete veto is not returned:", err)
+	}
+
+	rec, err := coll.GetFirst(func(instance RecordInstance) bool { return instance["id"].(float64) == 1 })
+	if err != nil || rec == nil {
+		t.Fatal("GetFirst failed with:", err)
+	}
+	if rec["createdAt"] != "now" || rec["updatedAt"] != "later" || rec["read"] != true {
+		t.Errorf("Hooks did not alter the document: %+v", rec)
+	}
+
+	type stamped struct {
+		Id   int
+		Read bool `json:"read"`
+	}
+	typed, err := GetAllAs[stamped](coll, func(i *stamped) bool { return !i.Read })
+	if err != nil {
+		t.Fatal("GetAllAs failed with:", err)
+	}
+	if len(typed) != 3 || !typed[0].Read {
+		t.Errorf("AfterRead hooks are not applied to typed queries: %+v", typed)
+	}
+
+	expected := []HookPoint{AfterInsert, AfterInsert, AfterInsert, AfterUpdate, AfterReplace}
+	if len(audit) != len(expected) {
+		t.Fatalf("After hooks mismatch: %v", audit)
+	}
+	for i := range expected {
+		if audit[i] != expected[i] {
+			t.Errorf("After hook %d expected %d, got %d", i, expected[i], audit[i])
+		}
+	}
+}
+
+func TestDeleteAllVetoInLaterChunk(t *testing.T) {
+	pDb, err := OpenInMemory("vetodb")
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	coll, _ := pDb.CreateColl("items")
+
+	// 12 x 100KB kayıt iki chunk'a yayılır, korunan kayıt son chunk'tadır
+	text := strings.Repeat("x", 100*1024)
+	for i := 0; i < 12; i++ {
+		if err = coll.Add(RecordInstance{"i": i, "text": text, "protected": i == 11}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	chunks, _ := coll.getChunks()
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	errProtected := errors.New("protected record")
+	coll.AddHook(BeforeDelete, func(e *HookEvent) error {
+		if e.Doc["protected"] == true {
+			return errProtected
+		}
+		return nil
+	})
+	notified := 0
+	coll.AddHook(AfterDelete, func(e *HookEvent) error {
+		notified++
+		return nil
+	})
+
+	n, err := coll.DeleteAll(func(instance RecordInstance) bool { return true })
+	if !errors.Is(err, errProtected) {
+		t.Fatal("BeforeDelete veto is not returned:", err)
+	}
+	left, _ := coll.Count(func(instance RecordInstance) bool { return true })
+	if n == 0 || n != 12-left || n != notified {
+		t.Errorf("DeleteAll reported %d deletions, %d records left, %d notified", n, left, notified)
+	}
+}
@@ -0,0 +1,380 @@
+package arnedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultImportBatchSize is the number of the documents written at once by the import functions
+const defaultImportBatchSize = 1000
+
+// ImportErrorPolicy decides what happens when a line cannot be imported.
+type ImportErrorPolicy int
+
+const (
+	// ImportAbort stops the import at the first failing line. The lines before it are imported.
+	ImportAbort ImportErrorPolicy = iota
+	// ImportSkip reports the failing lines and goes on with the next ones
+	ImportSkip
+)
+
+// ImportOptions configures ImportNDJSON and ImportCSV. The zero value is usable.
+type ImportOptions struct {
+	// BatchSize is the maximum number of the documents written at once. The default is 1000. Batches
+	// are also split at the chunk size, so imports roll over to new chunks like Add does.
+	BatchSize int
+	// OnError is the policy for the failing lines. The default is ImportAbort.
+	OnError ImportErrorPolicy
+	// MaxErrors stops an ImportSkip import after so many failing lines. Zero means no limit.
+	MaxErrors int
+
+	// Comma is the CSV field separator. The default is ','.
+	Comma rune
+	// Header gives the CSV column names if the input has no header line. Otherwise the first line
+	// is the header.
+	Header []string
+	// Fields maps the CSV column names to the field paths. Dotted paths create nested documents.
+	// Columns which are not in the map keep their names. A column mapped to "-" is not imported.
+	Fields map[string]string
+	// Types coerces the CSV columns, keyed by column name, to "string", "number", "int", "bool",
+	// "time" (RFC 3339) or "json". A value which cannot be coerced fails the line. Other columns are
+	// inferred: true and false become booleans, plain decimal numbers become numbers and everything
+	// else stays a string. Empty cells are left out of the document.
+	Types map[string]string
+	// NoInference keeps the CSV columns without a type as strings.
+	NoInference bool
+}
+
+// ImportError reports a line which cannot be imported.
+type ImportError struct {
+	// Line is the line number in the input starting from 1
+	Line int `json:"line"`
+	// Err describes the problem
+	Err string `json:"err"`
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// ImportResult is the summary of an import.
+type ImportResult struct {
+	// Imported is the number of the added documents
+	Imported int `json:"imported"`
+	// Skipped is the number of the failing lines which are skipped
+	Skipped int `json:"skipped"`
+	// Errors are the failing lines
+	Errors []ImportError `json:"errors"`
+}
+
+// importer collects the parsed documents into batches and writes them
+type importer struct {
+	coll   *Coll
+	opts   ImportOptions
+	result ImportResult
+	batch  [][]byte // Yazılmayı bekleyen hazır kayıtlar
+}
+
+// ImportNDJSON function adds the documents read from r, one JSON document per line. Blank lines
+// are skipped. Documents go through the hooks and the schema like Add. It returns the summary even if
+// the import stops with an error.
+func (coll *Coll) ImportNDJSON(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if err := coll.db.checkWritable("ImportNDJSON"); err != nil {
+		return nil, err
+	}
+
+	imp := newImporter(coll, opts)
+	reader := bufio.NewReader(r)
+	for lineNr := 1; ; lineNr++ {
+		line, readErr := reader.ReadBytes(recordSepChar)
+		if readErr != nil && readErr != io.EOF {
+			return imp.finish(readErr)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var data RecordInstance
+			if err := json.Unmarshal(line, &data); err != nil || data == nil {
+				msg := "line is not a JSON document"
+				if err != nil {
+					msg = fmt.Sprintf("invalid JSON: %s", err.Error())
+				}
+				if err = imp.fail(lineNr, msg); err != nil {
+					return imp.finish(err)
+				}
+			} else if err = imp.add(lineNr, data); err != nil {
+				return imp.finish(err)
+			}
+		}
+
+		if readErr == io.EOF {
+			return imp.finish(nil)
+		}
+	}
+}
+
+// ImportCSV function adds the rows read from r as documents. Column names come from the header line
+// or from opts.Header and are mapped to the fields by opts.Fields. Values are coerced or inferred as
+// described in ImportOptions. Documents go through the hooks and the schema like Add. It returns the
+// summary even if the import stops with an error.
+func (coll *Coll) ImportCSV(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if err := coll.db.checkWritable("ImportCSV"); err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	reader.FieldsPerRecord = -1 // sütun sayısı satır bazında kontrol edilir
+
+	header := opts.Header
+	if len(header) == 0 {
+		first, err := reader.Read()
+		if err == io.EOF {
+			return &ImportResult{Errors: make([]ImportError, 0)}, nil
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("cannot read the header: %s", err.Error()))
+		}
+		header = append([]string{}, first...)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")) // Excel BOM'u
+	}
+	for column, typeName := range opts.Types {
+		if !cellTypes[typeName] {
+			return nil, errors.New(fmt.Sprintf("invalid type for column %s: %s", column, typeName))
+		}
+	}
+
+	imp := newImporter(coll, opts)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return imp.finish(nil)
+		}
+
+		if err != nil {
+			// Hatalı satırda alan konumu yoktur, satır numarası hatadan alınır
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return imp.finish(err)
+			}
+			if err = imp.fail(parseErr.StartLine, parseErr.Err.Error()); err != nil {
+				return imp.finish(err)
+			}
+			continue
+		}
+
+		lineNr, _ := reader.FieldPos(0)
+
+		data, err := csvDocument(header, row, opts)
+		if err != nil {
+			err = imp.fail(lineNr, err.Error())
+		} else if len(data) > 0 {
+			err = imp.add(lineNr, data)
+		}
+		if err != nil {
+			return imp.finish(err)
+		}
+	}
+}
+
+func newImporter(coll *Coll, opts ImportOptions) *importer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+	return &importer{coll: coll, opts: opts, result: ImportResult{Errors: make([]ImportError, 0)}}
+}
+
+// add prepares a document like Add does and puts it into the batch. The batch is written when it is
+// full. A rejected document fails the line.
+func (imp *importer) add(line int, data RecordInstance) error {
+	coll := imp.coll
+	payload, err := coll.codec().Marshal(data)
+	if err == nil {
+		coll.mu.Lock()
+		payload, err = coll.prepareWrite(BeforeInsert, payload, nil)
+		coll.mu.Unlock()
+	}
+	if err != nil {
+		return imp.fail(line, err.Error())
+	}
+
+	imp.batch = append(imp.batch, payload)
+	if len(imp.batch) >= imp.opts.BatchSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+// fail records a failing line. It returns an error if the import must stop. The documents before
+// the line are written first.
+func (imp *importer) fail(line int, msg string) error {
+	importErr := ImportError{Line: line, Err: msg}
+	imp.result.Errors = append(imp.result.Errors, importErr)
+	if imp.opts.OnError == ImportSkip {
+		imp.result.Skipped++
+		if imp.opts.MaxErrors <= 0 || len(imp.result.Errors) < imp.opts.MaxErrors {
+			return nil
+		}
+		if err := imp.flush(); err != nil {
+			return err
+		}
+		return errors.New(fmt.Sprintf("import stopped after %d errors", len(imp.result.Errors)))
+	}
+
+	if err := imp.flush(); err != nil {
+		return err
+	}
+	return &importErr
+}
+
+// finish writes the last batch and returns the result
+func (imp *importer) finish(err error) (*ImportResult, error) {
+	if err == nil {
+		err = imp.flush()
+	}
+	return &imp.result, err
+}
+
+// flush appends the batch. Records are split at the chunk limits like AddAll does, so the imports
+// roll over to new chunks and capped collections stay in their limits.
+func (imp *importer) flush() error {
+	payloads := imp.batch
+	imp.batch = imp.batch[:0]
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	coll := imp.coll
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	lastChunk, err := coll.createChunk()
+	if err != nil {
+		return err
+	}
+	added, err := coll.appendRecords(lastChunk, payloads)
+	imp.result.Imported += added
+	return err
+}
+
+// errEmptyCell marks an empty CSV cell, it is left out of the document
+var errEmptyCell = errors.New("empty cell")
+
+// plainNumber matches the numbers inferred from CSV cells. Numbers with leading zeros like zip codes
+// stay strings.
+var plainNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// csvDocument builds the document of a CSV row
+func csvDocument(header, row []string, opts ImportOptions) (RecordInstance, error) {
+	if len(row) > len(header) {
+		return nil, errors.New(fmt.Sprintf("row has %d fields, header has %d", len(row), len(header)))
+	}
+
+	data := make(RecordInstance)
+	for i, cell := range row {
+		column := header[i]
+		field := column
+		if mapped, found := opts.Fields[column]; found {
+			field = mapped
+		}
+		if field == "-" || field == "" {
+			continue
+		}
+
+		var value interface{}
+		var err error
+		if typeName, found := opts.Types[column]; found {
+			value, err = coerceCell(cell, typeName)
+		} else if opts.NoInference {
+			value, err = coerceCell(cell, "string")
+		} else {
+			value, err = inferCell(cell)
+		}
+		if err == errEmptyCell {
+			continue
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("column %s: %s", column, err.Error()))
+		}
+		setField(data, field, value)
+	}
+	return data, nil
+}
+
+// inferCell guesses the type of a cell
+func inferCell(cell string) (interface{}, error) {
+	trimmed := strings.TrimSpace(cell)
+	switch {
+	case trimmed == "":
+		return nil, errEmptyCell
+	case trimmed == "true" || trimmed == "false":
+		return trimmed == "true", nil
+	case plainNumber.MatchString(trimmed):
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return f, nil
+		}
+	}
+	return cell, nil
+}
+
+// cellTypes are the types known by coerceCell
+var cellTypes = map[string]bool{"string": true, "number": true, "int": true, "bool": true, "time": true, "json": true}
+
+// coerceCell converts a cell to the given type
+func coerceCell(cell, typeName string) (interface{}, error) {
+	if !cellTypes[typeName] {
+		return nil, errors.New(fmt.Sprintf("unknown type: %s", typeName))
+	}
+	trimmed := strings.TrimSpace(cell)
+	if trimmed == "" {
+		return nil, errEmptyCell
+	}
+
+	switch typeName {
+	case "string":
+		return cell, nil
+	case "number":
+		f, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("not a number: %q", cell))
+		}
+		return f, nil
+	case "int":
+		i, err := strconv.ParseInt(trimmed, 10, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("not an integer: %q", cell))
+		}
+		return i, nil
+	case "bool":
+		b, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("not a boolean: %q", cell))
+		}
+		return b, nil
+	case "time":
+		t, err := time.Parse(time.RFC3339Nano, trimmed)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("not an RFC 3339 time: %q", cell))
+		}
+		return t.Format(time.RFC3339Nano), nil
+	case "json":
+		var value interface{}
+		if err := json.Unmarshal([]byte(trimmed), &value); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid JSON: %s", err.Error()))
+		}
+		return value, nil
+	}
+	return nil, errors.New(fmt.Sprintf("unknown type: %s", typeName))
+}
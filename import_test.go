@@ -0,0 +1,176 @@
+package arnedb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestImportNDJSON(t *testing.T) {
+	_ = os.RemoveAll("testdb/importdb")
+
+	pDb, err := Open("testdb", "importdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	people, err := pDb.CreateColl("people")
+	if err != nil {
+		t.Fatal("Create people failed with:", err)
+	}
+	if err = people.SetSchema([]byte(`{"type": "object", "required": ["id"]}`)); err != nil {
+		t.Fatal("SetSchema failed with:", err)
+	}
+
+	input := `{"id": 1, "name": "Ada"}
+
+{"id": 2, "name": "Linus"}
+{broken
+{"name": "no id"}
+[1, 2]
+{"id": 3, "name": "Grace"}`
+
+	result, err := people.ImportNDJSON(strings.NewReader(input), ImportOptions{OnError: ImportSkip, BatchSize: 2})
+	if err != nil {
+		t.Fatal("ImportNDJSON failed with:", err)
+	}
+	if result.Imported != 3 || result.Skipped != 3 || len(result.Errors) != 3 {
+		t.Errorf("ImportNDJSON unexpected result: %+v", result)
+	}
+	for i, line := range []int{4, 5, 6} {
+		if i < len(result.Errors) && result.Errors[i].Line != line {
+			t.Errorf("error %d expected on line %d, got %+v", i, line, result.Errors[i])
+		}
+	}
+
+	// Hata durumunda durulur, öncesi eklenir
+	result, err = people.ImportNDJSON(strings.NewReader(input), ImportOptions{})
+	if err == nil || result.Imported != 2 || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("ImportNDJSON with abort unexpected result: %+v %v", result, err)
+	}
+	if _, isImportErr := err.(*ImportError); !isImportErr {
+		t.Errorf("abort expected to return an *ImportError, got %T", err)
+	}
+	result, err = people.ImportNDJSON(strings.NewReader(input), ImportOptions{OnError: ImportSkip, MaxErrors: 2})
+	if err == nil || result.Imported != 2 || len(result.Errors) != 2 {
+		t.Errorf("ImportNDJSON with max errors unexpected result: %+v %v", result, err)
+	}
+	if n, _ := people.Count(func(RecordInstance) bool { return true }); n != 7 {
+		t.Error("expected 7 documents after the imports, got:", n)
+	}
+
+	// Büyük içe aktarmalar chunk sınırında yeni chunk'a geçer
+	var big strings.Builder
+	padding := strings.Repeat("x", 1000)
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&big, "{\"id\": %d, \"pad\": %q}\n", i, padding)
+	}
+	logs, _ := pDb.CreateColl("logs")
+	if result, err = logs.ImportNDJSON(strings.NewReader(big.String()), ImportOptions{BatchSize: 5000}); err != nil || result.Imported != 3000 {
+		t.Fatal("big ImportNDJSON unexpected result:", result, err)
+	}
+	chunks, _ := logs.getChunks()
+	if len(chunks) < 3 {
+		t.Error("big import expected to roll over chunks, got:", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if chunk.Size() > maxChunkSize+1100 {
+			t.Errorf("chunk %s is larger than the limit: %d", chunk.Name(), chunk.Size())
+		}
+	}
+
+	// Sınırlı kolleksiyonda chunk başına kayıt sınırı uygulanır
+	capped, _ := pDb.CreateColl("capped", WithCap(10, 0))
+	var small strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&small, "{\"id\": %d}\n", i)
+	}
+	if result, err = capped.ImportNDJSON(strings.NewReader(small.String()), ImportOptions{}); err != nil || result.Imported != 50 {
+		t.Fatal("capped ImportNDJSON unexpected result:", result, err)
+	}
+	if n, _ := capped.Count(func(RecordInstance) bool { return true }); n < 8 || n > 10 {
+		t.Errorf("capped collection has %d documents after the import", n)
+	}
+
+	_ = os.RemoveAll("testdb/importdb")
+}
+
+func TestImportCSV(t *testing.T) {
+	_ = os.RemoveAll("testdb/importcsvdb")
+
+	pDb, err := Open("testdb", "importcsvdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	people, err := pDb.CreateColl("people")
+	if err != nil {
+		t.Fatal("Create people failed with:", err)
+	}
+
+	input := "\ufeffid;name;zip;active;city;score;tags;secret\n" +
+		"1;Ada;06000;true;Ankara;12.5;\"[\"\"a\"\"]\";x\n" +
+		"2;Linus;;false;;7;[];x\n" +
+		"3;Grace;34000;yes;İstanbul;n/a;[];x\n" +
+		"4;Ken;35000;true;İzmir;3;;x;extra\n" +
+		"5;\"Den\"\"nis\";16000;false;Bursa;1e2;{};x\n"
+
+	opts := ImportOptions{
+		Comma:   ';',
+		OnError: ImportSkip,
+		Fields:  map[string]string{"city": "address.city", "zip": "address.zip", "secret": "-"},
+		Types:   map[string]string{"id": "int", "zip": "string", "score": "number", "tags": "json"},
+	}
+	result, err := people.ImportCSV(strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatal("ImportCSV failed with:", err)
+	}
+	if result.Imported != 3 || result.Skipped != 2 {
+		t.Errorf("ImportCSV unexpected result: %+v", result)
+	}
+	if len(result.Errors) == 2 && (result.Errors[0].Line != 4 || result.Errors[1].Line != 5) {
+		t.Errorf("ImportCSV unexpected error lines: %+v", result.Errors)
+	}
+
+	ada, _ := people.GetFirst(func(i RecordInstance) bool { return i["id"] == 1.0 })
+	address, _ := ada["address"].(map[string]interface{})
+	if ada == nil || address == nil || address["zip"] != "06000" || address["city"] != "Ankara" ||
+		ada["active"] != true || ada["score"] != 12.5 || ada["secret"] != nil {
+		t.Errorf("ImportCSV unexpected document: %v", ada)
+	}
+	linus, _ := people.GetFirst(func(i RecordInstance) bool { return i["id"] == 2.0 })
+	if _, found := linus["address"]; found || linus["active"] != false {
+		t.Errorf("empty cells expected to be left out: %v", linus)
+	}
+	dennis, _ := people.GetFirst(func(i RecordInstance) bool { return i["id"] == 5.0 })
+	if dennis["name"] != `Den"nis` || dennis["score"] != 100.0 {
+		t.Errorf("ImportCSV unexpected document: %v", dennis)
+	}
+
+	// Başlıksız girdi ve bilinmeyen tip
+	noHeader := ImportOptions{Header: []string{"id", "code"}, NoInference: true}
+	if result, err = people.ImportCSV(strings.NewReader("10,0x1\n"), noHeader); err != nil || result.Imported != 1 {
+		t.Error("ImportCSV with a header option unexpected result:", result, err)
+	}
+	if n, _ := people.Count(func(i RecordInstance) bool { return i["id"] == "10" && i["code"] == "0x1" }); n != 1 {
+		t.Error("NoInference expected to keep strings")
+	}
+
+	// Bozuk satır atlanır, satır numarası raporlanır
+	malformed := "x,y\na\"b,c\n1,2\n"
+	result, err = people.ImportCSV(strings.NewReader(malformed), ImportOptions{OnError: ImportSkip})
+	if err != nil || result.Imported != 1 || len(result.Errors) != 1 || result.Errors[0].Line != 2 {
+		t.Errorf("ImportCSV with a malformed row unexpected result: %+v %v", result, err)
+	}
+	result, err = people.ImportCSV(strings.NewReader(malformed), ImportOptions{OnError: ImportSkip, Header: []string{"x", "y"}})
+	if err != nil || result.Imported != 2 || len(result.Errors) != 1 || result.Errors[0].Line != 2 {
+		t.Errorf("ImportCSV with a malformed row and a header option unexpected result: %+v %v", result, err)
+	}
+	if _, err = people.ImportCSV(strings.NewReader(malformed), ImportOptions{}); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Error("ImportCSV with a malformed row expected to abort on line 2, got:", err)
+	}
+	if _, err = people.ImportCSV(strings.NewReader("a\n1\n"), ImportOptions{Types: map[string]string{"a": "uuid"}}); err == nil {
+		t.Error("ImportCSV with an unknown type expected to fail")
+	}
+
+	_ = os.RemoveAll("testdb/importcsvdb")
+}
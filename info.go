@@ -0,0 +1,292 @@
+package arnedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// infoFileName is the file keeping the statistics of a collection
+const infoFileName = "info.json"
+
+// statsSaveEvery is the number of changes after which the statistics are written
+const statsSaveEvery = 100
+
+// ChunkInfo describes a single chunk of a collection.
+type ChunkInfo struct {
+	// Name is the file name of the chunk
+	Name string `json:"name"`
+	// Live is the number of the documents in the chunk
+	Live int `json:"live"`
+	// Dead is the number of the blank lines left by the deleted documents
+	Dead int `json:"dead"`
+	// Bytes is the size of the chunk in the storage
+	Bytes int64 `json:"bytes"`
+}
+
+// CollInfo describes a collection. It is returned by Coll.Info.
+type CollInfo struct {
+	// Name is the collection name
+	Name string `json:"name"`
+	// Docs is the number of the documents. Expired documents are counted until they are removed.
+	Docs int `json:"docs"`
+	// DeadLines is the number of the blank lines left by the deleted documents
+	DeadLines int `json:"deadLines"`
+	// Bytes is the total size of the chunks
+	Bytes int64 `json:"bytes"`
+	// Chunks are the chunks of the collection in order
+	Chunks []ChunkInfo `json:"chunks"`
+	// Created is the creation time of the collection. It is the time of the oldest chunk for the
+	// collections created by the older versions.
+	Created time.Time `json:"created"`
+	// Modified is the time of the last change
+	Modified time.Time `json:"modified"`
+}
+
+// DBInfo describes a database. It is returned by ArneDB.Info.
+type DBInfo struct {
+	// Name is the database name
+	Name string `json:"name"`
+	// Docs is the number of the documents in all the collections
+	Docs int `json:"docs"`
+	// Bytes is the total size of the chunks of all the collections
+	Bytes int64 `json:"bytes"`
+	// Colls are the collections sorted by name
+	Colls []CollInfo `json:"colls"`
+	// Modified is the time of the last change
+	Modified time.Time `json:"modified"`
+}
+
+// Info function returns the document count, the chunk sizes and the change times of the
+// collection. The statistics are maintained while the collection changes and kept in the collection
+// directory, so only the chunks changed by other programs are scanned. They are written after every
+// 100 changes and when the database is closed. Chunks changed after the last write are scanned again.
+func (coll *Coll) Info() (*CollInfo, error) {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	if err := coll.loadStats(); err != nil {
+		return nil, err
+	}
+
+	info := CollInfo{
+		Name:     coll.GetName(),
+		Chunks:   make([]ChunkInfo, 0, len(coll.stats.Chunks)),
+		Created:  coll.stats.Created,
+		Modified: coll.stats.Modified,
+	}
+	for name, cs := range coll.stats.Chunks {
+		info.Chunks = append(info.Chunks, ChunkInfo{Name: name, Live: cs.Live, Dead: cs.Dead, Bytes: cs.Bytes})
+		info.Docs += cs.Live
+		info.DeadLines += cs.Dead
+		info.Bytes += cs.Bytes
+	}
+	sort.Slice(info.Chunks, func(i, j int) bool {
+		return chunkNumber(info.Chunks[i].Name) < chunkNumber(info.Chunks[j].Name)
+	})
+	return &info, nil
+}
+
+// Info function returns the information of all the collections and the totals of the database.
+func (db *ArneDB) Info() (*DBInfo, error) {
+	db.collsMu.RLock()
+	colls := make([]*Coll, 0, len(db.colls))
+	for _, c := range db.colls {
+		colls = append(colls, c)
+	}
+	db.collsMu.RUnlock()
+	sort.Slice(colls, func(i, j int) bool { return colls[i].GetName() < colls[j].GetName() })
+
+	info := DBInfo{Name: db.Name, Colls: make([]CollInfo, 0, len(colls))}
+	for _, c := range colls {
+		ci, err := c.Info()
+		if err != nil {
+			return nil, err
+		}
+		info.Colls = append(info.Colls, *ci)
+		info.Docs += ci.Docs
+		info.Bytes += ci.Bytes
+		if ci.Modified.After(info.Modified) {
+			info.Modified = ci.Modified
+		}
+	}
+	return &info, nil
+}
+
+// collStats is the persisted statistics of a collection
+type collStats struct {
+	Created  time.Time              `json:"created"`
+	Modified time.Time              `json:"modified"`
+	Chunks   map[string]*chunkStats `json:"chunks"`
+}
+
+type chunkStats struct {
+	Live  int   `json:"live"`
+	Dead  int   `json:"dead"`
+	Bytes int64 `json:"bytes"`
+}
+
+// loadStats loads the statistics of the collection if they are not loaded. Chunks whose sizes
+// differ from the stored ones are scanned again. The caller must hold the lock of the collection.
+func (coll *Coll) loadStats() error {
+	if coll.stats != nil {
+		return nil
+	}
+
+	stats := collStats{Chunks: make(map[string]*chunkStats)}
+	content, err := readStorageFile(coll.db.storage, coll.GetName(), infoFileName)
+	if err == nil {
+		if json.Unmarshal(content, &stats) != nil || stats.Chunks == nil {
+			stats = collStats{Chunks: make(map[string]*chunkStats)} // bozuk dosya yeniden oluşturulur
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return errors.New(fmt.Sprintf("cannot read info of %s: %s", coll.GetName(), err.Error()))
+	}
+
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return err
+	}
+	changed := len(chunks) != len(stats.Chunks)
+	current := make(map[string]*chunkStats, len(chunks))
+	for _, chunk := range chunks {
+		if stats.Created.IsZero() || chunk.ModTime().Before(stats.Created) {
+			stats.Created = chunk.ModTime()
+		}
+		if chunk.ModTime().After(stats.Modified) {
+			stats.Modified = chunk.ModTime()
+		}
+
+		cs, found := stats.Chunks[chunk.Name()]
+		if !found || cs.Bytes != chunk.Size() {
+			// Başka bir program değiştirmiş, chunk yeniden sayılır
+			if cs, err = coll.scanChunkStats(chunk.Name()); err != nil {
+				return err
+			}
+			cs.Bytes = chunk.Size()
+			changed = true
+		}
+		current[chunk.Name()] = cs
+	}
+	stats.Chunks = current
+	if stats.Created.IsZero() {
+		stats.Created = time.Now()
+	}
+
+	coll.stats = &stats
+	coll.statsDirty = 0
+	if changed {
+		coll.saveStats()
+	}
+	return nil
+}
+
+// scanChunkStats counts the documents and blank lines of a chunk
+func (coll *Coll) scanChunkStats(name string) (*chunkStats, error) {
+	r, err := coll.openChunk(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot read chunk %s: %s", name, err.Error()))
+	}
+	var cs chunkStats
+	cs.Live, cs.Dead = countLines(content)
+	return &cs, nil
+}
+
+// saveStats writes the statistics. Statistics can be rebuilt, so errors are ignored.
+func (coll *Coll) saveStats() {
+	if coll.stats == nil || coll.db.readOnly {
+		return
+	}
+	content, err := json.Marshal(coll.stats)
+	if err == nil {
+		_ = coll.db.storage.Replace(coll.GetName(), infoFileName, content)
+	}
+	coll.statsDirty = 0
+}
+
+// statsChanged marks the statistics as changed and writes them after every statsSaveEvery changes.
+// Unwritten statistics are rebuilt from the chunks whose sizes differ.
+func (coll *Coll) statsChanged() {
+	coll.stats.Modified = time.Now()
+	if coll.statsDirty++; coll.statsDirty >= statsSaveEvery {
+		coll.saveStats()
+	}
+}
+
+// flushStats writes the changed statistics. The caller must hold the lock of the collection.
+func (coll *Coll) flushStats() {
+	if coll.statsDirty > 0 {
+		coll.saveStats()
+	}
+}
+
+// chunkAppended updates the statistics after records are appended to a chunk. The caller must hold
+// the lock of the collection.
+func (coll *Coll) chunkAppended(name string, docs int, size int) {
+	if coll.stats == nil {
+		return // Yüklenirken değişen chunk'lar yeniden sayılır
+	}
+
+	cs, found := coll.stats.Chunks[name]
+	if !found {
+		cs = &chunkStats{}
+		coll.stats.Chunks[name] = cs
+	}
+	cs.Live += docs
+	cs.Bytes += int64(size)
+	coll.statsChanged()
+}
+
+// chunkWritten updates the statistics after a chunk is replaced with the content. The caller must
+// hold the lock of the collection.
+func (coll *Coll) chunkWritten(name string, content []byte, size int) {
+	if coll.stats == nil {
+		return // Yüklenirken değişen chunk'lar yeniden sayılır
+	}
+
+	cs := &chunkStats{Bytes: int64(size)}
+	cs.Live, cs.Dead = countLines(content)
+	coll.stats.Chunks[name] = cs
+	coll.statsChanged()
+}
+
+// chunkRemoved updates the statistics after a chunk is removed. The caller must hold the lock of the
+// collection.
+func (coll *Coll) chunkRemoved(name string) {
+	if coll.stats == nil {
+		return // Yüklenirken değişen chunk'lar yeniden sayılır
+	}
+
+	delete(coll.stats.Chunks, name)
+	coll.statsChanged()
+}
+
+// countLines counts the records and the blank lines of the chunk content
+func countLines(content []byte) (live, dead int) {
+	for len(content) > 0 {
+		line := content
+		i := bytes.IndexByte(content, recordSepChar)
+		if i >= 0 {
+			line, content = content[:i], content[i+1:]
+		} else {
+			content = nil
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			dead++
+		} else {
+			live++
+		}
+	}
+	return live, dead
+}
@@ -0,0 +1,173 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	_ = os.RemoveAll("testdb/infodb")
+
+	pDb, err := Open("testdb", "infodb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	items, err := pDb.CreateColl("items")
+	if err != nil {
+		t.Fatal("Create items failed with:", err)
+	}
+
+	info, err := items.Info()
+	if err != nil {
+		t.Fatal("Info failed with:", err)
+	}
+	if info.Docs != 0 || len(info.Chunks) != 0 || info.Created.IsZero() {
+		t.Errorf("Info of an empty collection is wrong: %+v", info)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err = items.Add(RecordInstance{"id": i}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	batch := make([]RecordInstance, 0)
+	for i := 5; i < 10; i++ {
+		batch = append(batch, RecordInstance{"id": i})
+	}
+	if _, err = items.AddAll(batch...); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+	if _, err = items.DeleteAll(func(i RecordInstance) bool { return i["id"].(float64) < 3 }); err != nil {
+		t.Fatal("DeleteAll failed with:", err)
+	}
+	if _, err = items.UpdateAll(func(i RecordInstance) bool { return i["id"].(float64) > 7 },
+		func(i *RecordInstance) *RecordInstance { (*i)["big"] = "yes"; return i }); err != nil {
+		t.Fatal("UpdateAll failed with:", err)
+	}
+
+	checkInfo := func(stage string, docs, dead int) {
+		info, err := items.Info()
+		if err != nil {
+			t.Fatalf("%s: Info failed with: %s", stage, err)
+		}
+		if info.Docs != docs || info.DeadLines != dead || len(info.Chunks) != 1 {
+			t.Errorf("%s: Info expected %d docs and %d dead lines, got %+v", stage, docs, dead, info)
+		}
+		fi, err := os.Stat("testdb/infodb/items/00.json")
+		if err != nil || info.Bytes != fi.Size() || info.Chunks[0].Bytes != fi.Size() {
+			t.Errorf("%s: Info bytes %d do not match the chunk: %v %v", stage, info.Bytes, fi, err)
+		}
+		if info.Modified.Before(info.Created) {
+			t.Errorf("%s: Info times are wrong: %+v", stage, info)
+		}
+	}
+	checkInfo("after changes", 7, 3)
+
+	// Kaydedilen istatistikler yeniden açınca okunur
+	pDb, err = Open("testdb", "infodb")
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	items = pDb.GetColl("items")
+	checkInfo("after reopen", 7, 3)
+
+	// Dışarıdan değiştirilen chunk yeniden sayılır
+	f, err := os.OpenFile("testdb/infodb/items/00.json", os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal("OpenFile failed with:", err)
+	}
+	_, _ = f.WriteString("{\"id\":100}\n\n")
+	_ = f.Close()
+	pDb, _ = Open("testdb", "infodb")
+	items = pDb.GetColl("items")
+	checkInfo("after external change", 8, 4)
+
+	// İstatistik dosyası yoksa yeniden oluşturulur
+	if err = os.Remove("testdb/infodb/items/" + infoFileName); err != nil {
+		t.Fatal("Remove info failed with:", err)
+	}
+	pDb, _ = Open("testdb", "infodb")
+	items = pDb.GetColl("items")
+	checkInfo("after rebuild", 8, 4)
+	if _, err = os.Stat("testdb/infodb/items/" + infoFileName); err != nil {
+		t.Error("rebuilt info is not saved:", err)
+	}
+
+	capped, err := pDb.CreateColl("capped", WithCap(8, 0))
+	if err != nil {
+		t.Fatal("Create capped failed with:", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err = capped.Add(RecordInstance{"id": i}); err != nil {
+			t.Fatal("Add capped failed with:", err)
+		}
+	}
+	cinfo, err := capped.Info()
+	if err != nil {
+		t.Fatal("Info capped failed with:", err)
+	}
+	n, _ := capped.Count(func(RecordInstance) bool { return true })
+	chunks, _ := capped.getChunks()
+	if cinfo.Docs != n || len(cinfo.Chunks) != len(chunks) {
+		t.Errorf("capped Info expected %d docs in %d chunks, got %+v", n, len(chunks), cinfo)
+	}
+
+	dbInfo, err := pDb.Info()
+	if err != nil {
+		t.Fatal("db Info failed with:", err)
+	}
+	if len(dbInfo.Colls) != 2 || dbInfo.Colls[0].Name != "capped" || dbInfo.Docs != 8+n {
+		t.Errorf("db Info is wrong: %+v", dbInfo)
+	}
+}
+
+func TestInfoSavedLazily(t *testing.T) {
+	_ = os.RemoveAll("testdb/infolazydb")
+
+	pDb, err := Open("testdb", "infolazydb", WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	items, _ := pDb.CreateColl("items")
+
+	savedDocs := func() int {
+		var stats collStats
+		content, _ := os.ReadFile("testdb/infolazydb/items/" + infoFileName)
+		_ = json.Unmarshal(content, &stats)
+		n := 0
+		for _, cs := range stats.Chunks {
+			n += cs.Live
+		}
+		return n
+	}
+
+	for i := 0; i < 5; i++ {
+		_ = items.Add(RecordInstance{"id": i})
+	}
+	if n := savedDocs(); n != 0 {
+		t.Errorf("statistics expected to be written later, saved %d docs", n)
+	}
+	_ = pDb.Close()
+	if n := savedDocs(); n != 5 {
+		t.Errorf("Close expected to write the statistics, saved %d docs", n)
+	}
+
+	// Kapatılmadan bırakılan değişiklikler yeniden sayılır
+	pDb, _ = Open("testdb", "infolazydb", WithSweepInterval(0))
+	items = pDb.GetColl("items")
+	_, _ = items.Info() // istatistikler yüklenir
+	for i := 0; i < statsSaveEvery+3; i++ {
+		_ = items.Add(RecordInstance{"id": i})
+	}
+	if n := savedDocs(); n < statsSaveEvery {
+		t.Errorf("statistics expected to be written after %d changes, saved %d docs", statsSaveEvery, n)
+	}
+	pDb, _ = Open("testdb", "infolazydb", WithSweepInterval(0))
+	info, err := pDb.GetColl("items").Info()
+	if err != nil || info.Docs != statsSaveEvery+8 {
+		t.Errorf("unsaved statistics expected to be rebuilt, got %+v %v", info, err)
+	}
+
+	_ = os.RemoveAll("testdb/infolazydb")
+}
@@ -0,0 +1,136 @@
+package arnedb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Compact function removes the blank lines left by the deleted documents and returns the count of
+// the removed lines. Empty chunks are removed except the last one. Documents are not changed, so no
+// change events are sent.
+func (coll *Coll) Compact() (n int, err error) {
+	if err = coll.db.checkWritable("Compact"); err != nil {
+		return 0, err
+	}
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, chunk := range chunks {
+		content, err := coll.readChunk(chunk.Name())
+		if err != nil {
+			return n, err
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		var buffer bytes.Buffer
+		removed := 0
+		for _, line := range bytes.Split(content, []byte(recordSepStr)) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				removed++
+				continue
+			}
+			buffer.Write(line)
+			buffer.WriteString(recordSepStr)
+		}
+		if len(content) > 0 && content[len(content)-1] == recordSepChar {
+			removed-- // son satır sonu boş satır değildir
+		}
+		if removed <= 0 {
+			continue
+		}
+
+		if buffer.Len() == 0 && i < len(chunks)-1 {
+			err = coll.db.storage.Remove(coll.GetName(), chunk.Name())
+			coll.db.cache.invalidate(coll.GetName(), chunk.Name())
+			if err != nil {
+				return n, errors.New(fmt.Sprintf("cannot remove chunk %s: %s", chunk.Name(), err.Error()))
+			}
+			coll.chunkRemoved(chunk.Name())
+		} else if err = coll.writeChunk(chunk.Name(), buffer.Bytes()); err != nil {
+			return n, err
+		}
+		n += removed
+	}
+
+	return n, nil
+}
+
+// VerifyIssue is a problem found by Verify.
+type VerifyIssue struct {
+	// Chunk is the file name of the chunk
+	Chunk string `json:"chunk"`
+	// Line is the line number in the chunk. It is zero if the whole chunk cannot be read.
+	Line int `json:"line,omitempty"`
+	// Err describes the problem
+	Err string `json:"err"`
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	// Coll is the collection name
+	Coll string `json:"coll"`
+	// Chunks is the number of the chunks
+	Chunks int `json:"chunks"`
+	// Docs is the number of the documents which can be read
+	Docs int `json:"docs"`
+	// DeadLines is the number of the blank lines left by the deleted documents
+	DeadLines int `json:"deadLines"`
+	// Issues are the problems found. It is empty if the collection is healthy.
+	Issues []VerifyIssue `json:"issues"`
+}
+
+// Verify function reads every chunk of the collection and reports the chunks which cannot be read,
+// the lines which cannot be decoded and the documents which do not match the schema.
+func (coll *Coll) Verify() (*VerifyReport, error) {
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return nil, err
+	}
+
+	report := VerifyReport{Coll: coll.GetName(), Chunks: len(chunks), Issues: make([]VerifyIssue, 0)}
+	codec := coll.codec()
+	for _, chunk := range chunks {
+		f, err := coll.openChunk(chunk.Name())
+		if err != nil {
+			report.Issues = append(report.Issues, VerifyIssue{Chunk: chunk.Name(), Err: err.Error()})
+			continue
+		}
+
+		scn := newRecordScanner(f)
+		lineNr := 0
+		for scn.Scan() {
+			lineNr++
+			line := scn.Bytes()
+			if len(line) == 0 {
+				report.DeadLines++
+				continue
+			}
+
+			var data RecordInstance
+			if err = codec.Unmarshal(line, &data); err != nil {
+				report.Issues = append(report.Issues, VerifyIssue{Chunk: chunk.Name(), Line: lineNr,
+					Err: fmt.Sprintf("cannot decode document: %s", err.Error())})
+				continue
+			}
+			report.Docs++
+			if err = coll.validate(line); err != nil {
+				report.Issues = append(report.Issues, VerifyIssue{Chunk: chunk.Name(), Line: lineNr, Err: err.Error()})
+			}
+		}
+		if err = scn.Err(); err != nil {
+			report.Issues = append(report.Issues, VerifyIssue{Chunk: chunk.Name(), Line: lineNr + 1, Err: err.Error()})
+		}
+		_ = f.Close()
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,67 @@
+package arnedb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCompactAndVerify(t *testing.T) {
+	_ = os.RemoveAll("testdb/maintaindb")
+
+	pDb, err := Open("testdb", "maintaindb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	people, err := pDb.CreateColl("people")
+	if err != nil {
+		t.Fatal("Create people failed with:", err)
+	}
+	for i := 1; i <= 10; i++ {
+		if err = people.Add(RecordInstance{"id": i, "name": "Person"}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	deleted, err := people.DeleteAll(func(r RecordInstance) bool { return int(r["id"].(float64))%2 == 0 })
+	if err != nil || deleted != 5 {
+		t.Fatal("DeleteAll expected 5, got:", deleted, err)
+	}
+
+	report, err := people.Verify()
+	if err != nil {
+		t.Fatal("Verify failed with:", err)
+	}
+	if report.Docs != 5 || report.DeadLines != 5 || len(report.Issues) != 0 {
+		t.Errorf("Verify before compact unexpected report: %+v", report)
+	}
+
+	n, err := people.Compact()
+	if err != nil || n != 5 {
+		t.Error("Compact expected to remove 5 lines, got:", n, err)
+	}
+	if n, err = people.Compact(); err != nil || n != 0 {
+		t.Error("Second Compact expected to remove nothing, got:", n, err)
+	}
+	if count, _ := people.Count(func(RecordInstance) bool { return true }); count != 5 {
+		t.Error("Count after compact expected 5, got:", count)
+	}
+	if report, _ = people.Verify(); report.DeadLines != 0 || report.Docs != 5 {
+		t.Errorf("Verify after compact unexpected report: %+v", report)
+	}
+
+	// Şemaya uymayan ve bozuk kayıtlar raporlanır
+	if err = people.SetSchema([]byte(`{"type": "object", "required": ["email"]}`)); err != nil {
+		t.Fatal("SetSchema failed with:", err)
+	}
+	if err = pDb.storage.Append("people", "00.json", []byte("{broken\n")); err != nil {
+		t.Fatal("Append failed with:", err)
+	}
+	pDb.cache.invalidate("people", "00.json")
+	if report, err = people.Verify(); err != nil {
+		t.Fatal("Verify failed with:", err)
+	}
+	if len(report.Issues) != 6 || report.Issues[5].Line != 6 {
+		t.Errorf("Verify expected 6 issues, got: %+v", report.Issues)
+	}
+
+	_ = os.RemoveAll("testdb/maintaindb")
+}
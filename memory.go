@@ -0,0 +1,193 @@
+package arnedb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OpenInMemory function creates a database which is kept entirely in memory. Collections work
+// exactly like the ones on disk. The data is lost when the database is no longer referenced unless
+// it is saved with SaveTo.
+func OpenInMemory(dbName string, opts ...Option) (*ArneDB, error) {
+	return OpenStorage(dbName, NewMemStorage(), opts...)
+}
+
+// SaveTo function writes a copy of the database into baseDir. The copy can be opened with Open using
+// the same database name. An existing copy is replaced; it is kept aside until the new copy is in
+// place. Writes wait while the database is saved.
+func (db *ArneDB) SaveTo(baseDir string) error {
+	bfi, err := os.Stat(baseDir)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Basedir does not exist! : %s", err.Error()))
+	}
+	if !bfi.Mode().IsDir() {
+		return errors.New("base dir is not a dir")
+	}
+
+	colls, unlock := db.lockColls()
+	defer unlock()
+	for _, c := range colls {
+		c.flushStats() // kaydedilen info.json güncel olsun
+	}
+
+	// Önce geçici bir klasöre yazılır, sonra eski kopya ile yer değiştirilir.
+	dbPath := filepath.Join(baseDir, db.Name)
+	tmpPath := filepath.Join(baseDir, "."+db.Name+".tmp")
+	oldPath := filepath.Join(baseDir, "."+db.Name+".old")
+	_ = os.RemoveAll(tmpPath)
+	if err = os.Mkdir(tmpPath, 0700); err != nil {
+		return err
+	}
+	if err = copyStorage(db.storage, NewDirStorage(tmpPath)); err != nil {
+		_ = os.RemoveAll(tmpPath)
+		return errors.New(fmt.Sprintf("cannot save database: %s", err.Error()))
+	}
+
+	// Eski kopya silinmeden önce kenara alınır. Böylece diskte her an tam bir kopya bulunur.
+	_ = os.RemoveAll(oldPath)
+	hadOld := true
+	if err = os.Rename(dbPath, oldPath); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			_ = os.RemoveAll(tmpPath)
+			return err
+		}
+		hadOld = false
+	}
+	if err = os.Rename(tmpPath, dbPath); err != nil {
+		if hadOld {
+			_ = os.Rename(oldPath, dbPath) // eski kopya geri alınır
+		}
+		_ = os.RemoveAll(tmpPath)
+		return err
+	}
+	if hadOld {
+		_ = os.RemoveAll(oldPath)
+	}
+	return nil
+}
+
+// LoadFrom function copies the database with the same name in baseDir into this database. It is
+// used to seed an in-memory database. Files with the same names are replaced and the loaded
+// collections become available immediately.
+func (db *ArneDB) LoadFrom(baseDir string) error {
+	if err := db.checkWritable("LoadFrom"); err != nil {
+		return err
+	}
+
+	dbPath := filepath.Join(baseDir, db.Name)
+	dbfi, err := os.Stat(dbPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("database does not exist: %s", err.Error()))
+	}
+	if !dbfi.Mode().IsDir() {
+		return errors.New("database is not a dir")
+	}
+
+	colls, unlock := db.lockColls()
+	err = copyStorage(NewDirStorage(dbPath), db.storage)
+	db.cache.reset()
+	for _, c := range colls {
+		c.stats = nil // yüklenen chunk'lar yeniden sayılır
+	}
+	unlock()
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot load database: %s", err.Error()))
+	}
+
+	// Yüklenen kolleksiyonlar ve ayarları okunur
+	collNames, err := db.storage.ListColls()
+	if err != nil {
+		return errors.New("cannot read db collections")
+	}
+	db.collsMu.Lock()
+	for _, collName := range collNames {
+		if strings.HasPrefix(collName, tmpCollPrefix) {
+			continue
+		}
+		c, found := db.colls[collName]
+		if !found {
+			c = &Coll{Name: collName, db: db}
+		}
+		c.metaMu.Lock()
+		err = c.loadMeta()
+		c.metaMu.Unlock()
+		if err == nil {
+			err = c.loadSchema()
+		}
+		if err != nil {
+			db.collsMu.Unlock()
+			return err
+		}
+		db.colls[collName] = c
+		if c.GetTTL() != nil {
+			db.startSweeper()
+		}
+	}
+	db.collsMu.Unlock()
+
+	if err = db.recoverRotation(); err != nil {
+		return err
+	}
+	if err = db.checkKey(); err != nil {
+		return err
+	}
+	return db.loadChangeSeq()
+}
+
+// lockColls blocks the writes to all the collections. It returns the locked collections and the
+// function releasing them.
+func (db *ArneDB) lockColls() ([]*Coll, func()) {
+	db.collsMu.RLock()
+	colls := make([]*Coll, 0, len(db.colls))
+	for _, c := range db.colls {
+		colls = append(colls, c)
+	}
+	db.collsMu.RUnlock()
+
+	for _, c := range colls {
+		c.mu.Lock()
+	}
+	return colls, func() {
+		for _, c := range colls {
+			c.mu.Unlock()
+		}
+	}
+}
+
+// copyStorage copies all the files of src into dst
+func copyStorage(src, dst Storage) error {
+	collNames, err := src.ListColls()
+	if err != nil {
+		return err
+	}
+
+	// "" veritabanı dosyalarıdır
+	for _, collName := range append([]string{""}, collNames...) {
+		if collName != "" {
+			err = dst.CreateColl(collName)
+			if err != nil && !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+		}
+
+		files, err := src.List(collName)
+		if err != nil {
+			return err
+		}
+		for _, finfo := range files {
+			content, err := readStorageFile(src, collName, finfo.Name())
+			if err != nil {
+				return err
+			}
+			if err = dst.Replace(collName, finfo.Name(), content); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestInMemory(t *testing.T) {
+	_ = os.RemoveAll("testdb/memorydb")
+
+	pDb, err := OpenInMemory("memorydb")
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	users, err := pDb.CreateColl("users", WithCap(1000, 0))
+	if err != nil {
+		t.Fatal("Create users failed with:", err)
+	}
+	_, err = users.AddAll(RecordInstance{"name": "Mert"}, RecordInstance{"name": "Ayşe"}, RecordInstance{"name": "Can"})
+	if err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+	if _, err = os.Stat("testdb/memorydb"); !os.IsNotExist(err) {
+		t.Fatal("In-memory database touched the disk")
+	}
+
+	if _, err = users.Info(); err != nil {
+		t.Fatal("Info failed with:", err)
+	}
+	if err = pDb.SaveTo("testdb"); err != nil {
+		t.Fatal("SaveTo failed with:", err)
+	}
+	// İkinci kayıt eski kopyanın yerine geçer
+	if _, err = users.DeleteFirst(func(i RecordInstance) bool { return i["name"] == "Can" }); err != nil {
+		t.Fatal("DeleteFirst failed with:", err)
+	}
+	if err = pDb.SaveTo("testdb"); err != nil {
+		t.Fatal("SaveTo failed with:", err)
+	}
+	if _, err = os.Stat("testdb/.memorydb.old"); !os.IsNotExist(err) {
+		t.Error("SaveTo left the old copy behind")
+	}
+
+	// Kaydedilen istatistikler silmeyi içermeli
+	var stats collStats
+	content, _ := os.ReadFile("testdb/memorydb/users/" + infoFileName)
+	if err = json.Unmarshal(content, &stats); err != nil {
+		t.Fatal("Saved info cannot be read:", err)
+	}
+	live := 0
+	for _, cs := range stats.Chunks {
+		live += cs.Live
+	}
+	if live != 2 {
+		t.Errorf("Saved info has %d live records, expected 2", live)
+	}
+
+	diskDb, err := Open("testdb", "memorydb")
+	if err != nil {
+		t.Fatal("Open saved database failed with:", err)
+	}
+	n, err := diskDb.GetColl("users").Count(func(RecordInstance) bool { return true })
+	if err != nil || n != 2 {
+		t.Errorf("Saved database has %d records, %v", n, err)
+	}
+
+	seeded, err := OpenInMemory("memorydb")
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	if err = seeded.LoadFrom("testdb"); err != nil {
+		t.Fatal("LoadFrom failed with:", err)
+	}
+	users = seeded.GetColl("users")
+	if users == nil || users.GetCap() == nil {
+		t.Fatal("Loaded collection or its settings are missing")
+	}
+	first, err := users.GetFirst(func(RecordInstance) bool { return true })
+	if err != nil || first["name"] != "Mert" {
+		t.Errorf("GetFirst returned %v, %v", first, err)
+	}
+}
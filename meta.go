@@ -0,0 +1,54 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+const metaFileName = "meta.json"
+
+// collMeta holds the persisted settings of a collection. It is stored in the collection directory.
+type collMeta struct {
+	TTL   *TTLOptions `json:"ttl,omitempty"`   // Kayıtların ömrü
+	Cap   *CapOptions `json:"cap,omitempty"`   // Sınırlı kolleksiyon ayarları
+	Codec string      `json:"codec,omitempty"` // Boşsa JSON
+	// Mühürlenmiş chunk'ların sıkıştırılması
+	Compression *CompressionOptions `json:"compression,omitempty"`
+}
+
+// loadMeta reads the collection settings from the collection directory if there are any.
+func (coll *Coll) loadMeta() error {
+	metaJSON, err := readStorageFile(coll.db.storage, coll.GetName(), metaFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // Ayar yok, varsayılanlar kullanılır
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot read metadata of %s: %s", coll.GetName(), err.Error()))
+	}
+
+	var meta collMeta
+	if err = json.Unmarshal(metaJSON, &meta); err != nil {
+		return errors.New(fmt.Sprintf("invalid metadata of %s: %s", coll.GetName(), err.Error()))
+	}
+	if _, err = lookupCodec(meta.Codec); err != nil {
+		return errors.New(fmt.Sprintf("cannot open %s: %s", coll.GetName(), err.Error()))
+	}
+	coll.meta = meta
+	return nil
+}
+
+// saveMeta writes the collection settings into the collection directory. The file is replaced
+// atomically.
+func (coll *Coll) saveMeta() error {
+	metaJSON, err := json.Marshal(coll.meta)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot marshal metadata: %s", err.Error()))
+	}
+
+	if err = coll.db.storage.Replace(coll.GetName(), metaFileName, metaJSON); err != nil {
+		return errors.New(fmt.Sprintf("cannot write metadata: %s", err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package arnedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// migrationsFileName is the database file keeping the applied migrations
+const migrationsFileName = "migrations.json"
+
+// Migration is a numbered upgrade step of a database. Migrations are applied in the order of their
+// versions and each one is applied once. A step is either a function, a list of declarative patches
+// or both; the function runs first.
+type Migration struct {
+	// Version is the number of the step. It must be positive and unique.
+	Version int
+	// Description tells what the step does
+	Description string
+	// Run changes the database. Documents should be changed through the MigrationStep functions, so
+	// that the touched documents are reported and dry runs change nothing. Other changes must be
+	// skipped if step.DryRun() is true.
+	Run func(step *MigrationStep) error
+	// Patches are declarative changes of the documents
+	Patches []Patch
+}
+
+// Patch is a declarative change applied to the documents of a collection. Field names can be dotted
+// paths for nested documents. Renames are applied first, then Set and Unset. A field can be named only
+// once in a patch, also as a parent of another one like "a" and "a.b", so patches are applied the
+// same way whatever the order of the map keys is. Conflicting patches are rejected.
+type Patch struct {
+	// Coll is the name of the collection
+	Coll string
+	// Filter selects the documents. Nil means all the documents.
+	Filter *Filter
+	// Set sets the fields to the given values
+	Set map[string]interface{}
+	// Unset removes the fields
+	Unset []string
+	// Rename renames the fields. Keys are the old names.
+	Rename map[string]string
+}
+
+// MigrationResult reports a migration step which is applied or would be applied.
+type MigrationResult struct {
+	Version     int       `json:"version"`
+	Description string    `json:"description,omitempty"`
+	Touched     int       `json:"touched"` // Değiştirilen veya değiştirilecek kayıt sayısı
+	AppliedAt   time.Time `json:"appliedAt"`
+	DryRun      bool      `json:"-"`
+}
+
+// MigrationStep gives access to the database while a migration step runs. It counts the touched
+// documents and changes nothing in dry runs.
+type MigrationStep struct {
+	db      *ArneDB
+	dryRun  bool
+	touched int
+}
+
+// DB function returns the migrated database.
+func (s *MigrationStep) DB() *ArneDB {
+	return s.db
+}
+
+// DryRun function reports whether the step only counts the documents it would touch.
+func (s *MigrationStep) DryRun() bool {
+	return s.dryRun
+}
+
+// Update function updates the documents of the collection matched by the predicate. In dry runs it
+// only counts them.
+func (s *MigrationStep) Update(collName string, predicate QueryPredicate, updateFunction UpdateFunc) (int, error) {
+	coll := s.db.GetColl(collName)
+	if coll == nil {
+		return 0, errors.New(fmt.Sprintf("collection does not exist: %s", collName))
+	}
+
+	var n int
+	var err error
+	if s.dryRun {
+		n, err = coll.Count(predicate)
+	} else {
+		n, err = coll.UpdateAll(predicate, updateFunction)
+	}
+	s.touched += n
+	return n, err
+}
+
+// Delete function deletes the documents of the collection matched by the predicate. In dry runs it
+// only counts them.
+func (s *MigrationStep) Delete(collName string, predicate QueryPredicate) (int, error) {
+	coll := s.db.GetColl(collName)
+	if coll == nil {
+		return 0, errors.New(fmt.Sprintf("collection does not exist: %s", collName))
+	}
+
+	var n int
+	var err error
+	if s.dryRun {
+		n, err = coll.Count(predicate)
+	} else {
+		n, err = coll.DeleteAll(predicate)
+	}
+	s.touched += n
+	return n, err
+}
+
+// Apply function applies a declarative patch. In dry runs it only counts the matched documents.
+func (s *MigrationStep) Apply(patch Patch) (int, error) {
+	if err := patch.check(); err != nil {
+		return 0, err
+	}
+	return s.Update(patch.Coll, patch.predicate(), patch.update)
+}
+
+// ParseUpdate function parses an update document into a patch. The document can have the "$set",
+// "$unset" and "$rename" operators like {"$set": {"a.b": 1}, "$unset": ["c"], "$rename": {"d": "e"}}.
+// $unset can also be a document whose keys are the removed fields.
+func ParseUpdate(data []byte) (Patch, error) {
+	var doc struct {
+		Set    map[string]interface{} `json:"$set"`
+		Unset  json.RawMessage        `json:"$unset"`
+		Rename map[string]string      `json:"$rename"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return Patch{}, errors.New(fmt.Sprintf("invalid update: %s", err.Error()))
+	}
+
+	patch := Patch{Set: doc.Set, Rename: doc.Rename}
+	if len(doc.Unset) > 0 {
+		// $unset bir liste veya MongoDB'deki gibi bir doküman olabilir
+		var fields map[string]interface{}
+		if err := json.Unmarshal(doc.Unset, &patch.Unset); err != nil {
+			if err = json.Unmarshal(doc.Unset, &fields); err != nil {
+				return Patch{}, errors.New("invalid update: $unset must be a list of fields")
+			}
+			for field := range fields {
+				patch.Unset = append(patch.Unset, field)
+			}
+			sort.Strings(patch.Unset)
+		}
+	}
+	if len(patch.Set) == 0 && len(patch.Unset) == 0 && len(patch.Rename) == 0 {
+		return Patch{}, errors.New("invalid update: nothing to do")
+	}
+	if err := patch.check(); err != nil {
+		return Patch{}, errors.New(fmt.Sprintf("invalid update: %s", err.Error()))
+	}
+	return patch, nil
+}
+
+// ApplyPatch function applies the patch to the matching documents of the collection and returns the
+// count of the changed documents. The Coll field of the patch is not used.
+func (coll *Coll) ApplyPatch(patch Patch) (int, error) {
+	if err := patch.check(); err != nil {
+		return 0, err
+	}
+	return coll.UpdateAll(patch.predicate(), patch.update)
+}
+
+// predicate returns the query predicate of the patch filter
+func (p Patch) predicate() QueryPredicate {
+	if p.Filter == nil {
+		return func(RecordInstance) bool { return true }
+	}
+	return p.Filter.Match
+}
+
+// check returns an error if a field is named twice in the patch or it is the parent of another one.
+// Otherwise the result of the patch would depend on the order of the map keys.
+func (p Patch) check() error {
+	fields := make([]string, 0, len(p.Set)+len(p.Unset)+2*len(p.Rename))
+	for field := range p.Set {
+		fields = append(fields, field)
+	}
+	fields = append(fields, p.Unset...)
+	for oldName, newName := range p.Rename {
+		fields = append(fields, oldName, newName)
+	}
+	sort.Strings(fields) // hata mesajı her seferinde aynı olsun
+
+	for i, a := range fields {
+		for _, b := range fields[i+1:] {
+			if a == b || strings.HasPrefix(b, a+".") || strings.HasPrefix(a, b+".") {
+				return errors.New(fmt.Sprintf("conflicting fields in patch: %s and %s", a, b))
+			}
+		}
+	}
+	return nil
+}
+
+// update changes the document as described by the patch
+func (p Patch) update(ptrRecord *RecordInstance) *RecordInstance {
+	data := *ptrRecord
+	for oldName, newName := range p.Rename {
+		if value, found := lookupField(data, oldName); found {
+			unsetField(data, oldName)
+			setField(data, newName, value)
+		}
+	}
+	for field, value := range p.Set {
+		setField(data, field, value)
+	}
+	for _, field := range p.Unset {
+		unsetField(data, field)
+	}
+	return &data
+}
+
+// WithMigrations option registers the migrations and applies the pending ones while the database is
+// opened. Opening fails if a migration fails.
+func WithMigrations(migrations ...Migration) Option {
+	return func(db *ArneDB) error {
+		if err := db.RegisterMigrations(migrations...); err != nil {
+			return err
+		}
+		db.migrateOnOpen = true
+		return nil
+	}
+}
+
+// RegisterMigrations function adds migrations to the database. They are applied by Migrate.
+func (db *ArneDB) RegisterMigrations(migrations ...Migration) error {
+	db.migrateMu.Lock()
+	defer db.migrateMu.Unlock()
+
+	versions := make(map[int]bool)
+	for _, m := range db.migrations {
+		versions[m.Version] = true
+	}
+	for _, m := range migrations {
+		if m.Version <= 0 {
+			return errors.New(fmt.Sprintf("invalid migration version: %d", m.Version))
+		}
+		if versions[m.Version] {
+			return errors.New(fmt.Sprintf("duplicate migration version: %d", m.Version))
+		}
+		if m.Run == nil && len(m.Patches) == 0 {
+			return errors.New(fmt.Sprintf("migration %d has nothing to do", m.Version))
+		}
+		for _, patch := range m.Patches {
+			if err := patch.check(); err != nil {
+				return errors.New(fmt.Sprintf("migration %d: %s", m.Version, err.Error()))
+			}
+		}
+		versions[m.Version] = true
+	}
+
+	db.migrations = append(db.migrations, migrations...)
+	sort.Slice(db.migrations, func(i, j int) bool { return db.migrations[i].Version < db.migrations[j].Version })
+	return nil
+}
+
+// MigrationVersion function returns the version of the last applied migration or zero.
+func (db *ArneDB) MigrationVersion() (int, error) {
+	applied, err := db.loadMigrations()
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// Migrate function applies the pending migrations in order and returns their results. The version
+// is recorded after each step, so a failed migration is retried by the next call and the previous
+// ones are not applied again.
+func (db *ArneDB) Migrate() ([]MigrationResult, error) {
+	if err := db.checkWritable("Migrate"); err != nil {
+		return nil, err
+	}
+	return db.migrate(false)
+}
+
+// MigrateDryRun function reports how many documents each pending migration would touch without
+// changing the database. Steps depending on the changes of the previous ones may report different
+// numbers when they are applied.
+func (db *ArneDB) MigrateDryRun() ([]MigrationResult, error) {
+	return db.migrate(true)
+}
+
+func (db *ArneDB) migrate(dryRun bool) ([]MigrationResult, error) {
+	db.migrateMu.Lock()
+	defer db.migrateMu.Unlock()
+
+	applied, err := db.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	version := 0
+	if len(applied) > 0 {
+		version = applied[len(applied)-1].Version
+	}
+
+	results := make([]MigrationResult, 0)
+	for _, m := range db.migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		step := &MigrationStep{db: db, dryRun: dryRun}
+		if m.Run != nil {
+			err = m.Run(step)
+		}
+		for i := 0; err == nil && i < len(m.Patches); i++ {
+			_, err = step.Apply(m.Patches[i])
+		}
+		if err != nil {
+			return results, errors.New(fmt.Sprintf("migration %d failed: %s", m.Version, err.Error()))
+		}
+
+		result := MigrationResult{Version: m.Version, Description: m.Description, Touched: step.touched,
+			DryRun: dryRun}
+		if !dryRun {
+			result.AppliedAt = time.Now()
+			applied = append(applied, result)
+			if err = db.saveMigrations(applied); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// loadMigrations reads the applied migrations
+func (db *ArneDB) loadMigrations() ([]MigrationResult, error) {
+	content, err := readStorageFile(db.storage, "", migrationsFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot read migrations: %s", err.Error()))
+	}
+
+	var applied []MigrationResult
+	if err = json.Unmarshal(content, &applied); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid migrations file: %s", err.Error()))
+	}
+	return applied, nil
+}
+
+// saveMigrations writes the applied migrations
+func (db *ArneDB) saveMigrations(applied []MigrationResult) error {
+	content, err := json.MarshalIndent(applied, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = db.storage.Replace("", migrationsFileName, content); err != nil {
+		return errors.New(fmt.Sprintf("cannot write migrations: %s", err.Error()))
+	}
+	return nil
+}
+
+// setField sets the value of the field. Missing nested documents of a dotted path are created.
+func setField(data RecordInstance, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := map[string]interface{}(data)
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+// unsetField removes the field. A key containing dots itself is removed first just like lookupField
+// finds it.
+func unsetField(data RecordInstance, path string) {
+	if _, found := data[path]; found {
+		delete(data, path)
+		return
+	}
+
+	parts := strings.Split(path, ".")
+	current := map[string]interface{}(data)
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, parts[len(parts)-1])
+}
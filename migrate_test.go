@@ -0,0 +1,173 @@
+package arnedb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	_ = os.RemoveAll("testdb/migratedb")
+
+	pDb, err := Open("testdb", "migratedb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	users, err := pDb.CreateColl("users")
+	if err != nil {
+		t.Fatal("Create users failed with:", err)
+	}
+	_, err = users.AddAll(
+		RecordInstance{"id": 1, "name": "Ali", "city": "Ankara"},
+		RecordInstance{"id": 2, "name": "Ayşe", "city": "İzmir", "legacy": true},
+		RecordInstance{"id": 3, "name": "Can", "city": "Ankara", "legacy": true},
+	)
+	if err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	ankara, _ := ParseFilter([]byte(`{"address.city": "Ankara"}`))
+	migrations := []Migration{
+		{
+			Version:     2,
+			Description: "move city into address and add the country",
+			Patches: []Patch{
+				{Coll: "users", Rename: map[string]string{"city": "address.city"}},
+				{Coll: "users", Filter: ankara, Set: map[string]interface{}{"address.country": "TR", "capital": true}},
+			},
+		},
+		{
+			Version:     1,
+			Description: "remove legacy users",
+			Run: func(step *MigrationStep) error {
+				_, err := step.Delete("users", func(i RecordInstance) bool { return i["legacy"] == true && i["id"] == 2.0 })
+				if err != nil || step.DryRun() {
+					return err
+				}
+				_, err = step.DB().CreateColl("audit")
+				return err
+			},
+		},
+		{
+			Version: 3,
+			Patches: []Patch{{Coll: "users", Unset: []string{"legacy", "capital"}}},
+		},
+	}
+
+	if err = pDb.RegisterMigrations(Migration{Version: 0, Patches: migrations[0].Patches}); err == nil {
+		t.Error("invalid version expected to fail")
+	}
+	if err = pDb.RegisterMigrations(Migration{Version: 5}); err == nil {
+		t.Error("empty migration expected to fail")
+	}
+	if err = pDb.RegisterMigrations(migrations...); err != nil {
+		t.Fatal("RegisterMigrations failed with:", err)
+	}
+	if err = pDb.RegisterMigrations(migrations[0]); err == nil {
+		t.Error("duplicate version expected to fail")
+	}
+
+	report, err := pDb.MigrateDryRun()
+	if err != nil {
+		t.Fatal("MigrateDryRun failed with:", err)
+	}
+	t.Logf("Dry run: %+v", report)
+	if len(report) != 3 || report[0].Version != 1 || report[0].Touched != 1 || report[1].Touched != 3 || !report[0].DryRun {
+		t.Errorf("unexpected dry run report: %+v", report)
+	}
+	if v, _ := pDb.MigrationVersion(); v != 0 || pDb.GetColl("audit") != nil {
+		t.Error("dry run changed the database")
+	}
+	if n, _ := users.Count(func(RecordInstance) bool { return true }); n != 3 {
+		t.Errorf("dry run changed the documents, got %d", n)
+	}
+
+	results, err := pDb.Migrate()
+	if err != nil {
+		t.Fatal("Migrate failed with:", err)
+	}
+	if len(results) != 3 || results[0].Touched != 1 || results[1].Touched != 4 || results[2].Touched != 2 {
+		t.Errorf("unexpected migration results: %+v", results)
+	}
+	if v, _ := pDb.MigrationVersion(); v != 3 || pDb.GetColl("audit") == nil {
+		t.Errorf("migrations are not recorded, version %d", v)
+	}
+
+	all, _ := users.GetAll(func(RecordInstance) bool { return true })
+	for _, u := range all {
+		address, _ := u["address"].(map[string]interface{})
+		if address == nil || u["city"] != nil || u["legacy"] != nil || u["capital"] != nil {
+			t.Errorf("document is not migrated: %v", u)
+		} else if (address["city"] == "Ankara") != (address["country"] == "TR") {
+			t.Errorf("patch filter is not applied: %v", u)
+		}
+	}
+
+	if results, err = pDb.Migrate(); err != nil || len(results) != 0 {
+		t.Errorf("applied migrations run again: %+v %v", results, err)
+	}
+
+	// Açılışta bekleyen migration'lar uygulanır, hatalı olan kaydedilmez
+	failing := Migration{Version: 5, Run: func(*MigrationStep) error { return errors.New("boom") }}
+	extra := Migration{Version: 4, Patches: []Patch{{Coll: "users", Set: map[string]interface{}{"v": 4}}}}
+	if _, err = Open("testdb", "migratedb", WithMigrations(append(migrations, extra, failing)...)); err == nil {
+		t.Error("failing migration expected to fail Open")
+	}
+	pDb, err = Open("testdb", "migratedb", WithMigrations(append(migrations, extra)...))
+	if err != nil {
+		t.Fatal("Open with migrations failed with:", err)
+	}
+	if v, _ := pDb.MigrationVersion(); v != 4 {
+		t.Errorf("expected version 4 after Open, got %d", v)
+	}
+	if n, _ := pDb.GetColl("users").Count(func(i RecordInstance) bool { return i["v"] == 4.0 }); n != 2 {
+		t.Errorf("migration 4 expected to touch 2 documents, got %d", n)
+	}
+}
+
+func TestParseUpdate(t *testing.T) {
+	patch, err := ParseUpdate([]byte(`{"$set": {"a.b": 1}, "$unset": {"c": 1, "b": ""}, "$rename": {"d": "e"}}`))
+	if err != nil {
+		t.Fatal("ParseUpdate failed with:", err)
+	}
+	if patch.Set["a.b"] != 1.0 || len(patch.Unset) != 2 || patch.Unset[0] != "b" || patch.Rename["d"] != "e" {
+		t.Errorf("ParseUpdate unexpected patch: %+v", patch)
+	}
+	if patch, err = ParseUpdate([]byte(`{"$unset": ["x"]}`)); err != nil || len(patch.Unset) != 1 {
+		t.Errorf("ParseUpdate with an $unset list unexpected result: %+v %v", patch, err)
+	}
+
+	for _, bad := range []string{`{"$inc": {"a": 1}}`, `{}`, `{"$unset": 5}`, `[`} {
+		if _, err = ParseUpdate([]byte(bad)); err == nil {
+			t.Errorf("ParseUpdate %s expected to fail", bad)
+		}
+	}
+
+	// Sonucu map sırasına bağlı olan güncellemeler reddedilir
+	conflicts := []string{
+		`{"$rename": {"a": "b", "b": "c"}}`,
+		`{"$rename": {"a": "c", "b": "c"}}`,
+		`{"$set": {"a": 1, "a.b": 2}}`,
+		`{"$set": {"a.b": 1}, "$unset": ["a"]}`,
+		`{"$rename": {"a": "b"}, "$set": {"b.c": 1}}`,
+	}
+	for _, bad := range conflicts {
+		if _, err = ParseUpdate([]byte(bad)); err == nil || !strings.Contains(err.Error(), "conflicting fields") {
+			t.Errorf("ParseUpdate %s expected to fail with a conflict, got %v", bad, err)
+		}
+	}
+	if _, err = ParseUpdate([]byte(`{"$set": {"ab": 1, "a.b": 2}, "$rename": {"a.c": "b"}}`)); err != nil {
+		t.Error("ParseUpdate of distinct fields failed with:", err)
+	}
+
+	pDb, _ := OpenInMemory("patchdb")
+	coll, _ := pDb.CreateColl("items")
+	patch = Patch{Rename: map[string]string{"a": "b", "b": "c"}}
+	if _, err = coll.ApplyPatch(patch); err == nil {
+		t.Error("ApplyPatch with chained renames expected to fail")
+	}
+	if err = pDb.RegisterMigrations(Migration{Version: 1, Patches: []Patch{patch}}); err == nil {
+		t.Error("RegisterMigrations with a conflicting patch expected to fail")
+	}
+}
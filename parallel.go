@@ -0,0 +1,285 @@
+package arnedb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ParallelScanOptions configures the parallel scanning of the chunks.
+type ParallelScanOptions struct {
+	// Workers is the maximum number of chunks scanned at the same time. Values less than 2 disable
+	// the parallel scan.
+	Workers int
+	// Ordered keeps the results in the order of the chunks, so they are the same as the sequential
+	// scan. Unordered results are returned as soon as a chunk is scanned.
+	Ordered bool
+}
+
+// WithParallelScan option makes GetFirst, GetAll, GetAllAs and Count scan the chunks of a collection
+// concurrently. Predicates must be safe to call from multiple goroutines. A panic in a predicate is
+// returned as an error and stops the other workers. GetFirst stops the workers when a match is found;
+// it returns the first match in chunk order only if the scan is ordered.
+func WithParallelScan(opts ParallelScanOptions) Option {
+	return func(db *ArneDB) error {
+		if opts.Workers < 0 {
+			return errors.New(fmt.Sprintf("invalid worker count: %d", opts.Workers))
+		}
+		db.parallel = opts
+		return nil
+	}
+}
+
+// parallelScan returns the parallel scan settings if the chunks are to be scanned in parallel
+func (coll *Coll) parallelScan(chunks []fs.FileInfo) (ParallelScanOptions, bool) {
+	opts := coll.db.parallel
+	return opts, opts.Workers > 1 && len(chunks) > 1
+}
+
+// errScanCanceled is returned by a chunk scan which is stopped by another worker
+var errScanCanceled = errors.New("scan canceled")
+
+// scanChunksParallel calls scan for every chunk using a bounded pool of workers. The result of each
+// chunk is passed to collect in chunk order if the scan is ordered. Collecting stops when collect
+// returns false or a chunk fails; the remaining workers are canceled through the done channel. A
+// failing chunk cancels the workers at once, without waiting for the chunks before it.
+func scanChunksParallel[T any](chunks []fs.FileInfo, opts ParallelScanOptions,
+	scan func(name string, done <-chan struct{}) (T, error), collect func(T) bool) error {
+
+	type chunkResult struct {
+		index int
+		value T
+		err   error
+	}
+
+	done := make(chan struct{})
+	var cancelOnce sync.Once
+	cancel := func() { cancelOnce.Do(func() { close(done) }) }
+	defer cancel()
+
+	workers := opts.Workers
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+
+	jobs := make(chan int)
+	results := make(chan chunkResult, len(chunks)) // işçiler hiç beklemez
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				value, err := runChunkScan(scan, chunks[i].Name(), done)
+				results <- chunkResult{index: i, value: value, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range chunks {
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Sonuçlar toplanır. Durdurulduktan sonra da kanal boşaltılır, böylece işçiler sızmaz.
+	// Hatalar sıra beklemeden diğer işçileri durdurur, sıra sadece değerler için korunur.
+	var err error
+	stopped := false
+	pending := make(map[int]chunkResult)
+	next := 0
+	for r := range results {
+		if stopped {
+			continue
+		}
+		if r.err != nil && r.err != errScanCanceled {
+			err = r.err
+			stopped = true
+			cancel()
+			continue
+		}
+		if opts.Ordered {
+			pending[r.index] = r
+			for !stopped {
+				p, found := pending[next]
+				if !found {
+					break
+				}
+				delete(pending, next)
+				next++
+				stopped = p.err != nil || !collect(p.value)
+			}
+		} else {
+			stopped = r.err != nil || !collect(r.value)
+		}
+		if stopped {
+			cancel()
+		}
+	}
+
+	return err
+}
+
+// runChunkScan runs the scan of a single chunk. A panic in the predicate is returned as an error.
+func runChunkScan[T any](scan func(name string, done <-chan struct{}) (T, error), name string,
+	done <-chan struct{}) (value T, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("predicate error: %v", r))
+		}
+	}()
+	return scan(name, done)
+}
+
+// scanChunkLines calls fn for every live record line of the chunk. It stops when fn returns false
+// and returns errScanCanceled when done is closed.
+func (coll *Coll) scanChunkLines(name string, done <-chan struct{}, fn func(line []byte) bool) error {
+	f, err := coll.openChunk(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
+	scn := newRecordScanner(f)
+	for scn.Scan() {
+		select {
+		case <-done:
+			return errScanCanceled
+		default:
+		}
+
+		line := scn.Bytes()
+		if len(line) == 0 || coll.expiredLine(line, now) {
+			continue
+		}
+		if !fn(line) {
+			return nil
+		}
+	}
+	return scn.Err()
+}
+
+// getFirstParallel is the parallel version of GetFirst
+func (coll *Coll) getFirstParallel(chunks []fs.FileInfo, opts ParallelScanOptions, predicate QueryPredicate) (RecordInstance, error) {
+	codec := coll.codec()
+	var result RecordInstance
+	err := scanChunksParallel(chunks, opts, func(name string, done <-chan struct{}) (RecordInstance, error) {
+		var match RecordInstance
+		err := coll.scanChunkLines(name, done, func(line []byte) bool {
+			var data RecordInstance
+			_ = codec.Unmarshal(line, &data) // TODO: Handle error
+			if predicate(data) {
+				match = data
+				return false
+			}
+			return true
+		})
+		return match, err
+	}, func(match RecordInstance) bool {
+		result = match
+		return match == nil // bulununca diğerleri durdurulur
+	})
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return coll.afterRead(result)
+}
+
+// getAllParallel is the parallel version of GetAll
+func (coll *Coll) getAllParallel(chunks []fs.FileInfo, opts ParallelScanOptions, predicate QueryPredicate) ([]RecordInstance, error) {
+	codec := coll.codec()
+	result := make([]RecordInstance, 0)
+	err := scanChunksParallel(chunks, opts, func(name string, done <-chan struct{}) ([]RecordInstance, error) {
+		var matches []RecordInstance
+		var hookErr error
+		err := coll.scanChunkLines(name, done, func(line []byte) bool {
+			var data RecordInstance
+			_ = codec.Unmarshal(line, &data) // TODO: Handle error
+			if predicate(data) {
+				data, hookErr = coll.afterRead(data)
+				matches = append(matches, data)
+			}
+			return hookErr == nil
+		})
+		if err == nil {
+			err = hookErr
+		}
+		return matches, err
+	}, func(matches []RecordInstance) bool {
+		result = append(result, matches...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// countParallel is the parallel version of Count
+func (coll *Coll) countParallel(chunks []fs.FileInfo, opts ParallelScanOptions, predicate QueryPredicate) (int, error) {
+	codec := coll.codec()
+	n := 0
+	err := scanChunksParallel(chunks, opts, func(name string, done <-chan struct{}) (int, error) {
+		count := 0
+		err := coll.scanChunkLines(name, done, func(line []byte) bool {
+			var data RecordInstance
+			_ = codec.Unmarshal(line, &data) // TODO: Handle error
+			if predicate(data) {
+				count++
+			}
+			return true
+		})
+		return count, err
+	}, func(count int) bool {
+		n += count
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// getAllAsParallel is the parallel version of GetAllAs
+func getAllAsParallel[T any](coll *Coll, chunks []fs.FileInfo, opts ParallelScanOptions, predicate func(i *T) bool) ([]*T, error) {
+	codec := coll.codec()
+	result := make([]*T, 0)
+	err := scanChunksParallel(chunks, opts, func(name string, done <-chan struct{}) ([]*T, error) {
+		var matches []*T
+		var hookErr error
+		err := coll.scanChunkLines(name, done, func(line []byte) bool {
+			var m T
+			if codec.Unmarshal(line, &m) != nil {
+				return true // skip this record
+			}
+			if predicate(&m) {
+				hookErr = coll.afterReadInto(line, &m)
+				matches = append(matches, &m)
+			}
+			return hookErr == nil
+		})
+		if err == nil {
+			err = hookErr
+		}
+		return matches, err
+	}, func(matches []*T) bool {
+		result = append(result, matches...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,153 @@
+package arnedb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallelScan(t *testing.T) {
+	storage := NewMemStorage()
+	seqDb, err := OpenStorage("paralleldb", storage)
+	if err != nil {
+		t.Fatal("OpenStorage failed with:", err)
+	}
+	if _, err = seqDb.CreateColl("numbers"); err != nil {
+		t.Fatal("CreateColl failed with:", err)
+	}
+
+	// Paralel taramanın anlamlı olması için çok sayıda chunk yazılır
+	for c := 1; c <= 9; c++ {
+		var sb strings.Builder
+		for i := 0; i < 200; i++ {
+			if i%7 == 3 {
+				sb.WriteString("\n") // silinmiş kayıt
+				continue
+			}
+			sb.WriteString(fmt.Sprintf(`{"id":%d,"chunk":%d}`+"\n", c*1000+i, c))
+		}
+		if err = storage.Replace("numbers", fmt.Sprintf("%02x.json", c), []byte(sb.String())); err != nil {
+			t.Fatal("Replace failed with:", err)
+		}
+	}
+
+	ordered, err := OpenStorage("paralleldb", storage, WithParallelScan(ParallelScanOptions{Workers: 4, Ordered: true}))
+	if err != nil {
+		t.Fatal("OpenStorage with parallel scan failed with:", err)
+	}
+	unordered, err := OpenStorage("paralleldb", storage, WithParallelScan(ParallelScanOptions{Workers: 3}))
+	if err != nil {
+		t.Fatal("OpenStorage with parallel scan failed with:", err)
+	}
+	if _, err = OpenStorage("paralleldb", storage, WithParallelScan(ParallelScanOptions{Workers: -1})); err == nil {
+		t.Error("negative worker count expected to fail")
+	}
+
+	even := func(instance RecordInstance) bool { return int(instance["id"].(float64))%2 == 0 }
+	expected, err := seqDb.GetColl("numbers").GetAll(even)
+	if err != nil || len(expected) == 0 {
+		t.Fatal("sequential GetAll failed with:", err)
+	}
+
+	result, err := ordered.GetColl("numbers").GetAll(even)
+	if err != nil || len(result) != len(expected) {
+		t.Fatalf("ordered GetAll expected %d records, got %d %v", len(expected), len(result), err)
+	}
+	for i := range result {
+		if result[i]["id"] != expected[i]["id"] {
+			t.Fatalf("ordered GetAll order mismatch at %d: %v != %v", i, result[i], expected[i])
+		}
+	}
+
+	result, err = unordered.GetColl("numbers").GetAll(even)
+	if err != nil || len(result) != len(expected) {
+		t.Fatalf("unordered GetAll expected %d records, got %d %v", len(expected), len(result), err)
+	}
+
+	n, err := unordered.GetColl("numbers").Count(even)
+	if err != nil || n != len(expected) {
+		t.Errorf("parallel Count expected %d, got %d %v", len(expected), n, err)
+	}
+
+	type numberRecord struct {
+		Id    int
+		Chunk int
+	}
+	typed, err := GetAllAs[numberRecord](ordered.GetColl("numbers"), func(i *numberRecord) bool { return i.Chunk > 7 })
+	if err != nil || len(typed) == 0 || typed[0].Chunk != 8 || typed[len(typed)-1].Chunk != 9 {
+		t.Errorf("parallel GetAllAs failed: %d records %v", len(typed), err)
+	}
+	seqTyped, _ := GetAllAs[numberRecord](seqDb.GetColl("numbers"), func(i *numberRecord) bool { return i.Chunk > 7 })
+	if len(seqTyped) != len(typed) {
+		t.Errorf("GetAllAs mismatch: sequential %d, parallel %d", len(seqTyped), len(typed))
+	}
+
+	late := func(instance RecordInstance) bool { return instance["chunk"].(float64) >= 5 }
+	first, err := ordered.GetColl("numbers").GetFirst(late)
+	if err != nil || first == nil || first["id"] != 5000.0 {
+		t.Errorf("ordered GetFirst expected id 5000, got %v %v", first, err)
+	}
+	first, err = unordered.GetColl("numbers").GetFirst(late)
+	if err != nil || first == nil || !late(first) {
+		t.Errorf("unordered GetFirst expected a match, got %v %v", first, err)
+	}
+	first, err = unordered.GetColl("numbers").GetFirst(func(RecordInstance) bool { return false })
+	if err != nil || first != nil {
+		t.Errorf("GetFirst without match expected nil, got %v %v", first, err)
+	}
+
+	_, err = ordered.GetColl("numbers").GetAll(func(instance RecordInstance) bool {
+		return instance["chunk"].(float64) == 6 && instance["nope"].(bool)
+	})
+	if err == nil || !strings.Contains(err.Error(), "predicate error") {
+		t.Errorf("parallel GetAll predicate panic expected predicate error, got %v", err)
+	}
+	_, err = unordered.GetColl("numbers").Count(func(instance RecordInstance) bool {
+		return instance["nope"].(bool)
+	})
+	if err == nil || !strings.Contains(err.Error(), "predicate error") {
+		t.Errorf("parallel Count predicate panic expected predicate error, got %v", err)
+	}
+}
+
+func TestParallelScanCancelsOnError(t *testing.T) {
+	storage := NewMemStorage()
+	_ = storage.CreateColl("numbers")
+	for c := 1; c <= 4; c++ {
+		var sb strings.Builder
+		for i := 0; i < 200; i++ {
+			sb.WriteString(fmt.Sprintf(`{"id":%d,"chunk":%d}`+"\n", c*1000+i, c))
+		}
+		_ = storage.Replace("numbers", fmt.Sprintf("%02x.json", c), []byte(sb.String()))
+	}
+	pDb, err := OpenStorage("paralleldb", storage, WithParallelScan(ParallelScanOptions{Workers: 4, Ordered: true}))
+	if err != nil {
+		t.Fatal("OpenStorage failed with:", err)
+	}
+
+	// İlk chunk yavaştır, sonraki bir chunk hata verince ilk chunk'ın taraması da durmalıdır
+	panicked := make(chan struct{})
+	var panicOnce sync.Once
+	var slowCalls int32
+	_, err = pDb.GetColl("numbers").GetAll(func(instance RecordInstance) bool {
+		switch instance["chunk"].(float64) {
+		case 1:
+			<-panicked
+			atomic.AddInt32(&slowCalls, 1)
+			time.Sleep(time.Millisecond)
+		case 3:
+			panicOnce.Do(func() { close(panicked) })
+			panic(fmt.Errorf("broken record"))
+		}
+		return true
+	})
+	if err == nil || !strings.Contains(err.Error(), "predicate error") {
+		t.Errorf("predicate panic expected predicate error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&slowCalls); n >= 100 {
+		t.Errorf("slow chunk expected to be canceled after the error, it scanned %d records", n)
+	}
+}
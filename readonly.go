@@ -0,0 +1,40 @@
+package arnedb
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// ReadOnlyError is returned by the functions changing a database which is opened in read-only mode.
+type ReadOnlyError struct {
+	// Op is the name of the rejected operation
+	Op string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("%s: database is read-only", e.Op)
+}
+
+// OpenFS function opens the database in the dbName directory of fsys in read-only mode. Any fs.FS
+// like embed.FS or a zip reader can be used. Queries work as usual, functions changing the database
+// return a *ReadOnlyError.
+func OpenFS(fsys fs.FS, dbName string, opts ...Option) (*ArneDB, error) {
+	return OpenStorage(dbName, NewFSStorage(fsys, dbName), append([]Option{WithReadOnly()}, opts...)...)
+}
+
+// WithReadOnly option opens the database in read-only mode. Functions changing the database return a
+// *ReadOnlyError and expired records are not swept.
+func WithReadOnly() Option {
+	return func(db *ArneDB) error {
+		db.readOnly = true
+		return nil
+	}
+}
+
+// checkWritable returns a *ReadOnlyError if the database is read-only
+func (db *ArneDB) checkWritable(op string) error {
+	if db.readOnly {
+		return &ReadOnlyError{Op: op}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package arnedb
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOpenFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"refdb/countries/00.json":     {Data: []byte("{\"code\":\"TR\",\"name\":\"Türkiye\"}\n\n{\"code\":\"DE\",\"name\":\"Germany\"}\n")},
+		"refdb/countries/schema.json": {Data: []byte(`{"required": ["code"]}`)},
+		"refdb/sessions/00.json":      {Data: []byte("{\"id\":1,\"expiresAt\":1}\n")},
+		"refdb/sessions/meta.json":    {Data: []byte(`{"ttl": {"field": "expiresAt", "after": 0}}`)},
+	}
+
+	pDb, err := OpenFS(fsys, "refdb")
+	if err != nil {
+		t.Fatal("OpenFS failed with:", err)
+	}
+	countries := pDb.GetColl("countries")
+	if countries == nil || countries.GetSchema() == nil {
+		t.Fatal("Collection is not loaded")
+	}
+
+	n, err := countries.Count(func(RecordInstance) bool { return true })
+	if err != nil || n != 2 {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+	de, err := countries.GetFirst(func(i RecordInstance) bool { return i["code"] == "DE" })
+	if err != nil || de["name"] != "Germany" {
+		t.Errorf("GetFirst returned %v, %v", de, err)
+	}
+
+	var roe *ReadOnlyError
+	err = countries.Add(RecordInstance{"code": "FR"})
+	if !errors.As(err, &roe) || roe.Op != "Add" {
+		t.Error("Add returned:", err)
+	}
+	_, err = countries.DeleteAll(func(RecordInstance) bool { return true })
+	if !errors.As(err, &roe) || roe.Op != "DeleteAll" {
+		t.Error("DeleteAll returned:", err)
+	}
+	_, err = pDb.GetColl("sessions").PurgeExpired()
+	if !errors.As(err, &roe) || roe.Op != "PurgeExpired" {
+		t.Error("PurgeExpired returned:", err)
+	}
+	_, err = countries.UpdateFirst(func(RecordInstance) bool { return true },
+		func(ptrRecord *RecordInstance) *RecordInstance { return ptrRecord })
+	if !errors.As(err, &roe) {
+		t.Error("UpdateFirst returned:", err)
+	}
+	if _, err = pDb.CreateColl("cities"); !errors.As(err, &roe) {
+		t.Error("CreateColl returned:", err)
+	}
+	if err = pDb.DeleteColl("countries"); !errors.As(err, &roe) {
+		t.Error("DeleteColl returned:", err)
+	}
+	t.Log(err)
+}
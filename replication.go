@@ -0,0 +1,816 @@
+package arnedb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const followerStateName = "follower.json"
+const replicaHeartbeat = time.Second
+const followerSaveEvery = 100
+
+// ErrReplicaDiverged is returned by a follower when its files do not match the leader any more. The
+// follower forgets its position, so the next connection starts with a snapshot.
+var ErrReplicaDiverged = errors.New("replica diverged from the leader")
+
+// OplogOp is the kind of a change recorded in the operation log.
+type OplogOp string
+
+const (
+	// OpCreateColl creates a collection
+	OpCreateColl OplogOp = "create_coll"
+	// OpRemoveColl removes a collection with its files
+	OpRemoveColl OplogOp = "remove_coll"
+	// OpRenameColl renames a collection
+	OpRenameColl OplogOp = "rename_coll"
+	// OpAppend appends data to a file at the given offset
+	OpAppend OplogOp = "append"
+	// OpReplace replaces the content of a file
+	OpReplace OplogOp = "replace"
+	// OpRename renames a file
+	OpRename OplogOp = "rename"
+	// OpRemove removes a file
+	OpRemove OplogOp = "remove"
+
+	// Akış çerçeveleri, log'a yazılmaz
+	opSnapshot    OplogOp = "snapshot"
+	opSnapshotEnd OplogOp = "snapshot_end"
+	opHeartbeat   OplogOp = "heartbeat"
+)
+
+// OplogEntry is a single change of the database files. Entries are sent to the followers as JSON
+// lines together with the snapshot and heartbeat frames.
+type OplogEntry struct {
+	// Seq is the sequence number of the entry. Snapshot files have no sequence number.
+	Seq uint64 `json:"seq,omitempty"`
+	// Op is the kind of the change
+	Op OplogOp `json:"op"`
+	// Epoch identifies the leader in snapshot and heartbeat frames
+	Epoch string `json:"epoch,omitempty"`
+	// Coll is the collection, empty for the database files
+	Coll string `json:"coll,omitempty"`
+	// Name is the file name
+	Name string `json:"name,omitempty"`
+	// NewName is the new file or collection name of the renames
+	NewName string `json:"newName,omitempty"`
+	// Offset is the size of the file before an append
+	Offset int64 `json:"offset,omitempty"`
+	// Data is the appended or the new content of the file
+	Data []byte `json:"data,omitempty"`
+}
+
+// ReplicaPosition is the position of a follower in the operation log of a leader. Sequence numbers
+// start again when the leader is opened again, so the position is only valid for the same epoch.
+type ReplicaPosition struct {
+	// Epoch is a random identifier of the leader given when it is opened
+	Epoch string `json:"epoch"`
+	// Seq is the last applied entry
+	Seq uint64 `json:"seq"`
+}
+
+// WithOplog option records every change of the database files into an operation log which keeps
+// the last maxBytes of changes in memory. Followers connected with ServeFollower receive the
+// changes. A follower behind the log gets a snapshot of the whole database first.
+func WithOplog(maxBytes int64) Option {
+	return func(db *ArneDB) error {
+		if maxBytes <= 0 {
+			return errors.New(fmt.Sprintf("invalid oplog size: %d", maxBytes))
+		}
+		epoch := make([]byte, 8)
+		if _, err := rand.Read(epoch); err != nil {
+			return err
+		}
+
+		s := &oplogStorage{
+			Storage:  db.storage,
+			epoch:    hex.EncodeToString(epoch),
+			maxBytes: maxBytes,
+			changed:  make(chan struct{}),
+		}
+		s.sizes = newFileSizes(s.Storage)
+		db.storage = s
+		db.oplog = s
+		return nil
+	}
+}
+
+// OplogPosition function returns the epoch and the last sequence number of the operation log. The
+// position is empty if the oplog is not enabled.
+func (db *ArneDB) OplogPosition() ReplicaPosition {
+	if db.oplog == nil {
+		return ReplicaPosition{}
+	}
+	db.oplog.mu.Lock()
+	defer db.oplog.mu.Unlock()
+	return ReplicaPosition{Epoch: db.oplog.epoch, Seq: db.oplog.seq}
+}
+
+// ServeFollower function reads the position of a follower from conn and sends the changes after it
+// until ctx is done, the database is closed or writing fails. Closing conn stops a blocked write.
+func (db *ArneDB) ServeFollower(ctx context.Context, conn io.ReadWriter) error {
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot read follower position: %s", err.Error()))
+	}
+	var from ReplicaPosition
+	if err = json.Unmarshal(line, &from); err != nil {
+		return errors.New(fmt.Sprintf("invalid follower position: %s", err.Error()))
+	}
+	return db.StreamOplog(ctx, conn, from)
+}
+
+// StreamOplog function writes the changes after the given position to w as JSON lines. If the
+// position is from another epoch or it is no longer in the log, a snapshot of the database is sent
+// first. The snapshot is sent file by file; the writes wait only while the files are listed.
+// Heartbeats with the last sequence number are sent every second. It returns when ctx is done, the
+// database is closed or writing fails.
+func (db *ArneDB) StreamOplog(ctx context.Context, w io.Writer, from ReplicaPosition) error {
+	s := db.oplog
+	if s == nil {
+		return errors.New("oplog is not enabled")
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	ticker := time.NewTicker(replicaHeartbeat)
+	defer ticker.Stop()
+
+	pos, resume := from.Seq, from.Epoch == s.epoch
+	for {
+		entries, changed, ok := s.since(pos)
+		if !resume || !ok {
+			// Takipçi log'un gerisinde, bütün veritabanı gönderilir
+			seq, err := db.writeSnapshot(enc)
+			if err != nil {
+				return err
+			}
+			if err = bw.Flush(); err != nil {
+				return err
+			}
+			pos, resume = seq, true
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+			if err := enc.Encode(OplogEntry{Op: opHeartbeat, Epoch: s.epoch, Seq: db.OplogPosition().Seq}); err != nil {
+				return err
+			}
+		default:
+		}
+
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			pos = e.Seq
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+			if err := enc.Encode(OplogEntry{Op: opHeartbeat, Epoch: s.epoch, Seq: db.OplogPosition().Seq}); err != nil {
+				return err
+			}
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-db.closing:
+			return nil
+		}
+	}
+}
+
+// writeSnapshot writes all the files of the database as snapshot frames and returns the sequence
+// number the snapshot belongs to. Files are listed while the writes wait and sent one by one after
+// that. If a listed file is rewritten while it is sent, the snapshot is sent again with the writes
+// waiting; the follower starts over with the second snapshot frame.
+func (db *ArneDB) writeSnapshot(enc *json.Encoder) (uint64, error) {
+	seq, consistent, err := db.streamSnapshot(enc, false)
+	if err != nil || consistent {
+		return seq, err
+	}
+	seq, _, err = db.streamSnapshot(enc, true)
+	return seq, err
+}
+
+// snapshotFile is a file or a collection listed for a snapshot
+type snapshotFile struct {
+	coll    string
+	name    string
+	size    int64
+	created bool
+}
+
+// streamSnapshot sends a snapshot. The writes wait until the files are listed, or until all of them
+// are sent if locked is set. It returns false if a file is rewritten before it is read.
+func (db *ArneDB) streamSnapshot(enc *json.Encoder, locked bool) (uint64, bool, error) {
+	s := db.oplog
+
+	// Yarım kalmış işlemler görülmesin diye kolleksiyonlar da kilitlenir
+	_, unlock := db.lockColls()
+	s.mu.Lock()
+	seq := s.seq
+	files, err := listStorage(s.Storage)
+	if locked {
+		defer unlock()
+		defer s.mu.Unlock()
+	} else {
+		s.mu.Unlock()
+		unlock()
+	}
+	if err != nil {
+		return 0, false, errors.New(fmt.Sprintf("cannot read snapshot: %s", err.Error()))
+	}
+
+	if err = enc.Encode(OplogEntry{Op: opSnapshot, Epoch: s.epoch, Seq: seq}); err != nil {
+		return 0, false, err
+	}
+	for _, file := range files {
+		if file.created {
+			if err = enc.Encode(OplogEntry{Op: OpCreateColl, Coll: file.coll}); err != nil {
+				return 0, false, err
+			}
+			continue
+		}
+
+		content, err := readStorageFile(s.Storage, file.coll, file.name)
+		if errors.Is(err, fs.ErrNotExist) || (err == nil && int64(len(content)) < file.size) {
+			return seq, false, nil // listelendikten sonra değişmiş
+		}
+		if err != nil {
+			return 0, false, errors.New(fmt.Sprintf("cannot read snapshot: %s", err.Error()))
+		}
+		// Sonradan eklenen kayıtlar log'dan gönderilir
+		content = content[:file.size]
+		if err = enc.Encode(OplogEntry{Op: OpReplace, Coll: file.coll, Name: file.name, Data: content}); err != nil {
+			return 0, false, err
+		}
+	}
+	if !locked && s.rewrittenSince(seq, files) {
+		return seq, false, nil
+	}
+	return seq, true, enc.Encode(OplogEntry{Op: opSnapshotEnd, Epoch: s.epoch, Seq: seq})
+}
+
+// listStorage lists every collection and every file in the storage with its size. Database files
+// come first with the empty collection name. The follower state is left out.
+func listStorage(s Storage) ([]snapshotFile, error) {
+	collNames, err := s.ListColls()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []snapshotFile
+	for _, collName := range append([]string{""}, collNames...) {
+		if collName != "" {
+			result = append(result, snapshotFile{coll: collName, created: true})
+		}
+		files, err := s.List(collName)
+		if err != nil {
+			return nil, err
+		}
+		for _, finfo := range files {
+			if collName == "" && finfo.Name() == followerStateName {
+				continue
+			}
+			result = append(result, snapshotFile{coll: collName, name: finfo.Name(), size: finfo.Size()})
+		}
+	}
+	return result, nil
+}
+
+// Operation log ------------------------------------------------------------------------------------
+
+// oplogStorage records the changes made through the wrapped storage. Reads are not recorded.
+type oplogStorage struct {
+	Storage
+	mu       sync.Mutex // Değişiklikler ve log sıraya sokulur
+	epoch    string
+	seq      uint64        // Son kaydın sıra numarası
+	entries  []OplogEntry  // Son kayıtlar, sıra numarasına göre
+	bytes    int64         // entries'in yaklaşık boyutu
+	maxBytes int64         // Log'da tutulan en fazla boyut
+	sizes    *fileSizes    // append'lerin offset'i için dosya boyutları
+	changed  chan struct{} // Her kayıtta kapatılıp yenilenir
+}
+
+func (s *oplogStorage) CreateColl(coll string) error {
+	return s.record(OplogEntry{Op: OpCreateColl, Coll: coll}, func() error { return s.Storage.CreateColl(coll) })
+}
+
+func (s *oplogStorage) RemoveColl(coll string) error {
+	return s.record(OplogEntry{Op: OpRemoveColl, Coll: coll}, func() error { return s.Storage.RemoveColl(coll) })
+}
+
+func (s *oplogStorage) RenameColl(oldName, newName string) error {
+	return s.record(OplogEntry{Op: OpRenameColl, Coll: oldName, NewName: newName}, func() error {
+		return s.Storage.RenameColl(oldName, newName)
+	})
+}
+
+func (s *oplogStorage) Append(coll, name string, data []byte) error {
+	return s.record(OplogEntry{Op: OpAppend, Coll: coll, Name: name, Data: data}, func() error {
+		return s.Storage.Append(coll, name, data)
+	})
+}
+
+func (s *oplogStorage) Replace(coll, name string, data []byte) error {
+	return s.record(OplogEntry{Op: OpReplace, Coll: coll, Name: name, Data: data}, func() error {
+		return s.Storage.Replace(coll, name, data)
+	})
+}
+
+func (s *oplogStorage) Rename(coll, oldName, newName string) error {
+	return s.record(OplogEntry{Op: OpRename, Coll: coll, Name: oldName, NewName: newName}, func() error {
+		return s.Storage.Rename(coll, oldName, newName)
+	})
+}
+
+func (s *oplogStorage) Remove(coll, name string) error {
+	return s.record(OplogEntry{Op: OpRemove, Coll: coll, Name: name}, func() error { return s.Storage.Remove(coll, name) })
+}
+
+// record applies the change and adds it to the log if it succeeds
+func (s *oplogStorage) record(e OplogEntry, apply func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.Op == OpAppend {
+		offset, err := s.sizes.size(e.Coll, e.Name)
+		if err != nil {
+			return err
+		}
+		e.Offset = offset
+	}
+	if err := apply(); err != nil {
+		s.sizes.forget(e.Coll, e.NewName) // Dosyanın son hali bilinmiyor
+		return err
+	}
+	s.sizes.update(e)
+
+	s.seq++
+	e.Seq = s.seq
+	e.Data = append([]byte(nil), e.Data...) // Çağıran tamponu yeniden kullanabilir
+	s.entries = append(s.entries, e)
+	s.bytes += entrySize(e)
+	for s.bytes > s.maxBytes && len(s.entries) > 1 {
+		s.bytes -= entrySize(s.entries[0])
+		s.entries = s.entries[1:]
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return nil
+}
+
+// since returns the entries after seq and a channel closed on the next entry. It returns false if
+// the entries after seq are not in the log any more.
+func (s *oplogStorage) since(seq uint64) ([]OplogEntry, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := s.seq - uint64(len(s.entries)) + 1
+	if seq > s.seq || seq+1 < first {
+		return nil, s.changed, false
+	}
+	// Kayıtlar eklendikten sonra değişmez, dilim kopyalanmadan döner
+	return s.entries[seq+1-first:], s.changed, true
+}
+
+// rewrittenSince reports whether any of the files is replaced, renamed or removed after seq, or the
+// entries after seq are not in the log any more. Appends are not counted, they follow the snapshot.
+func (s *oplogStorage) rewrittenSince(seq uint64, files []snapshotFile) bool {
+	entries, _, ok := s.since(seq)
+	if !ok {
+		return true
+	}
+
+	listed := make(map[[2]string]bool, len(files))
+	for _, file := range files {
+		listed[[2]string{file.coll, file.name}] = true
+	}
+	for _, e := range entries {
+		switch e.Op {
+		case OpAppend, OpCreateColl:
+		case OpRemoveColl, OpRenameColl:
+			if listed[[2]string{e.Coll, ""}] {
+				return true
+			}
+		default:
+			if listed[[2]string{e.Coll, e.Name}] || listed[[2]string{e.Coll, e.NewName}] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// entrySize returns the approximate memory used by the entry
+func entrySize(e OplogEntry) int64 {
+	return int64(len(e.Data)+len(e.Coll)+len(e.Name)+len(e.NewName)) + 64
+}
+
+// fileSizes keeps the sizes of the files in a storage. Collections are listed when they are first
+// needed.
+type fileSizes struct {
+	storage Storage
+	colls   map[string]map[string]int64
+}
+
+func newFileSizes(storage Storage) *fileSizes {
+	return &fileSizes{storage: storage, colls: make(map[string]map[string]int64)}
+}
+
+// size returns the size of the file, zero if it does not exist
+func (sz *fileSizes) size(coll, name string) (int64, error) {
+	files, found := sz.colls[coll]
+	if !found {
+		list, err := sz.storage.List(coll)
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		files = make(map[string]int64, len(list))
+		for _, finfo := range list {
+			files[finfo.Name()] = finfo.Size()
+		}
+		sz.colls[coll] = files
+	}
+	return files[name], nil
+}
+
+// update applies a successful change to the known sizes
+func (sz *fileSizes) update(e OplogEntry) {
+	files, found := sz.colls[e.Coll]
+	switch e.Op {
+	case OpCreateColl:
+		sz.colls[e.Coll] = make(map[string]int64)
+	case OpRemoveColl:
+		delete(sz.colls, e.Coll)
+	case OpRenameColl:
+		delete(sz.colls, e.Coll)
+		delete(sz.colls, e.NewName)
+		if found {
+			sz.colls[e.NewName] = files
+		}
+	case OpAppend:
+		if found {
+			files[e.Name] += int64(len(e.Data))
+		}
+	case OpReplace:
+		if found {
+			files[e.Name] = int64(len(e.Data))
+		}
+	case OpRename:
+		if size, known := files[e.Name]; found && known {
+			delete(files, e.Name)
+			files[e.NewName] = size
+		} else {
+			delete(sz.colls, e.Coll)
+		}
+	case OpRemove:
+		if found {
+			delete(files, e.Name)
+		}
+	}
+}
+
+// forget drops the known sizes of the collections
+func (sz *fileSizes) forget(colls ...string) {
+	for _, coll := range colls {
+		delete(sz.colls, coll)
+	}
+}
+
+// Follower -----------------------------------------------------------------------------------------
+
+// FollowerStatus is the replication state of a follower.
+type FollowerStatus struct {
+	// Position is the last applied entry. It is empty until the first snapshot is applied.
+	Position ReplicaPosition
+	// LeaderSeq is the last sequence number the leader has reported
+	LeaderSeq uint64
+	// LastContact is the time of the last frame received from the leader
+	LastContact time.Time
+	// Snapshots is the number of the snapshots applied since the follower is created
+	Snapshots int
+}
+
+// Lag returns the number of the leader entries which are not applied yet.
+func (st FollowerStatus) Lag() uint64 {
+	if st.LeaderSeq < st.Position.Seq {
+		return 0
+	}
+	return st.LeaderSeq - st.Position.Seq
+}
+
+// Follower keeps a copy of a leader database by applying its operation log. The copy can be opened
+// in read-only mode with Open.
+type Follower struct {
+	name    string
+	storage Storage
+	sizes   *fileSizes
+	applyMu sync.Mutex       // Apply sıraya sokulur
+	snap    *ReplicaPosition // Uygulanmakta olan snapshot, yoksa nil
+	unsaved int              // Konumu kaydedilmemiş kayıt sayısı
+
+	mu     sync.Mutex // status korunur
+	status FollowerStatus
+}
+
+// NewFollower function creates a follower which keeps the copy in the dbName directory of baseDir.
+// A follower continues from the position it has saved in the directory.
+func NewFollower(baseDir, dbName string) (*Follower, error) {
+	bfi, err := os.Stat(baseDir)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Basedir does not exist! : %s", err.Error()))
+	}
+	if !bfi.Mode().IsDir() {
+		return nil, errors.New("base dir is not a dir")
+	}
+
+	dbPath := filepath.Join(baseDir, dbName)
+	if err = os.Mkdir(dbPath, 0700); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	return NewFollowerStorage(dbName, NewDirStorage(dbPath))
+}
+
+// NewFollowerStorage function creates a follower which keeps the copy in the given storage.
+func NewFollowerStorage(dbName string, storage Storage) (*Follower, error) {
+	f := &Follower{name: dbName, storage: storage, sizes: newFileSizes(storage)}
+
+	content, err := readStorageFile(storage, "", followerStateName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &f.status.Position); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid follower state: %s", err.Error()))
+	}
+	return f, nil
+}
+
+// Status function returns the replication state of the follower.
+func (f *Follower) Status() FollowerStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
+
+// Open function opens the copy in read-only mode. Collections created or removed on the leader are
+// seen after opening the copy again. The chunk cache should not be used since the copy is changed
+// by the follower.
+func (f *Follower) Open(opts ...Option) (*ArneDB, error) {
+	return OpenStorage(f.name, f.storage, append([]Option{WithReadOnly()}, opts...)...)
+}
+
+// Follow function sends the position of the follower to the leader and applies the received frames
+// until conn is closed. The leader side is ServeFollower.
+func (f *Follower) Follow(conn io.ReadWriter) error {
+	line, err := json.Marshal(f.Status().Position)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Apply(conn)
+}
+
+// Apply function applies the frames written by StreamOplog until r ends. Entries which are applied
+// before are skipped, so a stream can be applied again after a crash. The position is saved
+// periodically and when r ends.
+func (f *Follower) Apply(r io.Reader) error {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+
+	br := bufio.NewReader(r)
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e OplogEntry
+			if err := json.Unmarshal(line, &e); err != nil {
+				_ = f.saveState()
+				return errors.New(fmt.Sprintf("invalid replication frame: %s", err.Error()))
+			}
+			if err := f.apply(e); err != nil {
+				_ = f.saveState()
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return f.saveState()
+		}
+		if readErr != nil {
+			_ = f.saveState()
+			return readErr
+		}
+	}
+}
+
+// apply applies a single frame
+func (f *Follower) apply(e OplogEntry) error {
+	f.mu.Lock()
+	f.status.LastContact = time.Now()
+	pos := f.status.Position
+	f.mu.Unlock()
+
+	switch e.Op {
+	case opHeartbeat:
+		f.setLeaderSeq(e.Seq, false)
+		if f.unsaved > 0 {
+			return f.saveState()
+		}
+		return nil
+
+	case opSnapshot:
+		// Snapshot yarıda kalırsa sonraki bağlantıda baştan alınır
+		f.setPosition(ReplicaPosition{})
+		if err := f.saveState(); err != nil {
+			return err
+		}
+		if err := f.wipe(); err != nil {
+			return err
+		}
+		f.snap = &ReplicaPosition{Epoch: e.Epoch, Seq: e.Seq}
+		return nil
+
+	case opSnapshotEnd:
+		if f.snap == nil {
+			return errors.New("unexpected end of snapshot")
+		}
+		f.setPosition(*f.snap)
+		f.setLeaderSeq(f.snap.Seq, false)
+		f.snap = nil
+		f.mu.Lock()
+		f.status.Snapshots++
+		f.mu.Unlock()
+		return f.saveState()
+	}
+
+	if f.snap == nil {
+		if pos.Epoch == "" {
+			return errors.New("follower has no snapshot")
+		}
+		if e.Seq <= pos.Seq {
+			return nil // daha önce uygulandı
+		}
+		if e.Seq != pos.Seq+1 {
+			return errors.New(fmt.Sprintf("replication gap: expected entry %d, got %d", pos.Seq+1, e.Seq))
+		}
+	}
+
+	if err := f.applyOp(e); err != nil {
+		f.sizes.forget(e.Coll, e.NewName)
+		if errors.Is(err, ErrReplicaDiverged) {
+			f.snap = nil
+			f.setPosition(ReplicaPosition{})
+		}
+		return err
+	}
+	f.sizes.update(e)
+
+	if f.snap == nil {
+		f.setPosition(ReplicaPosition{Epoch: pos.Epoch, Seq: e.Seq})
+		f.setLeaderSeq(e.Seq, true)
+		if f.unsaved++; f.unsaved >= followerSaveEvery {
+			return f.saveState()
+		}
+	}
+	return nil
+}
+
+// applyOp applies a change to the storage. Changes which are applied before are accepted.
+func (f *Follower) applyOp(e OplogEntry) error {
+	if e.Coll == "" && (e.Name == followerStateName || e.NewName == followerStateName) {
+		return nil
+	}
+
+	var err error
+	switch e.Op {
+	case OpCreateColl:
+		if err = f.storage.CreateColl(e.Coll); errors.Is(err, fs.ErrExist) {
+			err = nil
+		}
+	case OpRemoveColl:
+		if err = f.storage.RemoveColl(e.Coll); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	case OpRenameColl:
+		err = f.storage.RenameColl(e.Coll, e.NewName)
+		if errors.Is(err, fs.ErrExist) || errors.Is(err, fs.ErrNotExist) {
+			// Daha önce taşındıysa eski kolleksiyon yoktur, yenisi vardır
+			_, oldErr := f.storage.List(e.Coll)
+			if _, newErr := f.storage.List(e.NewName); newErr == nil && errors.Is(oldErr, fs.ErrNotExist) {
+				err = nil
+			}
+		}
+	case OpAppend:
+		size, sizeErr := f.sizes.size(e.Coll, e.Name)
+		switch {
+		case sizeErr != nil:
+			err = sizeErr
+		case size == e.Offset:
+			err = f.storage.Append(e.Coll, e.Name, e.Data)
+		case size != e.Offset+int64(len(e.Data)): // eşitse daha önce eklenmiştir
+			err = ErrReplicaDiverged
+		}
+	case OpReplace:
+		err = f.storage.Replace(e.Coll, e.Name, e.Data)
+	case OpRename:
+		if err = f.storage.Rename(e.Coll, e.Name, e.NewName); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	case OpRemove:
+		if err = f.storage.Remove(e.Coll, e.Name); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	default:
+		err = errors.New(fmt.Sprintf("unknown oplog operation: %s", e.Op))
+	}
+	return err
+}
+
+// wipe removes everything in the storage except the follower state
+func (f *Follower) wipe() error {
+	f.sizes = newFileSizes(f.storage)
+
+	collNames, err := f.storage.ListColls()
+	if err != nil {
+		return err
+	}
+	for _, collName := range collNames {
+		if err = f.storage.RemoveColl(collName); err != nil {
+			return err
+		}
+	}
+
+	files, err := f.storage.List("")
+	if err != nil {
+		return err
+	}
+	for _, finfo := range files {
+		if finfo.Name() == followerStateName {
+			continue
+		}
+		if err = f.storage.Remove("", finfo.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Follower) setPosition(pos ReplicaPosition) {
+	f.mu.Lock()
+	f.status.Position = pos
+	f.mu.Unlock()
+}
+
+// setLeaderSeq sets the reported sequence of the leader. Applied entries only move it forward.
+func (f *Follower) setLeaderSeq(seq uint64, applied bool) {
+	f.mu.Lock()
+	if !applied || seq > f.status.LeaderSeq {
+		f.status.LeaderSeq = seq
+	}
+	f.mu.Unlock()
+}
+
+// saveState writes the position into the storage
+func (f *Follower) saveState() error {
+	content, err := json.Marshal(f.Status().Position)
+	if err != nil {
+		return err
+	}
+	if err = f.storage.Replace("", followerStateName, content); err != nil {
+		return err
+	}
+	f.unsaved = 0
+	return nil
+}
@@ -0,0 +1,276 @@
+package arnedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFollower connects the follower to the leader over a pipe. The returned function stops both
+// sides and returns the error of the follower.
+func startFollower(leader *ArneDB, follower *Follower) func() error {
+	leaderConn, followerConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { _ = leader.ServeFollower(ctx, leaderConn) }()
+	go func() { done <- follower.Follow(followerConn) }()
+
+	return func() error {
+		cancel()
+		_ = leaderConn.Close()
+		return <-done
+	}
+}
+
+// waitCaughtUp waits until the follower applies all the entries of the leader
+func waitCaughtUp(t *testing.T, leader *ArneDB, follower *Follower) {
+	t.Helper()
+	want := leader.OplogPosition()
+	deadline := time.Now().Add(5 * time.Second)
+	for follower.Status().Position != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower did not catch up: %+v, leader %+v", follower.Status(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// checkMirror compares the documents of the leader and the follower
+func checkMirror(t *testing.T, leader *ArneDB, follower *Follower) {
+	t.Helper()
+	mirror, err := follower.Open(WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open follower failed with:", err)
+	}
+	defer mirror.Close()
+
+	names, mirrorNames := leader.GelCollNames(), mirror.GelCollNames()
+	sort.Strings(names)
+	sort.Strings(mirrorNames)
+	if strings.Join(names, ",") != strings.Join(mirrorNames, ",") {
+		t.Fatalf("collections differ: %v, follower %v", names, mirrorNames)
+	}
+	for _, name := range names {
+		want, _ := leader.GetColl(name).Count(func(RecordInstance) bool { return true })
+		got, err := mirror.GetColl(name).Count(func(RecordInstance) bool { return true })
+		if err != nil || got != want {
+			t.Errorf("%s has %d documents, follower %d %v", name, want, got, err)
+		}
+	}
+}
+
+func TestReplication(t *testing.T) {
+	_ = os.RemoveAll("testdb/replicadb")
+
+	if _, err := OpenInMemory("leaderdb", WithOplog(0)); err == nil {
+		t.Error("invalid oplog size expected to fail")
+	}
+	leader, err := OpenInMemory("leaderdb", WithOplog(1<<20), WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open leader failed with:", err)
+	}
+	defer leader.Close()
+
+	users, _ := leader.CreateColl("users")
+	if _, err = users.AddAll(RecordInstance{"name": "Ali"}, RecordInstance{"name": "Ayşe"}); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	follower, err := NewFollower("testdb", "replicadb")
+	if err != nil {
+		t.Fatal("NewFollower failed with:", err)
+	}
+	stop := startFollower(leader, follower)
+	waitCaughtUp(t, leader, follower)
+	if st := follower.Status(); st.Snapshots != 1 || st.Lag() != 0 {
+		t.Errorf("a new follower expected to get a snapshot: %+v", st)
+	}
+
+	// Canlı değişiklikler
+	logs, _ := leader.CreateColl("logs", WithCompression(1))
+	for i := 0; i < 50; i++ {
+		_ = logs.Add(RecordInstance{"i": i, "text": strings.Repeat("x", 100)})
+	}
+	_, _ = users.UpdateAll(func(i RecordInstance) bool { return true }, func(i *RecordInstance) *RecordInstance {
+		(*i)["active"] = true
+		return i
+	})
+	_, _ = users.DeleteFirst(func(i RecordInstance) bool { return i["name"] == "Ali" })
+	tmp, _ := leader.CreateColl("tmp")
+	_ = tmp.Add(RecordInstance{"a": 1})
+	_ = leader.DeleteColl("tmp")
+	waitCaughtUp(t, leader, follower)
+	checkMirror(t, leader, follower)
+
+	if err = stop(); err != nil {
+		t.Error("Follow failed with:", err)
+	}
+
+	// Kopuşta kaçırılan değişiklikler log'dan alınır
+	_ = users.Add(RecordInstance{"name": "Can"})
+	follower, err = NewFollower("testdb", "replicadb")
+	if err != nil {
+		t.Fatal("NewFollower failed with:", err)
+	}
+	stop = startFollower(leader, follower)
+	waitCaughtUp(t, leader, follower)
+	if follower.Status().Snapshots != 0 {
+		t.Error("a follower in the log expected to resume without a snapshot")
+	}
+	checkMirror(t, leader, follower)
+	_ = stop()
+
+	// Başka bir lider snapshot gönderir
+	other, _ := OpenInMemory("leaderdb", WithOplog(1<<20), WithSweepInterval(0))
+	defer other.Close()
+	_, _ = other.CreateColl("other")
+	stop = startFollower(other, follower)
+	waitCaughtUp(t, other, follower)
+	if follower.Status().Snapshots != 1 {
+		t.Error("a follower of another leader expected to get a snapshot")
+	}
+	checkMirror(t, other, follower)
+	_ = stop()
+}
+
+func TestReplicationLogOverflow(t *testing.T) {
+	_ = os.RemoveAll("testdb/replicaoverflowdb")
+
+	leader, err := OpenInMemory("leaderdb", WithOplog(4096), WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open leader failed with:", err)
+	}
+	defer leader.Close()
+	users, _ := leader.CreateColl("users")
+
+	follower, _ := NewFollower("testdb", "replicaoverflowdb")
+	stop := startFollower(leader, follower)
+	waitCaughtUp(t, leader, follower)
+	_ = stop()
+
+	// Takipçi yokken log taşar
+	for i := 0; i < 100; i++ {
+		_ = users.Add(RecordInstance{"i": i, "text": strings.Repeat("y", 100)})
+	}
+	stop = startFollower(leader, follower)
+	waitCaughtUp(t, leader, follower)
+	if follower.Status().Snapshots != 2 {
+		t.Errorf("a follower behind the log expected to get a snapshot: %+v", follower.Status())
+	}
+	checkMirror(t, leader, follower)
+	_ = stop()
+}
+
+// snapshotHook calls fn once after the first frame is written
+type snapshotHook struct {
+	bytes.Buffer
+	fn func()
+}
+
+func (h *snapshotHook) Write(p []byte) (int, error) {
+	n, err := h.Buffer.Write(p)
+	if h.fn != nil {
+		fn := h.fn
+		h.fn = nil
+		fn()
+	}
+	return n, err
+}
+
+func TestSnapshotRewrittenWhileSent(t *testing.T) {
+	leader, err := OpenInMemory("leaderdb", WithOplog(1<<20), WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open leader failed with:", err)
+	}
+	defer leader.Close()
+	users, _ := leader.CreateColl("users")
+	_, _ = users.AddAll(RecordInstance{"name": "Ali"}, RecordInstance{"name": "Ayşe"})
+
+	// Dosyalar listelendikten sonra yazmalar beklemez, chunk gönderilirken yeniden yazılır
+	hook := &snapshotHook{fn: func() {
+		_, err := users.UpdateAll(func(RecordInstance) bool { return true }, func(i *RecordInstance) *RecordInstance {
+			(*i)["active"] = true
+			return i
+		})
+		if err != nil {
+			t.Error("UpdateAll during the snapshot failed with:", err)
+		}
+	}}
+	seq, err := leader.writeSnapshot(json.NewEncoder(hook))
+	if err != nil {
+		t.Fatal("writeSnapshot failed with:", err)
+	}
+	if seq != leader.OplogPosition().Seq {
+		t.Errorf("snapshot expected to be sent again after the update: seq %d, leader %d", seq, leader.OplogPosition().Seq)
+	}
+
+	follower, _ := NewFollowerStorage("replicadb", NewMemStorage())
+	if err = follower.Apply(&hook.Buffer); err != nil {
+		t.Fatal("Apply failed with:", err)
+	}
+	mirror, err := follower.Open(WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open follower failed with:", err)
+	}
+	defer mirror.Close()
+	n, err := mirror.GetColl("users").Count(func(i RecordInstance) bool { return i["active"] == true })
+	if err != nil || n != 2 {
+		t.Errorf("follower expected 2 updated users, got %d %v", n, err)
+	}
+}
+
+func TestFollowerApply(t *testing.T) {
+	follower, err := NewFollowerStorage("replicadb", NewMemStorage())
+	if err != nil {
+		t.Fatal("NewFollowerStorage failed with:", err)
+	}
+
+	if err = follower.Apply(strings.NewReader(`{"seq":1,"op":"append","coll":"c","name":"00.json","data":"e30K"}` + "\n")); err == nil {
+		t.Error("entry without a snapshot expected to fail")
+	}
+
+	// Aynı akış iki kez uygulanabilir
+	stream := `{"op":"snapshot","epoch":"e","seq":3}
+{"op":"create_coll","coll":"c"}
+{"op":"replace","coll":"c","name":"00.json","data":"e30K"}
+{"op":"snapshot_end","epoch":"e","seq":3}
+{"seq":4,"op":"append","coll":"c","name":"00.json","offset":3,"data":"eyJhIjoxfQo="}
+{"seq":5,"op":"create_coll","coll":"d"}
+{"op":"heartbeat","epoch":"e","seq":7}
+`
+	if err = follower.Apply(strings.NewReader(stream)); err != nil {
+		t.Fatal("Apply failed with:", err)
+	}
+	if st := follower.Status(); st.Position != (ReplicaPosition{Epoch: "e", Seq: 5}) || st.Lag() != 2 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+	follower.setPosition(ReplicaPosition{Epoch: "e", Seq: 3})
+	if err = follower.Apply(strings.NewReader(stream[strings.Index(stream, `{"seq":4`):])); err != nil {
+		t.Fatal("Apply again failed with:", err)
+	}
+	content, _ := readStorageFile(follower.storage, "c", "00.json")
+	if string(content) != "{}\n{\"a\":1}\n" {
+		t.Errorf("entries are applied twice: %q", content)
+	}
+
+	// Konum diske yazılır
+	again, _ := NewFollowerStorage("replicadb", follower.storage)
+	if again.Status().Position.Seq != 5 {
+		t.Errorf("follower position is not saved: %+v", again.Status())
+	}
+
+	if err = follower.Apply(strings.NewReader(`{"seq":7,"op":"remove","coll":"c","name":"00.json"}` + "\n")); err == nil {
+		t.Error("gap expected to fail")
+	}
+	err = follower.Apply(strings.NewReader(`{"seq":6,"op":"append","coll":"c","name":"00.json","offset":1,"data":"e30K"}` + "\n"))
+	if !errors.Is(err, ErrReplicaDiverged) || follower.Status().Position.Epoch != "" {
+		t.Errorf("diverged append expected to reset the follower: %v %+v", err, follower.Status())
+	}
+}
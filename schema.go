@@ -0,0 +1,506 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const schemaFileName = "schema.json"
+
+// Schema is a JSON Schema (draft 2020-12) subset used to validate the documents of a collection.
+// Supported keywords are: type, required, properties, additionalProperties, items, enum, const,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern, minItems
+// and maxItems.
+type Schema struct {
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *schemaOrBool      `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	pattern *regexp.Regexp // Derlenmiş pattern
+}
+
+// schemaTypes holds the type keyword which can be a string or an array of strings
+type schemaTypes []string
+
+// UnmarshalJSON accepts both "string" and ["string", "null"] forms
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.New("type must be a string or an array of strings")
+	}
+	*t = multiple
+	return nil
+}
+
+// schemaOrBool holds the additionalProperties keyword which can be a boolean or a schema
+type schemaOrBool struct {
+	allowed bool
+	schema  *Schema
+}
+
+// UnmarshalJSON accepts both boolean and schema forms
+func (s *schemaOrBool) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		s.allowed = b
+		return nil
+	}
+	s.allowed = true
+	return json.Unmarshal(data, &s.schema)
+}
+
+// MarshalJSON writes the keyword in the form it is read
+func (s schemaOrBool) MarshalJSON() ([]byte, error) {
+	if s.schema != nil {
+		return json.Marshal(s.schema)
+	}
+	return json.Marshal(s.allowed)
+}
+
+// SchemaViolation is a single validation failure.
+type SchemaViolation struct {
+	// Path is the location of the failing value like "address.zip" or "tags[2]". It is empty for the
+	// document itself.
+	Path string
+	// Message describes the failure
+	Message string
+}
+
+// ValidationError is returned when a document does not match the collection schema. It lists all
+// the violations found in the document.
+type ValidationError struct {
+	Violations []SchemaViolation
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		if v.Path == "" {
+			parts[i] = v.Message
+		} else {
+			parts[i] = v.Path + ": " + v.Message
+		}
+	}
+	return "schema validation failed: " + strings.Join(parts, "; ")
+}
+
+// InvalidRecord is a stored record which does not match the collection schema. It is returned by
+// ValidateAll.
+type InvalidRecord struct {
+	// Chunk is the name of the chunk file holding the record
+	Chunk string
+	// Line is the 1 based line number of the record in the chunk
+	Line int
+	// Doc is the record itself
+	Doc RecordInstance
+	// Err holds the violations
+	Err *ValidationError
+}
+
+// ParseSchema parses and compiles a JSON Schema document.
+func ParseSchema(data []byte) (*Schema, error) {
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot parse schema: %s", err.Error()))
+	}
+	if err := schema.compile(); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// compile checks the keywords and compiles the patterns recursively
+func (s *Schema) compile() error {
+	for _, t := range s.Type {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return errors.New(fmt.Sprintf("unknown schema type: %s", t))
+		}
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid schema pattern %q: %s", s.Pattern, err.Error()))
+		}
+		s.pattern = re
+	}
+
+	for _, p := range s.Properties {
+		if p == nil {
+			continue
+		}
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(); err != nil {
+			return err
+		}
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.schema != nil {
+		if err := s.AdditionalProperties.schema.compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate validates a document against the schema. It returns a *ValidationError if the document
+// does not match.
+func (s *Schema) Validate(doc interface{}) error {
+	var value interface{}
+	switch d := doc.(type) {
+	case RecordInstance:
+		value = map[string]interface{}(d)
+	case map[string]interface{}:
+		value = d
+	default:
+		// Bilinmeyen tipler JSON üzerinden genel tiplere çevrilir
+		payload, err := json.Marshal(doc)
+		if err != nil {
+			return errors.New(fmt.Sprintf("cannot marshal data: %s", err.Error()))
+		}
+		if err = json.Unmarshal(payload, &value); err != nil {
+			return err
+		}
+	}
+
+	var violations []SchemaViolation
+	s.validate("", value, &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// validate appends the violations of the value at the given path
+func (s *Schema) validate(path string, value interface{}, violations *[]SchemaViolation) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		fail("expected type %s, got %s", strings.Join(s.Type, " or "), schemaTypeOf(value))
+		return // tip uyuşmuyorsa diğer kontroller anlamsız
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+	if s.Const != nil && !jsonEqual(s.Const, value) {
+		fail("value must be %v", s.Const)
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			fail("must be > %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum {
+			fail("must be < %v", *s.ExclusiveMaximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("length must be >= %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("length must be <= %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("does not match pattern %q", s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, violations)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, found := v[name]; !found {
+				*violations = append(*violations, SchemaViolation{Path: joinPath(path, name), Message: "is required"})
+			}
+		}
+
+		// Sonuçların sırası sabit olsun diye alanlar sıralanır
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if p, found := s.Properties[k]; found {
+				if p != nil {
+					p.validate(joinPath(path, k), v[k], violations)
+				}
+				continue
+			}
+			if s.AdditionalProperties == nil {
+				continue
+			}
+			if !s.AdditionalProperties.allowed {
+				*violations = append(*violations, SchemaViolation{Path: joinPath(path, k), Message: "additional property is not allowed"})
+			} else if s.AdditionalProperties.schema != nil {
+				s.AdditionalProperties.schema.validate(joinPath(path, k), v[k], violations)
+			}
+		}
+	}
+}
+
+// matchesType checks the type keyword
+func (s *Schema) matchesType(value interface{}) bool {
+	actual := schemaTypeOf(value)
+	for _, t := range s.Type {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeOf returns the JSON Schema type name of a decoded value
+func schemaTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// jsonEqual compares two values by their JSON representation
+func jsonEqual(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// joinPath joins a property name to a path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// SetSchema attaches a JSON Schema to the collection. The schema is stored in the collection
+// directory and enforced by Add, AddAll, replace and update functions. Existing records are not
+// checked, use ValidateAll for this. Passing nil removes the schema.
+func (coll *Coll) SetSchema(schemaJSON []byte) error {
+	if err := coll.db.checkWritable("SetSchema"); err != nil {
+		return err
+	}
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	if schemaJSON == nil {
+		err := coll.db.storage.Remove(coll.GetName(), schemaFileName)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.New(fmt.Sprintf("cannot remove schema: %s", err.Error()))
+		}
+		coll.setSchema(nil)
+		return nil
+	}
+
+	schema, err := ParseSchema(schemaJSON)
+	if err != nil {
+		return err
+	}
+
+	err = coll.db.storage.Replace(coll.GetName(), schemaFileName, schemaJSON)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot write schema: %s", err.Error()))
+	}
+
+	coll.setSchema(schema)
+	return nil
+}
+
+// GetSchema returns the schema of the collection or nil if there is none.
+func (coll *Coll) GetSchema() *Schema {
+	coll.schemaMu.RLock()
+	defer coll.schemaMu.RUnlock()
+	return coll.schema
+}
+
+func (coll *Coll) setSchema(schema *Schema) {
+	coll.schemaMu.Lock()
+	coll.schema = schema
+	coll.schemaMu.Unlock()
+}
+
+// loadSchema reads the schema of the collection from the collection directory if there is any.
+func (coll *Coll) loadSchema() error {
+	schemaJSON, err := readStorageFile(coll.db.storage, coll.GetName(), schemaFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // Şema yok
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot read schema of %s: %s", coll.GetName(), err.Error()))
+	}
+
+	schema, err := ParseSchema(schemaJSON)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid schema of %s: %s", coll.GetName(), err.Error()))
+	}
+	coll.setSchema(schema)
+	return nil
+}
+
+// validate checks the encoded document against the collection schema if there is one.
+func (coll *Coll) validate(payload []byte) error {
+	return coll.validateWith(coll.GetSchema(), payload)
+}
+
+// validateWith checks the encoded document against the given schema. A nil schema accepts every
+// document.
+func (coll *Coll) validateWith(schema *Schema, payload []byte) error {
+	if schema == nil {
+		return nil
+	}
+
+	var doc interface{}
+	if err := coll.codec().Unmarshal(payload, &doc); err != nil {
+		return err
+	}
+	var violations []SchemaViolation
+	schema.validate("", doc, &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// prepareWrite runs the before hooks of the given point and validates the result. It returns the
+// document to be written.
+func (coll *Coll) prepareWrite(point HookPoint, payload []byte, prev []byte) ([]byte, error) {
+	payload, err := coll.beforeWrite(point, payload, prev)
+	if err != nil {
+		return nil, err
+	}
+	if err = coll.validate(payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// ValidateAll checks all the stored records against the collection schema and returns the invalid
+// ones. It is useful after a schema change. If the collection has no schema nil is returned.
+func (coll *Coll) ValidateAll() ([]InvalidRecord, error) {
+	schema := coll.GetSchema()
+	if schema == nil {
+		return nil, nil
+	}
+
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]InvalidRecord, 0)
+	for _, chunk := range chunks {
+		f, err := coll.openChunk(chunk.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		scn := newRecordScanner(f)
+		lineNr := 0
+		for scn.Scan() {
+			lineNr++
+			line := scn.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			err = coll.validateWith(schema, line)
+			if err == nil {
+				continue
+			}
+			invalid := InvalidRecord{Chunk: chunk.Name(), Line: lineNr}
+			_ = coll.codec().Unmarshal(line, &invalid.Doc)
+			if ve, ok := err.(*ValidationError); ok {
+				invalid.Err = ve
+			} else {
+				// Kayıt çözümlenemiyor
+				invalid.Err = &ValidationError{Violations: []SchemaViolation{{Message: err.Error()}}}
+			}
+			result = append(result, invalid)
+		}
+		err = scn.Err() // Okunamayan chunk geçerli sayılmaz
+		_ = f.Close()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("cannot read chunk %s: %s", chunk.Name(), err.Error()))
+		}
+	}
+
+	return result, nil
+}
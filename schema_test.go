@@ -0,0 +1,162 @@
+package arnedb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testUserSchema = `{
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"name": {"type": "string", "minLength": 2, "pattern": "^[A-Z]"},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 3},
+		"score": {"type": ["number", "null"], "exclusiveMaximum": 100}
+	},
+	"additionalProperties": false
+}`
+
+func TestSchemaValidation(t *testing.T) {
+	_ = os.RemoveAll("testdb/schemadb")
+
+	pDb, err := Open("testdb", "schemadb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	users, err := pDb.CreateColl("users")
+	if err != nil {
+		t.Fatal("Create users failed with:", err)
+	}
+
+	// Şema eklenmeden önce bozuk bir kayıt
+	if err = users.Add(RecordInstance{"id": 0, "name": "x"}); err != nil {
+		t.Fatal("Add without schema failed with:", err)
+	}
+
+	if err = users.SetSchema([]byte(`{"type": "objekt"}`)); err == nil {
+		t.Error("Invalid schema is accepted")
+	}
+	if err = users.SetSchema([]byte(testUserSchema)); err != nil {
+		t.Fatal("SetSchema failed with:", err)
+	}
+
+	err = users.Add(RecordInstance{"id": 1.5, "name": "mert", "extra": 1, "tags": []string{"a", "b", "c", "d"}})
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatal("Add did not return a validation error:", err)
+	}
+	t.Log(ve.Error())
+	if len(ve.Violations) != 4 {
+		t.Errorf("Expected 4 violations, got %d: %+v", len(ve.Violations), ve.Violations)
+	}
+
+	if err = users.Add(RecordInstance{"id": 1, "name": "Mert", "role": "admin", "score": nil}); err != nil {
+		t.Fatal("Valid Add failed with:", err)
+	}
+	if _, err = users.AddAll(RecordInstance{"id": 2, "name": "Ayşe"}, RecordInstance{"id": 3}); err == nil {
+		t.Error("AddAll accepted an invalid record")
+	}
+	_, err = users.ReplaceFirst(func(i RecordInstance) bool { return i["id"].(float64) == 1 },
+		RecordInstance{"id": 1, "name": "Mert", "role": "root"})
+	if err == nil {
+		t.Error("ReplaceFirst accepted an invalid record")
+	}
+	_, err = users.UpdateFirst(func(i RecordInstance) bool { return i["id"].(float64) == 1 },
+		func(ptrRecord *RecordInstance) *RecordInstance {
+			(*ptrRecord)["score"] = 100
+			return ptrRecord
+		})
+	if err == nil {
+		t.Error("UpdateFirst accepted an invalid record")
+	}
+
+	// Şema yeniden açılışta yüklenir
+	pDb, err = Open("testdb", "schemadb")
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	users = pDb.GetColl("users")
+	if users.GetSchema() == nil {
+		t.Fatal("Schema is not loaded on Open")
+	}
+
+	invalid, err := users.ValidateAll()
+	if err != nil {
+		t.Fatal("ValidateAll failed with:", err)
+	}
+	if len(invalid) != 1 || invalid[0].Line != 1 || invalid[0].Chunk != firstChunkName {
+		t.Fatalf("ValidateAll expected the first record, got %+v", invalid)
+	}
+	t.Log(invalid[0].Err.Error())
+
+	if err = users.SetSchema(nil); err != nil {
+		t.Fatal("Removing schema failed with:", err)
+	}
+	if err = users.Add(RecordInstance{"anything": true}); err != nil {
+		t.Error("Add after removing schema failed with:", err)
+	}
+}
+
+func TestSchemaChangeWhileValidating(t *testing.T) {
+	_ = os.RemoveAll("testdb/schemaracedb")
+	defer os.RemoveAll("testdb/schemaracedb")
+
+	pDb, err := Open("testdb", "schemaracedb", WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	defer pDb.Close()
+	users, _ := pDb.CreateColl("users")
+	for i := 1; i <= 50; i++ {
+		_ = users.Add(RecordInstance{"id": i, "name": "User"})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			_ = users.SetSchema([]byte(testUserSchema))
+			_ = users.SetSchema(nil)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if _, err = users.ValidateAll(); err != nil {
+			t.Fatal("ValidateAll failed with:", err)
+		}
+		_ = users.GetSchema()
+	}
+}
+
+func TestValidateAllLargeRecord(t *testing.T) {
+	pDb, err := OpenInMemory("schemadb", WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	defer pDb.Close()
+	users, _ := pDb.CreateColl("users")
+	_ = users.Add(RecordInstance{"id": 1, "name": "User", "bio": strings.Repeat("x", 100*1024)})
+	_ = users.Add(RecordInstance{"id": 0, "name": "User"})
+	if err = users.SetSchema([]byte(`{"properties": {"id": {"minimum": 1}}}`)); err != nil {
+		t.Fatal("SetSchema failed with:", err)
+	}
+
+	// 64 KB'tan büyük kayıttan sonraki kayıtlar da kontrol edilir
+	invalid, err := users.ValidateAll()
+	if err != nil || len(invalid) != 1 || invalid[0].Line != 2 {
+		t.Errorf("ValidateAll expected to report the second record, got %v %v", invalid, err)
+	}
+
+	_ = pDb.storage.Append("users", firstChunkName, []byte(strings.Repeat("y", 2*maxChunkSize+1)+"\n"))
+	if _, err = users.ValidateAll(); err == nil {
+		t.Error("ValidateAll expected to fail on an unreadable chunk")
+	}
+}
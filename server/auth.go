@@ -0,0 +1,482 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgulsoy/arnedb"
+)
+
+// AuthColl is the system collection keeping the users and the roles. Grants with wildcards do not
+// cover it, only an admin grant naming it gives access over HTTP.
+const AuthColl = "_auth"
+
+// apiKeyPrefix marks the API keys, tokens do not have it
+const apiKeyPrefix = "ak_"
+
+// Permission is the access level on a collection. Each level includes the lower ones.
+type Permission int
+
+const (
+	// PermNone gives no access
+	PermNone Permission = iota
+	// PermRead allows the queries, counts, infos and change streams
+	PermRead
+	// PermWrite allows inserting, updating and deleting documents
+	PermWrite
+	// PermAdmin allows creating and deleting collections
+	PermAdmin
+)
+
+var permNames = []string{"none", "read", "write", "admin"}
+
+func (p Permission) String() string {
+	if p < PermNone || p > PermAdmin {
+		return fmt.Sprintf("Permission(%d)", int(p))
+	}
+	return permNames[p]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (p Permission) MarshalText() ([]byte, error) {
+	if p < PermNone || p > PermAdmin {
+		return nil, errors.New(fmt.Sprintf("invalid permission: %d", int(p)))
+	}
+	return []byte(permNames[p]), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (p *Permission) UnmarshalText(text []byte) error {
+	for i, name := range permNames {
+		if name == string(text) {
+			*p = Permission(i)
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("invalid permission: %s", text))
+}
+
+// Grant gives a permission on the collections of a database. DB and Coll can be "*" to match all.
+type Grant struct {
+	DB   string     `json:"db"`
+	Coll string     `json:"coll"`
+	Perm Permission `json:"perm"`
+}
+
+// matches checks whether the grant covers the collection. An empty coll means the whole database.
+func (g Grant) matches(db, coll string) bool {
+	if g.DB != "*" && g.DB != db {
+		return false
+	}
+	if coll == AuthColl {
+		return g.Coll == AuthColl // sistem kolleksiyonu joker ile verilmez
+	}
+	return g.Coll == "*" || g.Coll == coll
+}
+
+// Role is a named set of grants shared by users.
+type Role struct {
+	Name   string  `json:"name"`
+	Grants []Grant `json:"grants"`
+}
+
+// User is an account of the server. Users get the grants of their roles and their own grants.
+type User struct {
+	Name   string   `json:"name"`
+	Roles  []string `json:"roles,omitempty"`
+	Grants []Grant  `json:"grants,omitempty"`
+	// KeyHashes are the SHA-256 hashes of the API keys. Keys themselves are not stored.
+	KeyHashes []string `json:"keyHashes,omitempty"`
+}
+
+// authDoc is a user or a role stored in the system collection
+type authDoc struct {
+	Kind string `json:"kind"` // "user" veya "role"
+	*User
+	Role *Role `json:"role,omitempty"`
+}
+
+// Auth authenticates the requests and keeps the users and the roles in the AuthColl collection of a
+// database. Users are cached in memory; changes made through Auth update the cache, changes made to
+// the collection directly are seen after Reload.
+type Auth struct {
+	coll   *arnedb.Coll
+	secret []byte // Token imzalama anahtarı, nil ise token verilmez
+
+	mu    sync.RWMutex
+	users map[string]*User
+	roles map[string]*Role
+	keys  map[string]string // Anahtar özeti -> kullanıcı adı
+
+	now func() time.Time
+}
+
+// NewAuth function loads the users and the roles from the AuthColl collection of the database. The
+// collection is created if needed. If secret is not empty, users can get signed tokens which expire,
+// otherwise only API keys are accepted.
+func NewAuth(db *arnedb.ArneDB, secret []byte) (*Auth, error) {
+	coll := db.GetColl(AuthColl)
+	if coll == nil {
+		var err error
+		if coll, err = db.CreateColl(AuthColl); err != nil {
+			return nil, err
+		}
+	}
+
+	a := &Auth{coll: coll, now: time.Now}
+	if len(secret) > 0 {
+		a.secret = append([]byte{}, secret...)
+	}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload function reads the users and the roles from the collection again.
+func (a *Auth) Reload() error {
+	users := make(map[string]*User)
+	roles := make(map[string]*Role)
+	keys := make(map[string]string)
+
+	records, err := a.coll.GetAll(func(arnedb.RecordInstance) bool { return true })
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		content, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		var doc authDoc
+		if err = json.Unmarshal(content, &doc); err != nil {
+			return errors.New(fmt.Sprintf("invalid auth document: %s", err.Error()))
+		}
+		switch doc.Kind {
+		case "user":
+			if doc.User == nil {
+				continue
+			}
+			user := doc.User
+			users[user.Name] = user
+			for _, hash := range user.KeyHashes {
+				keys[hash] = user.Name
+			}
+		case "role":
+			if doc.Role != nil {
+				roles[doc.Role.Name] = doc.Role
+			}
+		}
+	}
+
+	a.mu.Lock()
+	a.users, a.roles, a.keys = users, roles, keys
+	a.mu.Unlock()
+	return nil
+}
+
+// SetRole function creates or replaces a role.
+func (a *Auth) SetRole(name string, grants ...Grant) error {
+	if name == "" {
+		return errors.New("role name is required")
+	}
+	role := &Role{Name: name, Grants: append([]Grant{}, grants...)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.save(authDoc{Kind: "role", Role: role}, "role", name); err != nil {
+		return err
+	}
+	a.roles[name] = role
+	return nil
+}
+
+// RemoveRole function removes a role. Users keep the role name but get nothing from it.
+func (a *Auth) RemoveRole(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.coll.DeleteAll(docPredicate("role", name)); err != nil {
+		return err
+	}
+	delete(a.roles, name)
+	return nil
+}
+
+// SetUser function creates a user or replaces the roles and the grants of an existing user. API
+// keys of an existing user are kept.
+func (a *Auth) SetUser(name string, roles []string, grants ...Grant) error {
+	if name == "" {
+		return errors.New("user name is required")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user := &User{Name: name, Roles: append([]string{}, roles...), Grants: append([]Grant{}, grants...)}
+	if old, found := a.users[name]; found {
+		user.KeyHashes = old.KeyHashes
+	}
+	return a.saveUser(user)
+}
+
+// RemoveUser function removes a user with its API keys. Tokens issued to the user are rejected.
+func (a *Auth) RemoveUser(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.coll.DeleteAll(docPredicate("user", name)); err != nil {
+		return err
+	}
+	if user, found := a.users[name]; found {
+		for _, hash := range user.KeyHashes {
+			delete(a.keys, hash)
+		}
+		delete(a.users, name)
+	}
+	return nil
+}
+
+// User function returns a copy of the named user or nil if it does not exist.
+func (a *Auth) User(name string) *User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	user, found := a.users[name]
+	if !found {
+		return nil
+	}
+	c := *user
+	return &c
+}
+
+// NewAPIKey function creates a new API key for the user and returns it. The key is shown only once,
+// only its hash is stored.
+func (a *Auth) NewAPIKey(userName string) (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(random)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old, found := a.users[userName]
+	if !found {
+		return "", errors.New(fmt.Sprintf("user does not exist: %s", userName))
+	}
+	user := *old
+	user.KeyHashes = append(append([]string{}, old.KeyHashes...), hashKey(key))
+	if err := a.saveUser(&user); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// RevokeAPIKeys function removes all the API keys of the user.
+func (a *Auth) RevokeAPIKeys(userName string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old, found := a.users[userName]
+	if !found {
+		return errors.New(fmt.Sprintf("user does not exist: %s", userName))
+	}
+	user := *old
+	user.KeyHashes = nil
+	return a.saveUser(&user)
+}
+
+// tokenClaims is the signed part of a token
+type tokenClaims struct {
+	Sub string `json:"sub"`
+	Exp int64  `json:"exp"`
+}
+
+// IssueToken function returns a token for the user which is valid for ttl. The token is signed with
+// HMAC-SHA256 using the secret of the Auth.
+func (a *Auth) IssueToken(userName string, ttl time.Duration) (string, error) {
+	if a.secret == nil {
+		return "", errors.New("tokens are not enabled, the auth has no secret")
+	}
+	if ttl <= 0 {
+		return "", errors.New("token lifetime must be positive")
+	}
+	if a.User(userName) == nil {
+		return "", errors.New(fmt.Sprintf("user does not exist: %s", userName))
+	}
+
+	payload, err := json.Marshal(tokenClaims{Sub: userName, Exp: a.now().Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(encoded)), nil
+}
+
+// Authenticate function finds the user of the request. The credential is read from the
+// "Authorization: Bearer" header or the X-API-Key header and it is either an API key or a token.
+func (a *Auth) Authenticate(r *http.Request) (*User, error) {
+	credential := credentialOf(r)
+	if credential == "" && r.Header.Get("Authorization") != "" {
+		return nil, errors.New("unsupported authorization scheme")
+	}
+	if credential == "" {
+		return nil, errors.New("credentials are required")
+	}
+
+	userName, err := a.verify(credential)
+	if err != nil {
+		return nil, err
+	}
+	user := a.User(userName)
+	if user == nil {
+		return nil, errors.New("invalid credentials")
+	}
+	return user, nil
+}
+
+// credentialOf returns the credential in the request headers or an empty string
+func credentialOf(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// verify checks an API key or a token and returns the user name
+func (a *Auth) verify(credential string) (string, error) {
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		a.mu.RLock()
+		userName, found := a.keys[hashKey(credential)]
+		a.mu.RUnlock()
+		if !found {
+			return "", errors.New("invalid credentials")
+		}
+		return userName, nil
+	}
+
+	parts := strings.Split(credential, ".")
+	if a.secret == nil || len(parts) != 2 {
+		return "", errors.New("invalid credentials")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, a.sign(parts[0])) {
+		return "", errors.New("invalid credentials")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.New("invalid credentials")
+	}
+	var claims tokenClaims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.New("invalid credentials")
+	}
+	if a.now().Unix() >= claims.Exp {
+		return "", errors.New("token has expired")
+	}
+	return claims.Sub, nil
+}
+
+// Permission function returns the permission of the user on the collection. An empty coll asks for
+// the permission on the whole database, only grants with "*" collections count then.
+func (a *Auth) Permission(user *User, db, coll string) Permission {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	perm := PermNone
+	for _, g := range a.grants(user) {
+		if coll == "" && g.Coll != "*" {
+			continue
+		}
+		if g.matches(db, coll) && g.Perm > perm {
+			perm = g.Perm
+		}
+	}
+	return perm
+}
+
+// canAccessDB reports whether the user has any permission in the database
+func (a *Auth) canAccessDB(user *User, db string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, g := range a.grants(user) {
+		if (g.DB == "*" || g.DB == db) && g.Perm > PermNone {
+			return true
+		}
+	}
+	return false
+}
+
+// grants returns the grants of the user and its roles. a.mu must be held.
+func (a *Auth) grants(user *User) []Grant {
+	grants := append([]Grant{}, user.Grants...)
+	for _, roleName := range user.Roles {
+		if role, found := a.roles[roleName]; found {
+			grants = append(grants, role.Grants...)
+		}
+	}
+	return grants
+}
+
+// saveUser stores the user and updates the cache. a.mu must be held.
+func (a *Auth) saveUser(user *User) error {
+	sort.Strings(user.KeyHashes)
+	if err := a.save(authDoc{Kind: "user", User: user}, "user", user.Name); err != nil {
+		return err
+	}
+	if old, found := a.users[user.Name]; found {
+		for _, hash := range old.KeyHashes {
+			delete(a.keys, hash)
+		}
+	}
+	for _, hash := range user.KeyHashes {
+		a.keys[hash] = user.Name
+	}
+	a.users[user.Name] = user
+	return nil
+}
+
+// save replaces or adds the document of a user or a role
+func (a *Auth) save(doc authDoc, kind, name string) error {
+	n, err := a.coll.ReplaceFirst(docPredicate(kind, name), doc)
+	if err != nil || n > 0 {
+		return err
+	}
+	return a.coll.Add(doc)
+}
+
+func (a *Auth) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	_, _ = mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func docPredicate(kind, name string) arnedb.QueryPredicate {
+	return func(instance arnedb.RecordInstance) bool {
+		if instance["kind"] != kind {
+			return false
+		}
+		if kind == "role" {
+			role, _ := instance["role"].(map[string]interface{})
+			return role != nil && role["name"] == name
+		}
+		return instance["name"] == name
+	}
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
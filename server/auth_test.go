@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgulsoy/arnedb"
+)
+
+// authCall sends a request with the credential and returns the status and the body
+func authCall(h http.Handler, credential, method, path, body string) (int, string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if credential != "" {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestAuth(t *testing.T) {
+	db, err := arnedb.OpenInMemory("shop")
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	other, _ := arnedb.OpenInMemory("other")
+	for _, name := range []string{"people", "orders"} {
+		if _, err = db.CreateColl(name); err != nil {
+			t.Fatal("CreateColl failed with:", err)
+		}
+	}
+
+	auth, err := NewAuth(db, []byte("secret"))
+	if err != nil {
+		t.Fatal("NewAuth failed with:", err)
+	}
+	if err = auth.SetRole("reader", Grant{DB: "shop", Coll: "*", Perm: PermRead}); err != nil {
+		t.Fatal("SetRole failed with:", err)
+	}
+	if err = auth.SetUser("alice", []string{"reader"}, Grant{DB: "shop", Coll: "people", Perm: PermWrite}); err != nil {
+		t.Fatal("SetUser failed with:", err)
+	}
+	if err = auth.SetUser("root", nil, Grant{DB: "*", Coll: "*", Perm: PermAdmin}); err != nil {
+		t.Fatal("SetUser failed with:", err)
+	}
+	aliceKey, err := auth.NewAPIKey("alice")
+	if err != nil {
+		t.Fatal("NewAPIKey failed with:", err)
+	}
+	rootKey, _ := auth.NewAPIKey("root")
+	if _, err = auth.NewAPIKey("nobody"); err == nil {
+		t.Error("NewAPIKey for a missing user expected to fail")
+	}
+
+	h := New([]*arnedb.ArneDB{db, other}, WithAuth(auth))
+
+	// Kimlik doğrulama
+	for _, credential := range []string{"", "ak_wrong", "a.b", "garbage"} {
+		if code, _ := authCall(h, credential, "GET", "/dbs", ""); code != 401 {
+			t.Errorf("credential %q expected 401, got %d", credential, code)
+		}
+	}
+	req := httptest.NewRequest("GET", "/dbs", nil)
+	req.Header.Set("X-API-Key", aliceKey)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 200 || strings.TrimSpace(rec.Body.String()) != `["shop"]` {
+		t.Error("X-API-Key expected to list the accessible databases, got:", rec.Code, rec.Body.String())
+	}
+	if code, _ := authCall(h, aliceKey, "GET", "/dbs/other/colls", ""); code != 404 {
+		t.Error("inaccessible database expected 404, got:", code)
+	}
+
+	// Yetkiler
+	checks := []struct {
+		credential, method, path, body string
+		want                           int
+	}{
+		{aliceKey, "GET", "/dbs/shop/colls", "", 200},
+		{aliceKey, "POST", "/dbs/shop/colls/orders/query", "{}", 200},
+		{aliceKey, "POST", "/dbs/shop/colls/people/docs", `{"name": "Ada"}`, 201},
+		{aliceKey, "POST", "/dbs/shop/colls/orders/docs", `{"total": 5}`, 403},
+		{aliceKey, "POST", "/dbs/shop/colls/orders/delete", `{"filter": {}}`, 403},
+		{aliceKey, "DELETE", "/dbs/shop/colls/people", "", 403},
+		{aliceKey, "POST", "/dbs/shop/colls", `{"name": "new"}`, 403},
+		{aliceKey, "POST", "/dbs/shop/colls/_auth/query", "{}", 403},
+		{aliceKey, "GET", "/dbs/shop", "", 200},
+		{rootKey, "POST", "/dbs/shop/colls/_auth/query", "{}", 403},
+		{rootKey, "POST", "/dbs/shop/colls", `{"name": "new"}`, 201},
+		{rootKey, "DELETE", "/dbs/shop/colls/new", "", 204},
+	}
+	for _, c := range checks {
+		if code, body := authCall(h, c.credential, c.method, c.path, c.body); code != c.want {
+			t.Errorf("%s %s expected %d, got %d %s", c.method, c.path, c.want, code, body)
+		}
+	}
+	if _, body := authCall(h, aliceKey, "GET", "/dbs/shop/colls", ""); strings.Contains(body, AuthColl) {
+		t.Error("system collection expected to be hidden, got:", body)
+	}
+	for _, credential := range []string{aliceKey, rootKey} {
+		if _, body := authCall(h, credential, "GET", "/dbs/shop", ""); strings.Contains(body, AuthColl) {
+			t.Error("system collection info expected to be hidden, got:", body)
+		}
+	}
+	_ = auth.SetUser("auditor", []string{"reader"}, Grant{DB: "shop", Coll: AuthColl, Perm: PermRead})
+	auditorKey, _ := auth.NewAPIKey("auditor")
+	if _, body := authCall(h, auditorKey, "GET", "/dbs/shop", ""); !strings.Contains(body, AuthColl) {
+		t.Error("system collection info expected to be shown with an explicit grant, got:", body)
+	}
+	if db.GetColl("people") == nil {
+		t.Error("collection deleted without permission")
+	}
+
+	// Token
+	if code, _ := authCall(h, aliceKey, "POST", "/auth/token", `{"ttl": 60}`); code != 200 {
+		t.Fatal("token request failed:", code)
+	}
+	_, body := authCall(h, aliceKey, "POST", "/auth/token", `{"ttl": 60}`)
+	var tokenResp struct {
+		Token string `json:"token"`
+	}
+	if err = json.Unmarshal([]byte(body), &tokenResp); err != nil || tokenResp.Token == "" {
+		t.Fatal("token response unexpected:", body)
+	}
+	if code, _ := authCall(h, tokenResp.Token, "POST", "/dbs/shop/colls/people/count", "{}"); code != 200 {
+		t.Error("token expected to authenticate, got:", code)
+	}
+	if code, _ := authCall(h, tokenResp.Token, "POST", "/auth/token", "{}"); code != 403 {
+		t.Error("token expected not to issue tokens, got:", code)
+	}
+	if code, _ := authCall(h, tokenResp.Token+"x", "GET", "/dbs", ""); code != 401 {
+		t.Error("tampered token expected 401, got:", code)
+	}
+	auth.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if code, _ := authCall(h, tokenResp.Token, "GET", "/dbs", ""); code != 401 {
+		t.Error("expired token expected 401, got:", code)
+	}
+	auth.now = time.Now
+
+	// Kullanıcılar kalıcıdır, anahtar ve silme iptal edilir
+	reloaded, err := NewAuth(db, []byte("secret"))
+	if err != nil {
+		t.Fatal("NewAuth failed with:", err)
+	}
+	h2 := New([]*arnedb.ArneDB{db}, WithAuth(reloaded))
+	if code, _ := authCall(h2, aliceKey, "POST", "/dbs/shop/colls/people/count", "{}"); code != 200 {
+		t.Error("reloaded auth expected to accept the key, got:", code)
+	}
+	if err = reloaded.RevokeAPIKeys("alice"); err != nil {
+		t.Fatal("RevokeAPIKeys failed with:", err)
+	}
+	if code, _ := authCall(h2, aliceKey, "GET", "/dbs", ""); code != 401 {
+		t.Error("revoked key expected 401, got:", code)
+	}
+	token, _ := reloaded.IssueToken("alice", time.Minute)
+	if err = reloaded.RemoveUser("alice"); err != nil {
+		t.Fatal("RemoveUser failed with:", err)
+	}
+	if code, _ := authCall(h2, token, "GET", "/dbs", ""); code != 401 {
+		t.Error("token of a removed user expected 401, got:", code)
+	}
+	if err = reloaded.RemoveRole("reader"); err != nil {
+		t.Fatal("RemoveRole failed with:", err)
+	}
+	if err = reloaded.Reload(); err != nil || reloaded.User("alice") != nil || reloaded.User("root") == nil {
+		t.Error("Reload unexpected result:", err)
+	}
+}
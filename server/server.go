@@ -0,0 +1,660 @@
+// Package server exposes arnedb databases over HTTP. Server is an http.Handler, so it can be served
+// by http.ListenAndServe, mounted under a prefix with http.StripPrefix or tested with httptest.
+//
+// Requests and responses are JSON. The endpoints are:
+//
+//	GET    /dbs                             list the databases
+//	GET    /dbs/{db}                        database info
+//	GET    /dbs/{db}/colls                  list the collections
+//	POST   /dbs/{db}/colls                  create a collection: {"name": "people"}
+//	GET    /dbs/{db}/colls/{coll}           collection info
+//	DELETE /dbs/{db}/colls/{coll}           delete a collection
+//	POST   /dbs/{db}/colls/{coll}/docs      insert a document or an array of documents
+//	POST   /dbs/{db}/colls/{coll}/query     {"filter": {...}, "sort": [{"field": "age", "desc": true}], "skip": 0, "limit": 10}
+//	POST   /dbs/{db}/colls/{coll}/count     {"filter": {...}}
+//	POST   /dbs/{db}/colls/{coll}/update    {"filter": {...}, "update": {"$set": {...}}}
+//	POST   /dbs/{db}/colls/{coll}/delete    {"filter": {...}}
+//	GET    /dbs/{db}/changes                change stream of the database as Server-Sent Events
+//	GET    /dbs/{db}/colls/{coll}/changes   change stream of the collection as Server-Sent Events
+//	POST   /auth/token                      issue a token for the API key user: {"ttl": 3600}
+//
+// Filters are arnedb filter documents. Update and delete require a filter, {} matches all the
+// documents. Change streams accept a filter in the filter query parameter and resume after the
+// token in the after parameter or the Last-Event-ID header if the database keeps a change log.
+//
+// With the WithAuth option every request must carry an API key or a token in the "Authorization:
+// Bearer" or the X-API-Key header. Reading needs the read permission on the collection, changing
+// documents needs write and creating or deleting collections needs admin. The database info and
+// the database change stream need read permission on all the collections ("*").
+//
+// Errors are returned as {"error": "message"} with a matching status code.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgulsoy/arnedb"
+)
+
+// defaultMaxBodySize is the default limit of the request bodies
+const defaultMaxBodySize = 32 << 20
+
+// defaultTokenTTL is the lifetime of the tokens issued by /auth/token if the request does not set one
+const defaultTokenTTL = time.Hour
+
+// defaultHeartbeat is the default period of the keep-alive comments sent on change streams
+const defaultHeartbeat = 30 * time.Second
+
+// Server serves the databases over HTTP.
+type Server struct {
+	dbs         map[string]*arnedb.ArneDB // İsimlerine göre veritabanları
+	auth        *Auth                     // nil ise kimlik doğrulama yapılmaz
+	maxBodySize int64
+	heartbeat   time.Duration
+}
+
+// Option configures a server.
+type Option func(s *Server)
+
+// WithMaxBodySize option limits the size of the request bodies. The default is 32MB.
+func WithMaxBodySize(n int64) Option {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// WithHeartbeat option sets the period of the keep-alive comments sent on idle change streams. The
+// default is 30 seconds. Zero disables them.
+func WithHeartbeat(d time.Duration) Option {
+	return func(s *Server) {
+		s.heartbeat = d
+	}
+}
+
+// WithAuth option requires every request to be authenticated by the given Auth and checks the
+// permissions of the user before running the operation.
+func WithAuth(auth *Auth) Option {
+	return func(s *Server) {
+		s.auth = auth
+	}
+}
+
+// New function creates a server for the given databases. Databases are addressed by their names.
+func New(dbs []*arnedb.ArneDB, opts ...Option) *Server {
+	s := &Server{
+		dbs:         make(map[string]*arnedb.ArneDB),
+		maxBodySize: defaultMaxBodySize,
+		heartbeat:   defaultHeartbeat,
+	}
+	for _, db := range dbs {
+		s.dbs[db.Name] = db
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// httpError is an error with a status code
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// request is the body of the query, count, update and delete requests
+type request struct {
+	Filter json.RawMessage    `json:"filter"`
+	Sort   []arnedb.SortField `json:"sort"`
+	Skip   int                `json:"skip"`
+	Limit  int                `json:"limit"`
+	Update json.RawMessage    `json:"update"`
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var user *User
+	if s.auth != nil {
+		var err error
+		if user, err = s.auth.Authenticate(r); err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="arnedb"`)
+			writeError(w, &httpError{status: http.StatusUnauthorized, msg: err.Error()})
+			return
+		}
+	}
+
+	if err := s.route(w, r, user); err != nil {
+		writeError(w, err)
+	}
+}
+
+// route dispatches the request by its path and method
+func (s *Server) route(w http.ResponseWriter, r *http.Request, user *User) error {
+	parts, err := splitPath(r.URL.EscapedPath())
+	if err != nil {
+		return err
+	}
+	if len(parts) == 2 && parts[0] == "auth" && parts[1] == "token" {
+		return s.token(w, r, user)
+	}
+	if len(parts) == 0 || parts[0] != "dbs" {
+		return errorf(http.StatusNotFound, "not found: %s", r.URL.Path)
+	}
+
+	if len(parts) == 1 {
+		if err = allow(w, r, http.MethodGet); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, s.dbNames(user))
+	}
+
+	// Yetkisi olmayan kullanıcı veritabanının varlığını öğrenemez
+	db, found := s.dbs[parts[1]]
+	if !found || (s.auth != nil && !s.auth.canAccessDB(user, parts[1])) {
+		return errorf(http.StatusNotFound, "database does not exist: %s", parts[1])
+	}
+
+	switch {
+	case len(parts) == 2:
+		if err = allow(w, r, http.MethodGet); err != nil {
+			return err
+		}
+		if err = s.authorize(user, db.Name, "", PermRead); err != nil {
+			return err
+		}
+		info, err := db.Info()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, s.readableInfo(user, info))
+	case len(parts) == 3 && parts[2] == "changes":
+		if err = allow(w, r, http.MethodGet); err != nil {
+			return err
+		}
+		if err = s.authorize(user, db.Name, "", PermRead); err != nil {
+			return err
+		}
+		return s.changes(w, r, user, db, nil)
+	case len(parts) == 3 && parts[2] == "colls":
+		return s.colls(w, r, user, db)
+	case len(parts) == 4 && parts[2] == "colls":
+		return s.coll(w, r, user, db, parts[3])
+	case len(parts) == 5 && parts[2] == "colls":
+		return s.collAction(w, r, user, db, parts[3], parts[4])
+	}
+	return errorf(http.StatusNotFound, "not found: %s", r.URL.Path)
+}
+
+// readableInfo removes the collections the user can not read from the database info. The system
+// collection is only shown to the users with an explicit grant on it.
+func (s *Server) readableInfo(user *User, info *arnedb.DBInfo) *arnedb.DBInfo {
+	readable := arnedb.DBInfo{Name: info.Name, Colls: make([]arnedb.CollInfo, 0, len(info.Colls))}
+	for _, ci := range info.Colls {
+		if s.authorize(user, info.Name, ci.Name, PermRead) != nil {
+			continue
+		}
+		readable.Colls = append(readable.Colls, ci)
+		readable.Docs += ci.Docs
+		readable.Bytes += ci.Bytes
+		if ci.Modified.After(readable.Modified) {
+			readable.Modified = ci.Modified
+		}
+	}
+	return &readable
+}
+
+// colls lists and creates the collections
+func (s *Server) colls(w http.ResponseWriter, r *http.Request, user *User, db *arnedb.ArneDB) error {
+	if err := allow(w, r, http.MethodGet, http.MethodPost); err != nil {
+		return err
+	}
+
+	if r.Method == http.MethodGet {
+		names := make([]string, 0)
+		for _, name := range db.GelCollNames() {
+			// Sadece okunabilen kolleksiyonlar listelenir
+			if s.authorize(user, db.Name, name, PermRead) == nil {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return writeJSON(w, http.StatusOK, names)
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := s.decode(w, r, &body); err != nil {
+		return err
+	}
+	if err := arnedb.CheckCollName(body.Name); err != nil {
+		return errorf(http.StatusBadRequest, "%s", err.Error())
+	}
+	if err := s.authorize(user, db.Name, body.Name, PermAdmin); err != nil {
+		return err
+	}
+	if db.GetColl(body.Name) != nil {
+		return errorf(http.StatusConflict, "collection already exists: %s", body.Name)
+	}
+	if _, err := db.CreateColl(body.Name); err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, map[string]string{"name": body.Name})
+}
+
+// coll returns the info of a collection or deletes it
+func (s *Server) coll(w http.ResponseWriter, r *http.Request, user *User, db *arnedb.ArneDB, collName string) error {
+	if err := allow(w, r, http.MethodGet, http.MethodDelete); err != nil {
+		return err
+	}
+	perm := PermRead
+	if r.Method == http.MethodDelete {
+		perm = PermAdmin
+	}
+	coll, err := s.getColl(user, db, collName, perm)
+	if err != nil {
+		return err
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := db.DeleteColl(coll.GetName()); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	info, err := coll.Info()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, info)
+}
+
+// collAction runs the operations on the documents of a collection
+func (s *Server) collAction(w http.ResponseWriter, r *http.Request, user *User, db *arnedb.ArneDB, collName, action string) error {
+	method, perm := http.MethodPost, PermRead
+	switch action {
+	case "changes":
+		method = http.MethodGet
+	case "docs", "update", "delete":
+		perm = PermWrite
+	case "query", "count":
+	default:
+		return errorf(http.StatusNotFound, "not found: %s", r.URL.Path)
+	}
+	if err := allow(w, r, method); err != nil {
+		return err
+	}
+	coll, err := s.getColl(user, db, collName, perm)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "changes":
+		return s.changes(w, r, user, db, coll)
+	case "docs":
+		return s.insert(w, r, coll)
+	}
+
+	var body request
+	if err := s.decode(w, r, &body); err != nil {
+		return err
+	}
+	if (action == "update" || action == "delete") && len(body.Filter) == 0 {
+		return errorf(http.StatusBadRequest, "%s requires a filter, use {} for all the documents", action)
+	}
+	filter, err := parseFilter(body.Filter)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "count":
+		n, err := coll.CountFilter(filter)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, map[string]int{"count": n})
+	case "delete":
+		n, err := coll.DeleteAll(filter.Predicate())
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, map[string]int{"deleted": n})
+	case "update":
+		if len(body.Update) == 0 {
+			return errorf(http.StatusBadRequest, "update is required")
+		}
+		patch, err := arnedb.ParseUpdate(body.Update)
+		if err != nil {
+			return &httpError{status: http.StatusBadRequest, msg: err.Error()}
+		}
+		patch.Filter = filter
+		n, err := coll.ApplyPatch(patch)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, map[string]int{"updated": n})
+	}
+
+	if body.Skip < 0 || body.Limit < 0 {
+		return errorf(http.StatusBadRequest, "skip and limit cannot be negative")
+	}
+	docs, err := coll.Find(filter)
+	if err != nil {
+		return err
+	}
+	arnedb.SortRecords(docs, body.Sort...)
+	if body.Skip >= len(docs) {
+		docs = docs[:0]
+	} else {
+		docs = docs[body.Skip:]
+	}
+	if body.Limit > 0 && len(docs) > body.Limit {
+		docs = docs[:body.Limit]
+	}
+	return writeJSON(w, http.StatusOK, map[string]interface{}{"docs": docs})
+}
+
+// insert adds a document or an array of documents
+func (s *Server) insert(w http.ResponseWriter, r *http.Request, coll *arnedb.Coll) error {
+	var raw json.RawMessage
+	if err := s.decode(w, r, &raw); err != nil {
+		return err
+	}
+
+	var docs []arnedb.RecordInstance
+	var err error
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(raw, &docs)
+	} else {
+		var doc arnedb.RecordInstance
+		if err = json.Unmarshal(raw, &doc); err == nil && doc != nil {
+			docs = []arnedb.RecordInstance{doc}
+		}
+	}
+	if err != nil || len(docs) == 0 {
+		return errorf(http.StatusBadRequest, "body must be a document or an array of documents")
+	}
+
+	n, err := coll.AddAll(docs...)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, map[string]int{"inserted": n})
+}
+
+// changes streams the change events as Server-Sent Events until the client goes away. If coll is
+// nil the changes of all the collections are sent.
+func (s *Server) changes(w http.ResponseWriter, r *http.Request, user *User, db *arnedb.ArneDB, coll *arnedb.Coll) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errorf(http.StatusInternalServerError, "streaming is not supported")
+	}
+
+	var filter *arnedb.Filter
+	if text := r.URL.Query().Get("filter"); text != "" {
+		var err error
+		if filter, err = parseFilter([]byte(text)); err != nil {
+			return err
+		}
+	}
+
+	afterText := r.URL.Query().Get("after")
+	if afterText == "" {
+		afterText = r.Header.Get("Last-Event-ID")
+	}
+	var after *arnedb.ChangeToken
+	if afterText != "" {
+		token, err := strconv.ParseUint(afterText, 10, 64)
+		if err != nil {
+			return errorf(http.StatusBadRequest, "invalid change token: %s", afterText)
+		}
+		after = new(arnedb.ChangeToken)
+		*after = arnedb.ChangeToken(token)
+	}
+
+	ctx := r.Context()
+	var events <-chan arnedb.ChangeEvent
+	var err error
+	switch {
+	case coll == nil && after == nil:
+		events, err = db.Watch(ctx)
+	case coll == nil:
+		events, err = db.WatchFrom(ctx, *after)
+	case after == nil:
+		events, err = coll.Watch(ctx, predicate(filter))
+	default:
+		events, err = coll.WatchFrom(ctx, predicate(filter), *after)
+	}
+	if err != nil {
+		return &httpError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if s.heartbeat > 0 {
+		ticker := time.NewTicker(s.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat:
+			if _, err = io.WriteString(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case e, open := <-events:
+			if !open {
+				return nil // istemci son token ile yeniden bağlanabilir
+			}
+			// Veritabanı seviyesinde filtre ve yetki burada uygulanır
+			if coll == nil && ((filter != nil && !filter.Match(e.Doc)) || s.authorize(user, db.Name, e.Coll, PermRead) != nil) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Token, e.Type, data); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// decode reads the JSON body of the request. An empty body leaves v unchanged.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body := r.Body
+	if s.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, s.maxBodySize)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return errorf(http.StatusRequestEntityTooLarge, "cannot read the body: %s", err.Error())
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(content, v); err != nil {
+		return errorf(http.StatusBadRequest, "invalid body: %s", err.Error())
+	}
+	return nil
+}
+
+// dbNames returns the names of the databases the user can access
+func (s *Server) dbNames(user *User) []string {
+	names := make([]string, 0, len(s.dbs))
+	for name := range s.dbs {
+		if s.auth == nil || s.auth.canAccessDB(user, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getColl checks the permission of the user and returns the collection
+func (s *Server) getColl(user *User, db *arnedb.ArneDB, name string, perm Permission) (*arnedb.Coll, error) {
+	if err := s.authorize(user, db.Name, name, perm); err != nil {
+		return nil, err
+	}
+	coll := db.GetColl(name)
+	if coll == nil {
+		return nil, errorf(http.StatusNotFound, "collection does not exist: %s", name)
+	}
+	return coll, nil
+}
+
+// authorize checks that the user has the permission on the collection. An empty coll means the
+// whole database. Everything is allowed if the server has no auth.
+func (s *Server) authorize(user *User, db, coll string, perm Permission) error {
+	if s.auth == nil || s.auth.Permission(user, db, coll) >= perm {
+		return nil
+	}
+	target := db
+	if coll != "" {
+		target += "/" + coll
+	}
+	return errorf(http.StatusForbidden, "permission denied: %s requires %s permission on %s", user.Name, perm, target)
+}
+
+// token issues a token to the user. Only API keys can get tokens, so a token cannot be extended.
+func (s *Server) token(w http.ResponseWriter, r *http.Request, user *User) error {
+	if err := allow(w, r, http.MethodPost); err != nil {
+		return err
+	}
+	if s.auth == nil || s.auth.secret == nil {
+		return errorf(http.StatusNotFound, "tokens are not enabled")
+	}
+	if !strings.HasPrefix(credentialOf(r), apiKeyPrefix) {
+		return errorf(http.StatusForbidden, "tokens can only be requested with an API key")
+	}
+
+	var body struct {
+		TTL int64 `json:"ttl"` // Saniye
+	}
+	if err := s.decode(w, r, &body); err != nil {
+		return err
+	}
+	ttl := defaultTokenTTL
+	if body.TTL < 0 {
+		return errorf(http.StatusBadRequest, "ttl cannot be negative")
+	} else if body.TTL > 0 {
+		ttl = time.Duration(body.TTL) * time.Second
+	}
+
+	token, err := s.auth.IssueToken(user.Name, ttl)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, map[string]interface{}{"token": token, "expiresIn": int64(ttl / time.Second)})
+}
+
+// parseFilter parses a filter document. A missing filter matches all the documents.
+func parseFilter(raw []byte) (*arnedb.Filter, error) {
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		raw = []byte("{}")
+	}
+	filter, err := arnedb.ParseFilter(raw)
+	if err != nil {
+		return nil, &httpError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+	return filter, nil
+}
+
+func predicate(filter *arnedb.Filter) arnedb.QueryPredicate {
+	if filter == nil {
+		return nil
+	}
+	return filter.Predicate()
+}
+
+// splitPath splits the escaped path into unescaped parts
+func splitPath(path string) ([]string, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, nil
+	}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid path: %s", err.Error())
+		}
+		parts[i] = unescaped
+	}
+	return parts, nil
+}
+
+// allow checks the method of the request
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) error {
+	for _, method := range methods {
+		if r.Method == method {
+			return nil
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	return errorf(http.StatusMethodNotAllowed, "method not allowed: %s", r.Method)
+}
+
+// statusOf finds the status code of an error
+func statusOf(err error) int {
+	var httpErr *httpError
+	var readOnlyErr *arnedb.ReadOnlyError
+	var validationErr *arnedb.ValidationError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.status
+	case errors.As(err, &readOnlyErr):
+		return http.StatusForbidden
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	_ = writeJSON(w, statusOf(err), map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(content, '\n')) // başlık yazıldı, hata artık bildirilemez
+	return nil
+}
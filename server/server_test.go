@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgulsoy/arnedb"
+)
+
+// call sends a request to the handler and decodes the JSON response into out
+func call(t *testing.T, h http.Handler, method, path, body string, out interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if out != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s returned invalid json %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestServer(t *testing.T) {
+	db, err := arnedb.OpenInMemory("shop")
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	ro, err := arnedb.OpenInMemory("archive", arnedb.WithReadOnly())
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	h := New([]*arnedb.ArneDB{db, ro})
+
+	var names []string
+	if code := call(t, h, "GET", "/dbs", "", &names); code != 200 || strings.Join(names, ",") != "archive,shop" {
+		t.Error("list databases unexpected result:", code, names)
+	}
+
+	var result map[string]interface{}
+	if code := call(t, h, "POST", "/dbs/shop/colls", `{"name": "people"}`, &result); code != 201 {
+		t.Fatal("create collection failed:", code, result)
+	}
+	for body, want := range map[string]int{`{"name": "people"}`: 409, `{"name": "../x"}`: 400, `{"name": ""}`: 400, `{`: 400} {
+		if code := call(t, h, "POST", "/dbs/shop/colls", body, nil); code != want {
+			t.Errorf("create collection with %s expected %d, got %d", body, want, code)
+		}
+	}
+	if code := call(t, h, "POST", "/dbs/archive/colls", `{"name": "x"}`, nil); code != 403 {
+		t.Error("create collection in a read-only database expected 403, got:", code)
+	}
+	if code := call(t, h, "GET", "/dbs/shop/colls", "", &names); code != 200 || len(names) != 1 || names[0] != "people" {
+		t.Error("list collections unexpected result:", code, names)
+	}
+
+	docs := `[{"id": 1, "name": "Ada", "age": 36}, {"id": 2, "name": "Linus", "age": 21},
+		{"id": 3, "name": "Grace", "age": 85}, {"id": 4, "name": "Ken", "age": 79}]`
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/docs", docs, &result); code != 201 || result["inserted"] != 4.0 {
+		t.Fatal("insert failed:", code, result)
+	}
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/docs", `{"id": 5, "name": "Dennis", "age": 70}`, &result); code != 201 || result["inserted"] != 1.0 {
+		t.Error("insert of a single document failed:", code, result)
+	}
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/docs", `"text"`, nil); code != 400 {
+		t.Error("insert of a non document expected 400, got:", code)
+	}
+
+	var query struct {
+		Docs []arnedb.RecordInstance `json:"docs"`
+	}
+	body := `{"filter": {"age": {"$gte": 30}}, "sort": [{"field": "age", "desc": true}], "skip": 1, "limit": 2}`
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/query", body, &query); code != 200 || len(query.Docs) != 2 ||
+		query.Docs[0]["name"] != "Ken" || query.Docs[1]["name"] != "Dennis" {
+		t.Error("query unexpected result:", code, query.Docs)
+	}
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/query", "", &query); code != 200 || len(query.Docs) != 5 {
+		t.Error("query without a body expected all the documents:", code, len(query.Docs))
+	}
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/query", `{"filter": {"age": {"$bad": 1}}}`, nil); code != 400 {
+		t.Error("query with a bad filter expected 400, got:", code)
+	}
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/count", `{"filter": {"age": {"$lt": 40}}}`, &result); code != 200 || result["count"] != 2.0 {
+		t.Error("count unexpected result:", code, result)
+	}
+
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/update", `{"update": {"$set": {"x": 1}}}`, nil); code != 400 {
+		t.Error("update without a filter expected 400, got:", code)
+	}
+	body = `{"filter": {"age": {"$gte": 70}}, "update": {"$set": {"retired": true}}}`
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/update", body, &result); code != 200 || result["updated"] != 3.0 {
+		t.Error("update unexpected result:", code, result)
+	}
+	if code := call(t, h, "POST", "/dbs/shop/colls/people/delete", `{"filter": {"retired": true}}`, &result); code != 200 || result["deleted"] != 3.0 {
+		t.Error("delete unexpected result:", code, result)
+	}
+
+	var info arnedb.CollInfo
+	if code := call(t, h, "GET", "/dbs/shop/colls/people", "", &info); code != 200 || info.Docs != 2 {
+		t.Error("collection info unexpected result:", code, info)
+	}
+
+	if code := call(t, h, "GET", "/dbs/shop/colls/people/query", "", nil); code != 405 {
+		t.Error("wrong method expected 405, got:", code)
+	}
+	for _, path := range []string{"/", "/dbs/none", "/dbs/shop/colls/none", "/dbs/shop/colls/people/nothing", "/dbs/shop/other"} {
+		if code := call(t, h, "GET", path, "", &result); code != 404 || result["error"] == nil {
+			t.Errorf("GET %s expected 404, got %d %v", path, code, result)
+		}
+	}
+
+	if code := call(t, h, "DELETE", "/dbs/shop/colls/people", "", nil); code != 204 {
+		t.Error("delete collection expected 204, got:", code)
+	}
+	if db.GetColl("people") != nil {
+		t.Error("collection is not deleted")
+	}
+}
+
+func TestServerChanges(t *testing.T) {
+	db, err := arnedb.OpenInMemory("shop")
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	people, err := db.CreateColl("people")
+	if err != nil {
+		t.Fatal("CreateColl failed with:", err)
+	}
+
+	ts := httptest.NewServer(New([]*arnedb.ArneDB{db}, WithHeartbeat(10*time.Millisecond)))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+`/dbs/shop/colls/people/changes?filter={"age":{"$gte":18}}`, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("change stream request failed with:", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("change stream unexpected response:", resp.Status, resp.Header)
+	}
+
+	// Akış açıldıktan sonra kayıt eklenir
+	go func() {
+		_ = people.Add(arnedb.RecordInstance{"name": "Kid", "age": 7})
+		_ = people.Add(arnedb.RecordInstance{"name": "Ada", "age": 36})
+	}()
+
+	reader := bufio.NewReader(resp.Body)
+	var event map[string]string
+	for event == nil || event["data"] == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal("change stream ended with:", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" || strings.HasPrefix(line, ":"): // boş satır veya heartbeat
+		default:
+			if event == nil {
+				event = make(map[string]string)
+			}
+			kv := strings.SplitN(line, ": ", 2)
+			event[kv[0]] = kv[1]
+		}
+	}
+
+	var change arnedb.ChangeEvent
+	if err = json.Unmarshal([]byte(event["data"]), &change); err != nil {
+		t.Fatal("invalid event data:", err)
+	}
+	if event["event"] != "insert" || event["id"] == "" || change.Doc["name"] != "Ada" {
+		t.Error("change stream unexpected event:", event)
+	}
+
+	rec := httptest.NewRecorder()
+	New([]*arnedb.ArneDB{db}).ServeHTTP(rec, httptest.NewRequest("GET", "/dbs/shop/changes?after=1", nil))
+	if rec.Code != 400 {
+		t.Error("resuming without a change log expected 400, got:", rec.Code)
+	}
+}
@@ -0,0 +1,344 @@
+package arnedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// FieldStats holds the statistics of a single field. It is computed by Coll.Stats.
+type FieldStats struct {
+	// Field is the examined field path
+	Field string
+	// Count is the number of documents scanned
+	Count int
+	// NullCount is the number of documents where the field is null or missing
+	NullCount int
+	// Min is the smallest scalar value of the field. Values are ordered by type first
+	// (bool < number < string) and then by value. It is nil if there is no scalar value.
+	Min interface{}
+	// Max is the largest scalar value of the field. Ordering is the same as Min.
+	Max interface{}
+	// Cardinality is the estimated count of distinct values. It is computed using HyperLogLog
+	// so it is an approximation for large collections.
+	Cardinality uint64
+	// Types is the histogram of the value types. Keys are: missing, null, bool, number, string,
+	// array and object
+	Types map[string]int
+}
+
+// Distinct function returns the distinct values of the given field among the records matched by the
+// predicate. If predicate is nil all the records are examined. Records which do not have the field
+// are skipped. The values are returned in the order they are first seen. Field can be a dotted path
+// for nested documents like "address.city".
+func (coll *Coll) Distinct(field string, predicate QueryPredicate) (result []interface{}, err error) {
+	result = make([]interface{}, 0)
+	seen := make(map[string]struct{})
+
+	err = coll.scanField(field, predicate, func(value interface{}, found bool) bool {
+		if !found {
+			return true
+		}
+		key, err := json.Marshal(value)
+		if err != nil {
+			return true // karşılaştırılamayan değer
+		}
+		if _, exists := seen[string(key)]; !exists {
+			seen[string(key)] = struct{}{}
+			result = append(result, value)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Stats function computes the statistics of the given field in one pass over the collection.
+// Documents are not held in memory; for JSON collections only the field is decoded from each
+// record. Field can be a dotted path for nested documents.
+func (coll *Coll) Stats(field string) (*FieldStats, error) {
+	stats := FieldStats{
+		Field: field,
+		Types: make(map[string]int),
+	}
+	hll := newHyperLogLog()
+
+	err := coll.scanField(field, nil, func(value interface{}, found bool) bool {
+		stats.Count++
+		if !found {
+			stats.NullCount++
+			stats.Types["missing"]++
+			return true
+		}
+
+		typeName := valueTypeName(value)
+		stats.Types[typeName]++
+		if value == nil {
+			stats.NullCount++
+			return true
+		}
+
+		if key, err := json.Marshal(value); err == nil {
+			hll.add(key)
+		}
+
+		switch typeName {
+		case "bool", "number", "string":
+			if stats.Min == nil || compareValues(value, stats.Min) < 0 {
+				stats.Min = value
+			}
+			if stats.Max == nil || compareValues(value, stats.Max) > 0 {
+				stats.Max = value
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Cardinality = hll.estimate()
+	return &stats, nil
+}
+
+// scanField walks the records matched by the predicate and calls fn with the value of the field in
+// each one. Walking stops when fn returns false. Without a predicate the field of a JSON record is
+// extracted from the record text, other records are decoded as a whole. A panic raised in the
+// predicate or fn is returned as a predicate error.
+func (coll *Coll) scanField(field string, predicate QueryPredicate, fn func(value interface{}, found bool) bool) (err error) {
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return err
+	}
+
+	var f io.ReadCloser
+	// Burada predicate içinde oluşabilecek olan hatayı yakalarız.
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("predicate error: %v", r))
+			if f != nil { // dosya kapanmamışsa kapat
+				_ = f.Close()
+			}
+		}
+	}()
+
+	codec := coll.codec()
+	lazy := codec == JSONCodec && predicate == nil
+	now := time.Now() // süresi dolan kayıtlar gösterilmez
+	for _, chunk := range chunks {
+		f, err = coll.openChunk(chunk.Name())
+		if err != nil {
+			return err
+		}
+
+		scn := newRecordScanner(f)
+		goOn := true
+		for goOn && scn.Scan() {
+			line := scn.Bytes()
+			if len(line) == 0 || coll.expiredLine(line, now) {
+				continue
+			}
+			if lazy {
+				if !isRawObject(line) {
+					continue // skip this record
+				}
+				// Sadece istenen alan çözülür
+				value, found := rawLineGetter(line)(field)
+				goOn = fn(value, found)
+				continue
+			}
+
+			var data RecordInstance
+			if codec.Unmarshal(line, &data) != nil {
+				continue // skip this record
+			}
+			if predicate != nil && !predicate(data) {
+				continue
+			}
+			value, found := lookupField(data, field)
+			goOn = fn(value, found)
+		}
+		err = scn.Err()
+		_ = f.Close()
+		f = nil // temizle
+		if err != nil {
+			return err
+		}
+		if !goOn {
+			break
+		}
+	}
+
+	return nil
+}
+
+// lookupField returns the value of the field in the record. Dotted paths are resolved through nested
+// documents. A key containing dots itself is matched first.
+func lookupField(data RecordInstance, path string) (interface{}, bool) {
+	if value, found := data[path]; found {
+		return value, true
+	}
+
+	var current interface{} = map[string]interface{}(data)
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// valueTypeName returns the JSON type name of a decoded value
+func valueTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64, float32, int, int64, int32, uint64, uint32, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}, RecordInstance:
+		return "object"
+	}
+	return "unknown"
+}
+
+// typeRank gives the sort order of the scalar types
+var typeRank = map[string]int{"null": 0, "bool": 1, "number": 2, "string": 3, "array": 4, "object": 5, "unknown": 6}
+
+// compareValues compares two decoded values. Values of different types are ordered by type. It
+// returns -1, 0 or 1.
+func compareValues(a, b interface{}) int {
+	ta, tb := valueTypeName(a), valueTypeName(b)
+	if ta != tb {
+		if typeRank[ta] < typeRank[tb] {
+			return -1
+		}
+		return 1
+	}
+
+	switch ta {
+	case "bool":
+		ba, bb := a.(bool), b.(bool)
+		if ba == bb {
+			return 0
+		}
+		if !ba {
+			return -1
+		}
+		return 1
+	case "number":
+		na, nb := toFloat(a), toFloat(b)
+		if na < nb {
+			return -1
+		} else if na > nb {
+			return 1
+		}
+		return 0
+	case "string":
+		return strings.Compare(a.(string), b.(string))
+	}
+
+	return 0
+}
+
+// toFloat converts a numeric value to float64
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return 0
+}
+
+// hllPrecision is the number of bits used for register index. 2^14 registers give ~0.8% error.
+const hllPrecision = 14
+
+// hyperLogLog is a minimal cardinality estimator.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// add adds an element to the estimator
+func (h *hyperLogLog) add(element []byte) {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write(element)
+	x := mix64(hasher.Sum64())
+
+	idx := x >> (64 - hllPrecision)
+	rest := x<<hllPrecision | 1<<(hllPrecision-1) // sıfır olmaması için bir bit set edilir
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// estimate returns the estimated cardinality
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1.0 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// küçük değerler için linear counting
+		e = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(e + 0.5)
+}
+
+// mix64 is the splitmix64 finalizer. It spreads the fnv hash bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,129 @@
+package arnedb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDistinctAndStats(t *testing.T) {
+	_ = os.RemoveAll("testdb/statsdb")
+
+	pDb, err := Open("testdb", "statsdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+
+	coll, err := pDb.CreateColl("cities")
+	if err != nil {
+		t.Fatal("Create cities failed with:", err)
+	}
+
+	data := []RecordInstance{
+		{"id": 1, "city": "Ankara", "pop": 5.6, "address": map[string]interface{}{"zip": "06000"}},
+		{"id": 2, "city": "İzmir", "pop": 4.3},
+		{"id": 3, "city": "Ankara", "pop": nil},
+		{"id": 4, "city": "Bursa"},
+		{"id": 5, "city": 34, "address": map[string]interface{}{"zip": "16000"}},
+	}
+	if _, err = coll.AddAll(data...); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	values, err := coll.Distinct("city", nil)
+	if err != nil {
+		t.Fatal("Distinct failed with:", err)
+	}
+	if len(values) != 4 {
+		t.Errorf("Distinct expected 4 values, got %d: %v", len(values), values)
+	}
+
+	values, err = coll.Distinct("address.zip", func(instance RecordInstance) bool {
+		return instance["id"].(float64) < 5
+	})
+	if err != nil {
+		t.Fatal("Distinct with predicate failed with:", err)
+	}
+	if len(values) != 1 || values[0] != "06000" {
+		t.Errorf("Distinct nested expected [06000], got %v", values)
+	}
+
+	_, err = coll.Distinct("city", func(instance RecordInstance) bool {
+		return instance["nope"].(bool)
+	})
+	if err == nil {
+		t.Error("Distinct predicate panic is not reported")
+	}
+
+	stats, err := coll.Stats("pop")
+	if err != nil {
+		t.Fatal("Stats failed with:", err)
+	}
+	t.Logf("Stats(pop): %+v", stats)
+	if stats.Count != 5 || stats.NullCount != 3 {
+		t.Errorf("Stats count mismatch: count=%d nulls=%d", stats.Count, stats.NullCount)
+	}
+	if stats.Min != 4.3 || stats.Max != 5.6 {
+		t.Errorf("Stats min/max mismatch: %v %v", stats.Min, stats.Max)
+	}
+	if stats.Types["missing"] != 2 || stats.Types["null"] != 1 || stats.Types["number"] != 2 {
+		t.Errorf("Stats type histogram mismatch: %v", stats.Types)
+	}
+
+	stats, err = coll.Stats("city")
+	if err != nil {
+		t.Fatal("Stats failed with:", err)
+	}
+	if stats.Cardinality != 4 {
+		t.Errorf("Stats cardinality expected 4, got %d", stats.Cardinality)
+	}
+	if stats.Min != 34.0 || stats.Max != "İzmir" {
+		t.Errorf("Stats mixed min/max mismatch: %v %v", stats.Min, stats.Max)
+	}
+	stats, err = coll.Stats("address")
+	if err != nil || stats.Types["object"] != 2 || stats.Types["missing"] != 3 {
+		t.Errorf("Stats object field mismatch: %+v %v", stats, err)
+	}
+
+	// Çözülemeyen satırlar sayılmaz
+	f, err := os.OpenFile("testdb/statsdb/cities/00.json", os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal("OpenFile failed with:", err)
+	}
+	_, _ = f.WriteString("{broken\n{\"id\": 6, \"pop\": }\n[1, 2]\n")
+	_ = f.Close()
+	stats, err = coll.Stats("pop")
+	if err != nil || stats.Count != 5 || stats.Types["missing"] != 2 {
+		t.Errorf("Stats counted malformed records: %+v %v", stats, err)
+	}
+	if values, err = coll.Distinct("city", nil); err != nil || len(values) != 4 {
+		t.Errorf("Distinct with malformed records expected 4 values, got %v %v", values, err)
+	}
+
+	// Ham alan okuması olmayan codec'lerde kayıt tümüyle çözülür
+	packed, err := pDb.CreateColl("packed", WithCodec(MsgPackCodec))
+	if err != nil {
+		t.Fatal("Create packed failed with:", err)
+	}
+	if _, err = packed.AddAll(data...); err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+	values, err = packed.Distinct("address.zip", nil)
+	if err != nil || len(values) != 2 {
+		t.Errorf("Distinct on MessagePack expected 2 values, got %v %v", values, err)
+	}
+	stats, err = packed.Stats("pop")
+	if err != nil || stats.Count != 5 || stats.NullCount != 3 {
+		t.Errorf("Stats on MessagePack mismatch: %+v %v", stats, err)
+	}
+}
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	hll := newHyperLogLog()
+	for i := 0; i < 100000; i++ {
+		hll.add([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+	}
+	e := hll.estimate()
+	if e < 97000 || e > 103000 {
+		t.Errorf("HyperLogLog estimate is too far from 100000: %d", e)
+	}
+}
@@ -0,0 +1,393 @@
+package arnedb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage stores the files of a single database. Collections are groups of files and the database
+// itself may have files which are addressed with an empty collection name. Missing files are
+// reported with errors matching fs.ErrNotExist.
+type Storage interface {
+	// ListColls returns the names of the collections.
+	ListColls() ([]string, error)
+	// CreateColl creates an empty collection. It fails if the collection exists.
+	CreateColl(coll string) error
+	// RemoveColl removes the collection with all of its files.
+	RemoveColl(coll string) error
+	// RenameColl renames the collection atomically. It fails if the new collection exists.
+	RenameColl(oldName, newName string) error
+	// List returns the files of the collection.
+	List(coll string) ([]fs.FileInfo, error)
+	// Open opens a file for reading.
+	Open(coll, name string) (io.ReadCloser, error)
+	// Append appends data to a file. The file is created if it does not exist.
+	Append(coll, name string, data []byte) error
+	// Replace replaces the content of a file atomically. The file is created if it does not exist.
+	Replace(coll, name string, data []byte) error
+	// Rename renames a file atomically. An existing file with the new name is replaced.
+	Rename(coll, oldName, newName string) error
+	// Remove removes a file.
+	Remove(coll, name string) error
+}
+
+// readStorageFile returns the whole content of a file in the storage
+func readStorageFile(s Storage, coll, name string) ([]byte, error) {
+	r, err := s.Open(coll, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// fileInfo is the fs.FileInfo of the files which are not on disk
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() interface{}   { return nil }
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0700
+	}
+	return 0600
+}
+
+// Directory storage -------------------------------------------------------------------------------
+
+// dirStorage keeps every collection in a directory under the database directory. It is the
+// default storage used by Open.
+type dirStorage struct {
+	path string // Veritabanı klasörü
+}
+
+// NewDirStorage returns the default storage which keeps the database in the given directory. Each
+// collection is a sub directory.
+func NewDirStorage(path string) Storage {
+	return &dirStorage{path: path}
+}
+
+func (s *dirStorage) ListColls() ([]string, error) {
+	files, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0)
+	for _, finfo := range files {
+		if finfo.IsDir() {
+			result = append(result, finfo.Name())
+		}
+	}
+	return result, nil
+}
+
+func (s *dirStorage) CreateColl(coll string) error {
+	return os.Mkdir(filepath.Join(s.path, coll), 0700)
+}
+
+func (s *dirStorage) RemoveColl(coll string) error {
+	return os.RemoveAll(filepath.Join(s.path, coll))
+}
+
+func (s *dirStorage) RenameColl(oldName, newName string) error {
+	newPath := filepath.Join(s.path, newName)
+	if _, err := os.Stat(newPath); err == nil {
+		return &fs.PathError{Op: "rename", Path: newPath, Err: fs.ErrExist}
+	}
+	return os.Rename(filepath.Join(s.path, oldName), newPath)
+}
+
+func (s *dirStorage) List(coll string) ([]fs.FileInfo, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.path, coll))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]fs.FileInfo, 0, len(files))
+	for _, finfo := range files {
+		if !finfo.IsDir() {
+			result = append(result, finfo)
+		}
+	}
+	return result, nil
+}
+
+func (s *dirStorage) Open(coll, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.path, coll, name))
+}
+
+func (s *dirStorage) Append(coll, name string, data []byte) error {
+	f, err := os.OpenFile(filepath.Join(s.path, coll, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	write, err := f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if write != len(data) {
+		_ = f.Close()
+		return errors.New(fmt.Sprintf("append failed with: %d bytes diff", len(data)-write))
+	}
+	return f.Close()
+}
+
+func (s *dirStorage) Replace(coll, name string, data []byte) error {
+	filePath := filepath.Join(s.path, coll, name)
+
+	// Bozuk bir dosya bırakmamak için önce geçici dosyaya yazılır
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+func (s *dirStorage) Rename(coll, oldName, newName string) error {
+	return os.Rename(filepath.Join(s.path, coll, oldName), filepath.Join(s.path, coll, newName))
+}
+
+func (s *dirStorage) Remove(coll, name string) error {
+	return os.Remove(filepath.Join(s.path, coll, name))
+}
+
+// Memory storage ----------------------------------------------------------------------------------
+
+// memStorage keeps all the files in memory
+type memStorage struct {
+	mu    sync.RWMutex
+	colls map[string]map[string]*memFile // "" veritabanı dosyalarıdır
+}
+
+type memFile struct {
+	data    []byte // Sadece sonuna eklenir veya tamamen değiştirilir, okuyucular kopyalamadan kullanır
+	modTime time.Time
+}
+
+// NewMemStorage returns a storage which keeps the database in memory. The data is lost when the
+// storage is no longer referenced.
+func NewMemStorage() Storage {
+	return &memStorage{colls: map[string]map[string]*memFile{"": {}}}
+}
+
+func (s *memStorage) ListColls() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]string, 0, len(s.colls))
+	for name := range s.colls {
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (s *memStorage) CreateColl(coll string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.colls[coll]; found {
+		return &fs.PathError{Op: "create", Path: coll, Err: fs.ErrExist}
+	}
+	s.colls[coll] = make(map[string]*memFile)
+	return nil
+}
+
+func (s *memStorage) RemoveColl(coll string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.colls, coll)
+	return nil
+}
+
+func (s *memStorage) RenameColl(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, found := s.colls[oldName]
+	if !found {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	if _, found = s.colls[newName]; found {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrExist}
+	}
+	delete(s.colls, oldName)
+	s.colls[newName] = files
+	return nil
+}
+
+func (s *memStorage) List(coll string) ([]fs.FileInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files, found := s.colls[coll]
+	if !found {
+		return nil, &fs.PathError{Op: "list", Path: coll, Err: fs.ErrNotExist}
+	}
+
+	result := make([]fs.FileInfo, 0, len(files))
+	for name, f := range files {
+		result = append(result, fileInfo{name: name, size: int64(len(f.data)), modTime: f.modTime})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+func (s *memStorage) Open(coll, name string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, err := s.file(coll, name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (s *memStorage) Append(coll, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, found := s.colls[coll]
+	if !found {
+		return &fs.PathError{Op: "append", Path: path.Join(coll, name), Err: fs.ErrNotExist}
+	}
+	f, found := files[name]
+	if !found {
+		f = &memFile{}
+		files[name] = f
+	}
+	// Okuyucular eski dilimi kullanır. Eklenen veri dilimin sonrasına yazıldığı için onları etkilemez.
+	f.data = append(f.data, data...)
+	f.modTime = time.Now()
+	return nil
+}
+
+func (s *memStorage) Replace(coll, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, found := s.colls[coll]
+	if !found {
+		return &fs.PathError{Op: "replace", Path: path.Join(coll, name), Err: fs.ErrNotExist}
+	}
+	files[name] = &memFile{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (s *memStorage) Rename(coll, oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.file(coll, oldName)
+	if err != nil {
+		return err
+	}
+	delete(s.colls[coll], oldName)
+	s.colls[coll][newName] = f
+	return nil
+}
+
+func (s *memStorage) Remove(coll, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file(coll, name); err != nil {
+		return err
+	}
+	delete(s.colls[coll], name)
+	return nil
+}
+
+// file returns the file. The caller must hold the lock.
+func (s *memStorage) file(coll, name string) (*memFile, error) {
+	f, found := s.colls[coll][name]
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: path.Join(coll, name), Err: fs.ErrNotExist}
+	}
+	return f, nil
+}
+
+// fs.FS storage -----------------------------------------------------------------------------------
+
+// fsStorage reads the database from a fs.FS. It is read-only.
+type fsStorage struct {
+	fsys fs.FS
+	root string // Veritabanı klasörü, fs.FS yolu
+}
+
+// NewFSStorage returns a read-only storage which reads the database in the root directory of fsys.
+// It can be used with embed.FS or zip readers. Writing methods fail.
+func NewFSStorage(fsys fs.FS, root string) Storage {
+	return &fsStorage{fsys: fsys, root: root}
+}
+
+func (s *fsStorage) ListColls() ([]string, error) {
+	entries, err := fs.ReadDir(s.fsys, s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			result = append(result, entry.Name())
+		}
+	}
+	return result, nil
+}
+
+func (s *fsStorage) List(coll string) ([]fs.FileInfo, error) {
+	entries, err := fs.ReadDir(s.fsys, path.Join(s.root, coll))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		finfo, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, finfo)
+	}
+	return result, nil
+}
+
+func (s *fsStorage) Open(coll, name string) (io.ReadCloser, error) {
+	return s.fsys.Open(path.Join(s.root, coll, name))
+}
+
+func (s *fsStorage) CreateColl(string) error              { return &ReadOnlyError{Op: "CreateColl"} }
+func (s *fsStorage) RemoveColl(string) error              { return &ReadOnlyError{Op: "RemoveColl"} }
+func (s *fsStorage) RenameColl(string, string) error      { return &ReadOnlyError{Op: "RenameColl"} }
+func (s *fsStorage) Append(string, string, []byte) error  { return &ReadOnlyError{Op: "Append"} }
+func (s *fsStorage) Replace(string, string, []byte) error { return &ReadOnlyError{Op: "Replace"} }
+func (s *fsStorage) Rename(string, string, string) error  { return &ReadOnlyError{Op: "Rename"} }
+func (s *fsStorage) Remove(string, string) error          { return &ReadOnlyError{Op: "Remove"} }
@@ -0,0 +1,100 @@
+package arnedb
+
+import (
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMemStorage(t *testing.T) {
+	storage := NewMemStorage()
+	pDb, err := OpenStorage("memdb", storage, WithEncryptionKey([]byte("0123456789abcdef")), WithChangeLog())
+	if err != nil {
+		t.Fatal("OpenStorage failed with:", err)
+	}
+
+	items, err := pDb.CreateColl("items", WithCompression(gzip.BestSpeed))
+	if err != nil {
+		t.Fatal("Create items failed with:", err)
+	}
+	if _, err = pDb.CreateColl("items"); err == nil {
+		t.Error("Existing collection is created again")
+	}
+
+	text := strings.Repeat("memory ", 200)
+	for i := 0; i < 1000; i++ {
+		if err = items.Add(RecordInstance{"seq": i, "text": text}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	if err = items.SetSchema([]byte(`{"required": ["seq"]}`)); err != nil {
+		t.Fatal("SetSchema failed with:", err)
+	}
+	n, err := items.DeleteAll(func(i RecordInstance) bool { return i["seq"].(float64) >= 500 })
+	if err != nil || n != 500 {
+		t.Fatalf("DeleteAll returned %d, %v", n, err)
+	}
+
+	chunks, _ := items.getChunks()
+	if len(chunks) < 2 || !isCompressedChunk(chunks[0].Name()) {
+		t.Errorf("Sealed chunks are not compressed: %v", chunks)
+	}
+
+	// Aynı storage yeniden açılır
+	pDb, err = OpenStorage("memdb", storage, WithEncryptionKey([]byte("0123456789abcdef")), WithChangeLog())
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	items = pDb.GetColl("items")
+	if items == nil || items.GetSchema() == nil || items.GetCompression() == nil {
+		t.Fatal("Collection settings are not loaded")
+	}
+	n, err = items.Count(func(RecordInstance) bool { return true })
+	if err != nil || n != 500 {
+		t.Errorf("Count returned %d, %v", n, err)
+	}
+	if pDb.changeSeq != 1500 {
+		t.Errorf("Last change token is %d", pDb.changeSeq)
+	}
+
+	if err = pDb.DeleteColl("items"); err != nil {
+		t.Fatal("DeleteColl failed with:", err)
+	}
+	if err = items.Add(RecordInstance{"seq": 1}); err == nil {
+		t.Error("Add to a deleted collection succeeded")
+	}
+}
+
+func TestFSStorage(t *testing.T) {
+	_ = os.RemoveAll("testdb/fsdb")
+
+	pDb, err := Open("testdb", "fsdb")
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	cities, err := pDb.CreateColl("cities")
+	if err != nil {
+		t.Fatal("Create cities failed with:", err)
+	}
+	_, err = cities.AddAll(RecordInstance{"name": "İzmir"}, RecordInstance{"name": "Ankara"})
+	if err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	fsDb, err := OpenStorage("fsdb", NewFSStorage(os.DirFS("testdb"), "fsdb"))
+	if err != nil {
+		t.Fatal("OpenStorage failed with:", err)
+	}
+	cities = fsDb.GetColl("cities")
+	if cities == nil {
+		t.Fatal("Collection is not loaded")
+	}
+	found, err := cities.GetFirst(func(i RecordInstance) bool { return i["name"] == "Ankara" })
+	if err != nil || found == nil {
+		t.Errorf("GetFirst returned %v, %v", found, err)
+	}
+	if err = cities.Add(RecordInstance{"name": "Bursa"}); err == nil {
+		t.Error("Add to a read-only storage succeeded")
+	}
+}
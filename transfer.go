@@ -0,0 +1,235 @@
+package arnedb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// tmpCollPrefix marks the collections which are being built by CopyColl and MoveColl. They are not
+// loaded as collections.
+const tmpCollPrefix = "."
+
+// RenameColl function renames a collection. The collection keeps its documents and settings and the
+// existing *Coll values refer to the new name. Renaming is atomic.
+func (db *ArneDB) RenameColl(oldName, newName string) error {
+	if err := db.checkWritable("RenameColl"); err != nil {
+		return err
+	}
+	if err := CheckCollName(newName); err != nil {
+		return err
+	}
+
+	coll := db.GetColl(oldName)
+	if coll == nil {
+		return errors.New("collection does not exist")
+	}
+
+	// Önce kolleksiyon sonra kolleksiyon listesi kilitlenir
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	db.collsMu.Lock()
+	defer db.collsMu.Unlock()
+
+	if db.colls[oldName] != coll {
+		return errors.New("collection does not exist")
+	}
+	if _, found := db.colls[newName]; found {
+		return errors.New(fmt.Sprintf("a collection exists with the same name: %s", newName))
+	}
+
+	if err := db.storage.RenameColl(oldName, newName); err != nil {
+		return errors.New(fmt.Sprintf("cannot rename collection: %s", err.Error()))
+	}
+	db.cache.invalidateColl(oldName)
+	db.cache.invalidateColl(newName)
+
+	coll.nameMu.Lock()
+	coll.Name = newName
+	coll.nameMu.Unlock()
+	delete(db.colls, oldName)
+	db.colls[newName] = coll
+	return nil
+}
+
+// CopyColl function copies a collection into a new collection and returns it. If predicate is not
+// nil only the matching documents are copied. Settings and the schema are copied too, hooks are not.
+// The copy is built under a temporary name and renamed when it is complete, so the new collection
+// appears atomically. Writes to the source collection wait while it is copied.
+func (db *ArneDB) CopyColl(srcName, dstName string, predicate QueryPredicate) (*Coll, error) {
+	if err := db.checkWritable("CopyColl"); err != nil {
+		return nil, err
+	}
+
+	src := db.GetColl(srcName)
+	if src == nil {
+		return nil, errors.New("collection does not exist")
+	}
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.copyLocked(db, dstName, predicate)
+}
+
+// MoveColl function moves a collection into another open database and returns the moved collection.
+// Documents are encrypted with the key of the target database. The collection is copied first and
+// removed from the source after the copy appears in the target, so a failure never loses it.
+func (db *ArneDB) MoveColl(collName string, target *ArneDB) (*Coll, error) {
+	if target == db {
+		return nil, errors.New("cannot move into the same database, use RenameColl")
+	}
+	if err := db.checkWritable("MoveColl"); err != nil {
+		return nil, err
+	}
+
+	src := db.GetColl(collName)
+	if src == nil {
+		return nil, errors.New("collection does not exist")
+	}
+
+	// Kopyalama bitene kadar kaynağa yazılamaz, böylece hiçbir kayıt kaybolmaz
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	c, err := src.copyLocked(target, collName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	db.collsMu.Lock()
+	defer db.collsMu.Unlock()
+	if err = db.storage.RemoveColl(collName); err != nil {
+		return c, errors.New(fmt.Sprintf("collection is copied but cannot be removed: %s", err.Error()))
+	}
+	db.cache.invalidateColl(collName)
+	delete(db.colls, collName)
+	return c, nil
+}
+
+// copyLocked copies the collection into the target database. The caller must hold the lock of the
+// collection.
+func (coll *Coll) copyLocked(target *ArneDB, dstName string, predicate QueryPredicate) (c *Coll, err error) {
+	if err = target.checkWritable("CopyColl"); err != nil {
+		return nil, err
+	}
+	if err = CheckCollName(dstName); err != nil {
+		return nil, err
+	}
+	if target.GetColl(dstName) != nil {
+		return nil, errors.New(fmt.Sprintf("a collection exists with the same name: %s", dstName))
+	}
+
+	tmpName := tmpCollPrefix + dstName + ".tmp"
+	_ = target.storage.RemoveColl(tmpName) // yarım kalmış bir kopya olabilir
+	if err = target.storage.CreateColl(tmpName); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = target.storage.RemoveColl(tmpName)
+		}
+	}()
+
+	// Ayarlar ve şema olduğu gibi kopyalanır
+	for _, name := range []string{metaFileName, schemaFileName} {
+		var content []byte
+		content, err = readStorageFile(coll.db.storage, coll.GetName(), name)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+			continue
+		}
+		if err == nil {
+			err = target.storage.Replace(tmpName, name, content)
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("cannot copy %s: %s", name, err.Error()))
+		}
+	}
+
+	// Kayıtlar hedef veritabanının anahtarı ile şifrelenir
+	tmp := &Coll{Name: tmpName, db: target}
+	coll.metaMu.RLock()
+	tmp.meta = coll.meta
+	coll.metaMu.RUnlock()
+
+	chunks, err := coll.getChunks()
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks {
+		var content []byte
+		content, err = coll.readChunk(chunk.Name())
+		if err == nil && predicate != nil {
+			content, err = coll.filterChunk(content, predicate)
+			if err == nil && len(content) == 0 {
+				continue // hiç kayıt kalmadı
+			}
+		}
+		if err == nil {
+			content, err = tmp.encodeChunk(chunk.Name(), content, target.cipher())
+		}
+		if err == nil {
+			err = target.storage.Replace(tmpName, chunk.Name(), content)
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("cannot copy chunk %s: %s", chunk.Name(), err.Error()))
+		}
+	}
+
+	// Kopya tamamlandı, yerine konur
+	target.collsMu.Lock()
+	defer target.collsMu.Unlock()
+	if _, found := target.colls[dstName]; found {
+		err = errors.New(fmt.Sprintf("a collection exists with the same name: %s", dstName))
+		return nil, err
+	}
+	if err = target.storage.RenameColl(tmpName, dstName); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot rename collection: %s", err.Error()))
+	}
+	target.cache.invalidateColl(dstName)
+
+	c = &Coll{Name: dstName, db: target}
+	if err = c.loadMeta(); err == nil {
+		err = c.loadSchema()
+	}
+	if err != nil {
+		_ = target.storage.RemoveColl(dstName)
+		return nil, err
+	}
+	target.colls[dstName] = c
+	if c.GetTTL() != nil {
+		target.startSweeper()
+	}
+	return c, nil
+}
+
+// filterChunk returns the records of the chunk content matching the predicate. Deleted records are
+// dropped.
+func (coll *Coll) filterChunk(content []byte, predicate QueryPredicate) (result []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = errors.New(fmt.Sprintf("predicate error: %v", r))
+		}
+	}()
+
+	codec := coll.codec()
+	var buffer bytes.Buffer
+	scn := newRecordScanner(bytes.NewReader(content))
+	for scn.Scan() {
+		line := scn.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var data RecordInstance
+		if codec.Unmarshal(line, &data) != nil {
+			continue // skip this record
+		}
+		if predicate(data) {
+			buffer.Write(line)
+			buffer.WriteString(recordSepStr)
+		}
+	}
+	return buffer.Bytes(), scn.Err()
+}
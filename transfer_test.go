@@ -0,0 +1,161 @@
+package arnedb
+
+import (
+	"compress/gzip"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestRenameCopyMoveColl(t *testing.T) {
+	_ = os.RemoveAll("testdb/transferdb")
+
+	pDb, err := Open("testdb", "transferdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	people, err := pDb.CreateColl("people", WithCompression(gzip.BestSpeed))
+	if err != nil {
+		t.Fatal("Create people failed with:", err)
+	}
+	if err = people.SetSchema([]byte(`{"type": "object", "required": ["id"]}`)); err != nil {
+		t.Fatal("SetSchema failed with:", err)
+	}
+	for i := 1; i <= 10; i++ {
+		if err = people.Add(RecordInstance{"id": i, "name": "Person"}); err != nil {
+			t.Fatal("Add failed with:", err)
+		}
+	}
+	if _, err = pDb.CreateColl("other"); err != nil {
+		t.Fatal("Create other failed with:", err)
+	}
+
+	// Rename
+	if err = pDb.RenameColl("people", "other"); err == nil {
+		t.Error("RenameColl onto an existing collection expected to fail")
+	}
+	for _, bad := range []string{"", ".hidden", "a/b"} {
+		if err = pDb.RenameColl("people", bad); err == nil {
+			t.Errorf("RenameColl to %q expected to fail", bad)
+		}
+		if _, err = pDb.CreateColl(bad); err == nil {
+			t.Errorf("CreateColl %q expected to fail", bad)
+		}
+	}
+	if err = pDb.RenameColl("nope", "nope2"); err == nil {
+		t.Error("RenameColl of a missing collection expected to fail")
+	}
+	if err = pDb.RenameColl("people", "persons"); err != nil {
+		t.Fatal("RenameColl failed with:", err)
+	}
+	if pDb.GetColl("people") != nil || pDb.GetColl("persons") != people || people.Name != "persons" {
+		t.Error("RenameColl did not update the collections")
+	}
+	if err = people.Add(RecordInstance{"id": 11}); err != nil {
+		t.Error("Add after RenameColl failed with:", err)
+	}
+	if err = people.Add(RecordInstance{"name": "no id"}); err == nil {
+		t.Error("schema is lost after RenameColl")
+	}
+
+	// Copy
+	copied, err := pDb.CopyColl("persons", "evens", func(instance RecordInstance) bool {
+		return int(instance["id"].(float64))%2 == 0
+	})
+	if err != nil {
+		t.Fatal("CopyColl failed with:", err)
+	}
+	if n, _ := copied.Count(func(RecordInstance) bool { return true }); n != 5 {
+		t.Errorf("CopyColl expected 5 records, got %d", n)
+	}
+	if n, _ := people.Count(func(RecordInstance) bool { return true }); n != 11 {
+		t.Errorf("CopyColl changed the source, got %d records", n)
+	}
+	if copied.GetCompression() == nil || copied.GetSchema() == nil {
+		t.Error("CopyColl did not copy the settings")
+	}
+	if _, err = pDb.CopyColl("persons", "evens", nil); err == nil {
+		t.Error("CopyColl onto an existing collection expected to fail")
+	}
+	if _, err = pDb.CopyColl("persons", "broken", func(instance RecordInstance) bool {
+		return instance["nope"].(bool)
+	}); err == nil {
+		t.Error("CopyColl predicate panic is not reported")
+	}
+	if pDb.GetColl("broken") != nil {
+		t.Error("failed CopyColl left a collection")
+	}
+
+	// Move
+	target, err := OpenInMemory("targetdb", WithEncryptionKey([]byte("0123456789abcdef")))
+	if err != nil {
+		t.Fatal("OpenInMemory failed with:", err)
+	}
+	if _, err = pDb.MoveColl("persons", pDb); err == nil {
+		t.Error("MoveColl into the same database expected to fail")
+	}
+	moved, err := pDb.MoveColl("persons", target)
+	if err != nil {
+		t.Fatal("MoveColl failed with:", err)
+	}
+	if pDb.GetColl("persons") != nil || target.GetColl("persons") != moved {
+		t.Error("MoveColl did not update the collections")
+	}
+	if n, _ := moved.Count(func(RecordInstance) bool { return true }); n != 11 {
+		t.Errorf("MoveColl expected 11 records, got %d", n)
+	}
+	chunks, _ := moved.getChunks()
+	raw, _ := readStorageFile(target.storage, "persons", chunks[0].Name())
+	if len(raw) == 0 || raw[0] == '{' {
+		t.Error("moved records are not encrypted with the target key")
+	}
+
+	// Yarım kalmış kopyalar yüklenmez
+	if err = os.Mkdir("testdb/transferdb/.half.tmp", 0700); err != nil {
+		t.Fatal("Mkdir failed with:", err)
+	}
+	pDb, err = Open("testdb", "transferdb")
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	if pDb.GetColl(".half.tmp") != nil || pDb.GetColl("evens") == nil || pDb.GetColl("persons") != nil {
+		t.Errorf("Reopen loaded wrong collections: %v", pDb.GelCollNames())
+	}
+}
+
+func TestRenameCollWhileReading(t *testing.T) {
+	_ = os.RemoveAll("testdb/renamereaddb")
+
+	pDb, err := Open("testdb", "renamereaddb", WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	items, _ := pDb.CreateColl("a")
+	_, _ = items.AddAll(RecordInstance{"id": 1}, RecordInstance{"id": 2})
+
+	// Okuyucular kilit almadan adı okur, -race ile çalıştırılmalı
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, _ = items.Count(func(RecordInstance) bool { return true })
+			_ = items.GetName()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		from, to := "a", "b"
+		if i%2 == 1 {
+			from, to = "b", "a"
+		}
+		if err = pDb.RenameColl(from, to); err != nil {
+			t.Fatal("RenameColl failed with:", err)
+		}
+	}
+	wg.Wait()
+	if items.GetName() != "a" {
+		t.Errorf("collection name expected to be a, got %s", items.GetName())
+	}
+
+	_ = os.RemoveAll("testdb/renamereaddb")
+}
@@ -0,0 +1,193 @@
+package arnedb
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultSweepInterval is the period of the background sweeper removing expired records.
+const defaultSweepInterval = time.Minute
+
+// TTLOptions describes the expiry of the records in a collection.
+type TTLOptions struct {
+	// Field is the name of the field holding a time. It can be a unix timestamp in seconds or a
+	// RFC 3339 formatted string (time.Time values are marshalled this way).
+	Field string `json:"field"`
+	// After is the lifetime of a record counted from the time in Field. If it is zero, Field is
+	// treated as the expiry time of the record itself.
+	After time.Duration `json:"after"`
+}
+
+// SetTTL enables the expiry of records in the collection. If after is greater than zero, a record
+// expires when the given duration passes after the time stored in field. If after is zero, field
+// holds the expiry time of each record. Records without the field never expire. Expired records are
+// hidden from the queries and the manipulation functions. They are removed by the background
+// sweeper or PurgeExpired.
+// Passing an empty field disables expiry.
+func (coll *Coll) SetTTL(field string, after time.Duration) error {
+	if err := coll.db.checkWritable("SetTTL"); err != nil {
+		return err
+	}
+
+	if after < 0 {
+		return errors.New("ttl duration cannot be negative")
+	}
+
+	coll.metaMu.Lock()
+	defer coll.metaMu.Unlock()
+
+	old := coll.meta.TTL
+	if field == "" {
+		coll.meta.TTL = nil
+	} else {
+		coll.meta.TTL = &TTLOptions{Field: field, After: after}
+	}
+
+	if err := coll.saveMeta(); err != nil {
+		coll.meta.TTL = old
+		return err
+	}
+	if coll.meta.TTL != nil {
+		coll.db.startSweeper()
+	}
+	return nil
+}
+
+// GetTTL returns the expiry settings of the collection or nil if records do not expire.
+func (coll *Coll) GetTTL() *TTLOptions {
+	coll.metaMu.RLock()
+	defer coll.metaMu.RUnlock()
+	return coll.meta.TTL
+}
+
+// PurgeExpired removes the expired records of the collection and returns the count of the removed
+// records. Chunks are rewritten one by one.
+func (coll *Coll) PurgeExpired() (int, error) {
+	if coll.GetTTL() == nil {
+		return 0, nil
+	}
+
+	now := time.Now()
+	return coll.deleteAll("PurgeExpired", func(instance RecordInstance) bool {
+		return coll.expired(instance, now)
+	}, true)
+}
+
+// expired checks whether the record has expired at the given time
+func (coll *Coll) expired(data RecordInstance, now time.Time) bool {
+	ttl := coll.GetTTL()
+	if ttl == nil {
+		return false
+	}
+
+	value, found := lookupField(data, ttl.Field)
+	return found && ttl.expiredAt(value, now)
+}
+
+// expiredLine checks whether the record line has expired. It returns false quickly if the
+// collection has no expiry settings. Only the TTL field is decoded from JSON records.
+func (coll *Coll) expiredLine(line []byte, now time.Time) bool {
+	ttl := coll.GetTTL()
+	if ttl == nil {
+		return false
+	}
+
+	codec := coll.codec()
+	if codec == JSONCodec {
+		value, found := rawLineGetter(line)(ttl.Field)
+		return found && ttl.expiredAt(value, now)
+	}
+
+	var data RecordInstance
+	if codec.Unmarshal(line, &data) != nil {
+		return false
+	}
+	value, found := lookupField(data, ttl.Field)
+	return found && ttl.expiredAt(value, now)
+}
+
+// expiredAt checks whether a record with the given value in the TTL field has expired
+func (ttl *TTLOptions) expiredAt(value interface{}, now time.Time) bool {
+	var mark time.Time
+	switch v := value.(type) {
+	case float64:
+		sec := int64(v)
+		mark = time.Unix(sec, int64((v-float64(sec))*1e9))
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return false // zaman değil
+		}
+		mark = t
+	default:
+		return false
+	}
+
+	return !now.Before(mark.Add(ttl.After))
+}
+
+// WithSweepInterval option sets the period of the background sweeper which removes the expired
+// records. The default is one minute. Zero or a negative duration disables the sweeper. Then
+// PurgeExpired can be used to remove expired records. The sweeper starts with the first collection
+// which has a TTL.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(db *ArneDB) error {
+		db.sweepInterval = interval
+		return nil
+	}
+}
+
+// startSweeper runs the background sweeper until the database is closed. It does nothing if the
+// sweeper is already running.
+func (db *ArneDB) startSweeper() {
+	db.sweeperMu.Lock()
+	defer db.sweeperMu.Unlock()
+
+	if db.sweeperDone != nil || db.sweepInterval <= 0 || db.readOnly {
+		return
+	}
+	select {
+	case <-db.closing:
+		return // kapanan veritabanında başlatılmaz
+	default:
+	}
+
+	done := make(chan struct{})
+	db.sweeperDone = done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(db.sweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-db.closing:
+				return
+			case <-ticker.C:
+				db.sweep()
+			}
+		}
+	}()
+}
+
+// sweep removes the expired records of all the collections. Errors are ignored, they are retried on
+// the next run.
+func (db *ArneDB) sweep() {
+	db.collsMu.RLock()
+	colls := make([]*Coll, 0, len(db.colls))
+	for _, c := range db.colls {
+		colls = append(colls, c)
+	}
+	db.collsMu.RUnlock()
+
+	for _, c := range colls {
+		select {
+		case <-db.closing:
+			return
+		default:
+		}
+		if c.GetTTL() != nil {
+			_, _ = c.PurgeExpired()
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package arnedb
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	_ = os.RemoveAll("testdb/ttldb")
+
+	pDb, err := Open("testdb", "ttldb", WithSweepInterval(20*time.Millisecond))
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	defer pDb.Close()
+
+	sessions, err := pDb.CreateColl("sessions")
+	if err != nil {
+		t.Fatal("Create sessions failed with:", err)
+	}
+	if err = sessions.SetTTL("createdAt", time.Hour); err != nil {
+		t.Fatal("SetTTL failed with:", err)
+	}
+
+	now := time.Now()
+	_, err = sessions.AddAll(
+		RecordInstance{"id": 1, "createdAt": now.Add(-2 * time.Hour).Unix()},
+		RecordInstance{"id": 2, "createdAt": now.Add(-2 * time.Hour).Format(time.RFC3339)},
+		RecordInstance{"id": 3, "createdAt": now.Unix()},
+		RecordInstance{"id": 4},
+	)
+	if err != nil {
+		t.Fatal("AddAll failed with:", err)
+	}
+
+	all := func(instance RecordInstance) bool { return true }
+	records, err := sessions.GetAll(all)
+	if err != nil {
+		t.Fatal("GetAll failed with:", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expired records are not hidden: %v", records)
+	}
+	typed, err := GetAllAs[SampleRecordType](sessions, func(i *SampleRecordType) bool { return true })
+	if err != nil || len(typed) != 2 {
+		t.Errorf("Expired records are not hidden from GetAllAs: %d %v", len(typed), err)
+	}
+
+	// Sweeper süresi dolanları fiziksel olarak siler
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		raw, _ := os.ReadFile("testdb/ttldb/sessions/" + firstChunkName)
+		if len(raw) > 0 && countNonBlankLines(raw) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Sweeper did not remove expired records: %s", raw)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Kayıt bazında son kullanma zamanı
+	pDb2, err := Open("testdb", "ttldb", WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	defer pDb2.Close()
+	cache, err := pDb2.CreateColl("cache")
+	if err != nil {
+		t.Fatal("Create cache failed with:", err)
+	}
+	if err = cache.SetTTL("expiresAt", 0); err != nil {
+		t.Fatal("SetTTL failed with:", err)
+	}
+	_ = cache.Add(RecordInstance{"k": "old", "expiresAt": now.Add(-time.Second)})
+	_ = cache.Add(RecordInstance{"k": "new", "expiresAt": now.Add(time.Hour)})
+	if n, _ := cache.Count(all); n != 1 {
+		t.Errorf("Per record expiry count mismatch: %d", n)
+	}
+	if pDb2.GetColl("sessions").GetTTL() == nil {
+		t.Error("TTL settings are not loaded on Open")
+	}
+	n, err := cache.PurgeExpired()
+	if err != nil || n != 1 {
+		t.Errorf("PurgeExpired expected 1, got %d %v", n, err)
+	}
+}
+
+func TestExpiredRecordsAreNotAltered(t *testing.T) {
+	pDb, err := OpenInMemory("ttlwritedb", WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	defer pDb.Close()
+	cache, _ := pDb.CreateColl("cache")
+	if err = cache.SetTTL("exp", 0); err != nil {
+		t.Fatal("SetTTL failed with:", err)
+	}
+	now := time.Now()
+	_, _ = cache.AddAll(
+		RecordInstance{"k": "old", "exp": now.Add(-time.Hour).Unix()},
+		RecordInstance{"k": "new", "exp": now.Add(time.Hour).Unix()},
+	)
+
+	all := func(RecordInstance) bool { return true }
+	revive := func(ptr *RecordInstance) *RecordInstance {
+		(*ptr)["exp"] = float64(now.Add(2 * time.Hour).Unix())
+		return ptr
+	}
+	if n, err := cache.UpdateAll(all, revive); err != nil || n != 1 {
+		t.Errorf("UpdateAll expected 1 altered record, got %d %v", n, err)
+	}
+	if n, err := cache.ReplaceAll(all, RecordInstance{"k": "replaced", "exp": now.Add(time.Hour).Unix()}); err != nil || n != 1 {
+		t.Errorf("ReplaceAll expected 1 altered record, got %d %v", n, err)
+	}
+	if n, _ := cache.Count(all); n != 1 {
+		t.Errorf("Expired record is visible after the updates: %d", n)
+	}
+	if n, err := cache.DeleteAll(all); err != nil || n != 1 {
+		t.Errorf("DeleteAll expected 1 deletion, got %d %v", n, err)
+	}
+
+	// Süresi dolan kayıt süpürücüye kalır
+	if n, err := cache.PurgeExpired(); err != nil || n != 1 {
+		t.Errorf("PurgeExpired expected 1, got %d %v", n, err)
+	}
+}
+
+func TestExpiryFieldLookup(t *testing.T) {
+	pDb, err := OpenInMemory("ttlfielddb", WithSweepInterval(0))
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	defer pDb.Close()
+
+	// JSON kayıtlarında alan metinden okunur, diğer codec'lerde kayıt çözülür
+	nested, _ := pDb.CreateColl("nested")
+	packed, _ := pDb.CreateColl("packed", WithCodec(MsgPackCodec))
+	now := time.Now()
+	for _, c := range []*Coll{nested, packed} {
+		if err = c.SetTTL("meta.exp", 0); err != nil {
+			t.Fatal("SetTTL failed with:", err)
+		}
+		_, _ = c.AddAll(
+			RecordInstance{"k": "old", "meta": map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}},
+			RecordInstance{"k": "new", "meta": map[string]interface{}{"exp": now.Add(time.Hour).Format(time.RFC3339)}},
+		)
+		records, err := c.GetAll(func(RecordInstance) bool { return true })
+		if err != nil || len(records) != 1 || records[0]["k"] != "new" {
+			t.Errorf("%s: GetAll expected only the live record, got %v %v", c.GetName(), records, err)
+		}
+		typed, err := GetAllAs[map[string]interface{}](c, func(*map[string]interface{}) bool { return true })
+		if err != nil || len(typed) != 1 {
+			t.Errorf("%s: GetAllAs expected 1 record, got %d %v", c.GetName(), len(typed), err)
+		}
+	}
+}
+
+func TestSweeperStartsLazily(t *testing.T) {
+	pDb, err := OpenInMemory("sweeperdb")
+	if err != nil {
+		t.Fatal("Open failed with:", err)
+	}
+	running := func(db *ArneDB) bool {
+		db.sweeperMu.Lock()
+		defer db.sweeperMu.Unlock()
+		return db.sweeperDone != nil
+	}
+
+	items, _ := pDb.CreateColl("items")
+	if running(pDb) {
+		t.Error("sweeper expected not to run without a TTL collection")
+	}
+	if err = items.SetTTL("expiresAt", 0); err != nil {
+		t.Fatal("SetTTL failed with:", err)
+	}
+	if !running(pDb) {
+		t.Error("sweeper expected to start with SetTTL")
+	}
+	_ = pDb.Close()
+
+	// Açılışta TTL'li kolleksiyon yüklenirse başlar
+	storage := NewMemStorage()
+	pDb, _ = OpenStorage("sweeperdb", storage)
+	sessions, _ := pDb.CreateColl("sessions")
+	_ = sessions.SetTTL("createdAt", time.Hour)
+	_ = pDb.Close()
+	pDb, _ = OpenStorage("sweeperdb", storage)
+	defer pDb.Close()
+	if !running(pDb) {
+		t.Error("sweeper expected to start with a loaded TTL collection")
+	}
+}
+
+// countNonBlankLines counts the records in a chunk content
+func countNonBlankLines(raw []byte) int {
+	n := 0
+	start := 0
+	for i, b := range raw {
+		if b == recordSepChar {
+			if i > start {
+				n++
+			}
+			start = i + 1
+		}
+	}
+	return n
+}
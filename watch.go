@@ -0,0 +1,367 @@
+package arnedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+const changeLogName = "changes.log"
+const watchBufferSize = 256
+
+// ChangeType is the kind of change delivered by Watch.
+type ChangeType string
+
+const (
+	// ChangeInsert is delivered by Add and AddAll
+	ChangeInsert ChangeType = "insert"
+	// ChangeUpdate is delivered by UpdateFirst and UpdateAll
+	ChangeUpdate ChangeType = "update"
+	// ChangeReplace is delivered by ReplaceFirst and ReplaceAll
+	ChangeReplace ChangeType = "replace"
+	// ChangeDelete is delivered by DeleteFirst and DeleteAll
+	ChangeDelete ChangeType = "delete"
+)
+
+// ChangeToken is the position of a change in the change stream. Tokens are increasing numbers. If the
+// database is opened with WithChangeLog option, a watcher can resume from a token it has seen.
+type ChangeToken uint64
+
+// ChangeEvent represents a single change on a collection.
+type ChangeEvent struct {
+	// Token is the position of the event. It can be used to resume watching.
+	Token ChangeToken `json:"token"`
+	// Type is the kind of the change
+	Type ChangeType `json:"type"`
+	// Coll is the name of the changed collection
+	Coll string `json:"coll"`
+	// Doc is the inserted, new or deleted document
+	Doc RecordInstance `json:"doc,omitempty"`
+	// Prev is the previous version of the document for update and replace events
+	Prev RecordInstance `json:"prev,omitempty"`
+	// Time is the time of the change
+	Time time.Time `json:"time"`
+}
+
+// watcher is a single subscriber of the change stream
+type watcher struct {
+	ch        chan ChangeEvent
+	coll      string         // Boş ise bütün kolleksiyonlar
+	filter    QueryPredicate // nil ise bütün değişiklikler
+	replaying bool           // Log'dan geçmiş olaylar gönderilirken yeni olaylar backlog'da bekler
+	backlog   []ChangeEvent
+}
+
+// WithChangeLog option persists all the change events into the database directory. This enables
+// watchers to resume from a ChangeToken by using WatchFrom.
+func WithChangeLog() Option {
+	return func(db *ArneDB) error {
+		db.watchMu.Lock()
+		defer db.watchMu.Unlock()
+		db.changeLog = true
+		return nil
+	}
+}
+
+// loadChangeSeq finds the last token in the change log. It runs after the options are applied, so
+// the log can be decrypted.
+func (db *ArneDB) loadChangeSeq() error {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	if !db.changeLog {
+		return nil
+	}
+
+	return db.readChangeLog(0, func(e ChangeEvent) bool {
+		db.changeSeq = e.Token
+		return true
+	})
+}
+
+// Watch function delivers all the changes in the database over the returned channel. The channel is
+// closed when ctx is done. If the receiver cannot keep up with the changes, the channel is closed
+// and the receiver may resume by using WatchFrom with the last token it has seen.
+func (db *ArneDB) Watch(ctx context.Context) (<-chan ChangeEvent, error) {
+	return db.subscribe(ctx, "", nil, nil)
+}
+
+// WatchFrom function works like Watch but first delivers the logged changes after the given token.
+// The database must be opened with the WithChangeLog option.
+func (db *ArneDB) WatchFrom(ctx context.Context, after ChangeToken) (<-chan ChangeEvent, error) {
+	return db.subscribe(ctx, "", nil, &after)
+}
+
+// Watch function delivers the changes of the collection over the returned channel. If filter is not
+// nil only the changes whose document matches the filter are delivered. For deletions the deleted
+// document is evaluated. The channel is closed when ctx is done.
+func (coll *Coll) Watch(ctx context.Context, filter QueryPredicate) (<-chan ChangeEvent, error) {
+	if coll.db == nil {
+		return nil, errors.New("collection is not bound to a database")
+	}
+	return coll.db.subscribe(ctx, coll.GetName(), filter, nil)
+}
+
+// WatchFrom function works like Watch but first delivers the logged changes after the given token.
+// The database must be opened with the WithChangeLog option.
+func (coll *Coll) WatchFrom(ctx context.Context, filter QueryPredicate, after ChangeToken) (<-chan ChangeEvent, error) {
+	if coll.db == nil {
+		return nil, errors.New("collection is not bound to a database")
+	}
+	return coll.db.subscribe(ctx, coll.GetName(), filter, &after)
+}
+
+// subscribe registers a watcher. If after is not nil the logged events are replayed first.
+func (db *ArneDB) subscribe(ctx context.Context, collName string, filter QueryPredicate, after *ChangeToken) (<-chan ChangeEvent, error) {
+	w := &watcher{
+		ch:        make(chan ChangeEvent, watchBufferSize),
+		coll:      collName,
+		filter:    filter,
+		replaying: after != nil,
+	}
+
+	db.watchMu.Lock()
+	if after != nil && !db.changeLog {
+		db.watchMu.Unlock()
+		return nil, errors.New("cannot resume watching: change log is not enabled")
+	}
+	db.watcherID++
+	id := db.watcherID
+	db.watchers[id] = w
+	lastSeq := db.changeSeq
+	db.watchMu.Unlock()
+
+	if after != nil {
+		go db.replay(ctx, id, w, *after, lastSeq)
+	}
+
+	go func() {
+		<-ctx.Done()
+		db.unsubscribe(id)
+	}()
+
+	return w.ch, nil
+}
+
+// unsubscribe removes the watcher and closes its channel. If the watcher is still replaying the log,
+// the channel is closed by the replay goroutine.
+func (db *ArneDB) unsubscribe(id int) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	if w, found := db.watchers[id]; found {
+		delete(db.watchers, id)
+		if !w.replaying {
+			close(w.ch)
+		}
+	}
+}
+
+// replay sends the logged events between after and lastSeq, then the events collected meanwhile.
+func (db *ArneDB) replay(ctx context.Context, id int, w *watcher, after, lastSeq ChangeToken) {
+	send := func(e ChangeEvent) bool {
+		if !w.matches(e) {
+			return true
+		}
+		select {
+		case w.ch <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	stop := func() {
+		db.watchMu.Lock()
+		delete(db.watchers, id)
+		close(w.ch)
+		db.watchMu.Unlock()
+	}
+
+	ok := true
+	err := db.readChangeLog(after, func(e ChangeEvent) bool {
+		if e.Token > lastSeq {
+			return false
+		}
+		ok = send(e)
+		return ok
+	})
+	if err != nil || !ok {
+		stop()
+		return
+	}
+
+	for {
+		db.watchMu.Lock()
+		if _, found := db.watchers[id]; !found {
+			// Bu arada abonelik iptal edilmiş.
+			close(w.ch)
+			db.watchMu.Unlock()
+			return
+		}
+		pending := w.backlog
+		w.backlog = nil
+		if len(pending) == 0 {
+			w.replaying = false
+			db.watchMu.Unlock()
+			return
+		}
+		db.watchMu.Unlock()
+
+		for _, e := range pending {
+			if !send(e) {
+				stop()
+				return
+			}
+		}
+	}
+}
+
+// matches checks whether the event is wanted by the watcher
+func (w *watcher) matches(e ChangeEvent) (result bool) {
+	if w.coll != "" && w.coll != e.Coll {
+		return false
+	}
+	if w.filter == nil {
+		return true
+	}
+
+	// filtre içindeki hata olayı eşleşmemiş sayar.
+	defer func() {
+		if r := recover(); r != nil {
+			result = false
+		}
+	}()
+	return w.filter(e.Doc)
+}
+
+// watching reports whether change events are needed by anyone
+func (db *ArneDB) watching() bool {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	return db.changeLog || len(db.watchers) > 0
+}
+
+// publish assigns tokens to the events, persists them if needed and delivers them to the watchers.
+func (db *ArneDB) publish(events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	now := time.Now()
+	for i := range events {
+		db.changeSeq++
+		events[i].Token = db.changeSeq
+		events[i].Time = now
+	}
+
+	if db.changeLog {
+		// Log yazılamıyorsa olaylar yine de dağıtılır. Değişiklik zaten diske yazılmıştır.
+		_ = db.appendChangeLog(events)
+	}
+
+	for id, w := range db.watchers {
+		for _, e := range events {
+			if w.replaying {
+				w.backlog = append(w.backlog, e)
+				continue
+			}
+			if !w.matches(e) {
+				continue
+			}
+			select {
+			case w.ch <- e:
+			default:
+				// Dinleyici yetişemiyor. Kanal kapatılır, token ile devam edebilir.
+				delete(db.watchers, id)
+				close(w.ch)
+			}
+			if _, found := db.watchers[id]; !found {
+				break
+			}
+		}
+	}
+}
+
+// appendChangeLog writes the events into the change log file
+func (db *ArneDB) appendChangeLog(events []ChangeEvent) error {
+	var buffer bytes.Buffer
+	enc := json.NewEncoder(&buffer) // Encoder her kaydın sonuna \n ekler
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return errors.New(fmt.Sprintf("cannot write change log: %s", err.Error()))
+		}
+	}
+	content, err := sealLines(db.cipher(), buffer.Bytes())
+	if err == nil {
+		err = db.storage.Append("", changeLogName, content)
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot write change log: %s", err.Error()))
+	}
+	return nil
+}
+
+// readChangeLog calls fn for every logged event after the given token. Reading stops when fn
+// returns false.
+func (db *ArneDB) readChangeLog(after ChangeToken, fn func(e ChangeEvent) bool) error {
+	f, aead, err := db.openFile("", changeLogName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // Henüz log yok
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot read change log: %s", err.Error()))
+	}
+	r := decryptReader(f, aead)
+	defer r.Close()
+
+	scn := newRecordScanner(r)
+	for scn.Scan() {
+		var e ChangeEvent
+		if json.Unmarshal(scn.Bytes(), &e) != nil {
+			continue // skip this record
+		}
+		if e.Token <= after {
+			continue
+		}
+		if !fn(e) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// watching reports whether the collection changes must be published
+func (coll *Coll) watching() bool {
+	return coll.db != nil && coll.db.watching()
+}
+
+// publish sends the change events of the collection
+func (coll *Coll) publish(events []ChangeEvent) {
+	if coll.db != nil {
+		coll.db.publish(events)
+	}
+}
+
+// newChangeEvent creates an event of the collection. Documents are given as marshalled data so that
+// watchers get a copy which they can keep.
+func (coll *Coll) newChangeEvent(changeType ChangeType, doc []byte, prev []byte) ChangeEvent {
+	e := ChangeEvent{
+		Type: changeType,
+		Coll: coll.GetName(),
+	}
+	codec := coll.codec()
+	if doc != nil {
+		_ = codec.Unmarshal(doc, &e.Doc)
+	}
+	if prev != nil {
+		_ = codec.Unmarshal(prev, &e.Prev)
+	}
+	return e
+}
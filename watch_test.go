@@ -0,0 +1,141 @@
+package arnedb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// receiveEvents reads n events from the channel or fails after a timeout
+func receiveEvents(t *testing.T, ch <-chan ChangeEvent, n int) []ChangeEvent {
+	t.Helper()
+	result := make([]ChangeEvent, 0, n)
+	for len(result) < n {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				t.Fatalf("Watch channel closed after %d events, %d expected", len(result), n)
+			}
+			result = append(result, e)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout after %d events, %d expected", len(result), n)
+		}
+	}
+	return result
+}
+
+func TestWatch(t *testing.T) {
+	_ = os.RemoveAll("testdb/watchdb")
+
+	pDb, err := Open("testdb", "watchdb")
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+
+	coll, err := pDb.CreateColl("events")
+	if err != nil {
+		t.Fatal("Create events failed with:", err)
+	}
+	other, err := pDb.CreateColl("other")
+	if err != nil {
+		t.Fatal("Create other failed with:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	collCh, err := coll.Watch(ctx, func(instance RecordInstance) bool {
+		return instance["id"].(float64) < 10
+	})
+	if err != nil {
+		t.Fatal("Coll.Watch failed with:", err)
+	}
+	dbCh, err := pDb.Watch(ctx)
+	if err != nil {
+		t.Fatal("ArneDB.Watch failed with:", err)
+	}
+
+	_ = coll.Add(RecordInstance{"id": 1, "name": "one"})
+	_, _ = coll.AddAll(RecordInstance{"id": 2, "name": "two"}, RecordInstance{"id": 20, "name": "twenty"})
+	_ = other.Add(RecordInstance{"id": 3})
+	_, _ = coll.UpdateFirst(func(i RecordInstance) bool { return i["id"].(float64) == 1 },
+		func(ptrRecord *RecordInstance) *RecordInstance {
+			(*ptrRecord)["name"] = "uno"
+			return ptrRecord
+		})
+	_, _ = coll.ReplaceFirst(func(i RecordInstance) bool { return i["id"].(float64) == 2 },
+		RecordInstance{"id": 2, "name": "dos"})
+	_, _ = coll.DeleteAll(func(i RecordInstance) bool { return i["id"].(float64) > 1 })
+
+	events := receiveEvents(t, collCh, 5)
+	expected := []ChangeType{ChangeInsert, ChangeInsert, ChangeUpdate, ChangeReplace, ChangeDelete}
+	for i, ct := range expected {
+		if events[i].Type != ct || events[i].Coll != "events" {
+			t.Errorf("Event %d expected %s on events, got %s on %s", i, ct, events[i].Type, events[i].Coll)
+		}
+	}
+	if events[2].Prev["name"] != "one" || events[2].Doc["name"] != "uno" {
+		t.Errorf("Update event does not carry previous version: %+v", events[2])
+	}
+	if events[3].Prev["name"] != "two" || events[3].Doc["name"] != "dos" {
+		t.Errorf("Replace event does not carry previous version: %+v", events[3])
+	}
+
+	all := receiveEvents(t, dbCh, 8)
+	for i := 1; i < len(all); i++ {
+		if all[i].Token <= all[i-1].Token {
+			t.Error("Tokens are not increasing")
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-collCh:
+		if ok {
+			t.Error("Unexpected event after cancel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Watch channel is not closed after cancel")
+	}
+
+	// Resume is only possible with a change log
+	if _, err = pDb.WatchFrom(context.Background(), 1); err == nil {
+		t.Error("WatchFrom without change log should fail")
+	}
+}
+
+func TestWatchFromChangeLog(t *testing.T) {
+	_ = os.RemoveAll("testdb/watchlogdb")
+
+	pDb, err := Open("testdb", "watchlogdb", WithChangeLog())
+	if pDb == nil || err != nil {
+		t.Fatal("Open test failed with:", err)
+	}
+	coll, err := pDb.CreateColl("logged")
+	if err != nil {
+		t.Fatal("Create logged failed with:", err)
+	}
+	for i := 0; i < 5; i++ {
+		_ = coll.Add(RecordInstance{"id": i})
+	}
+
+	// Reopen and resume after the second event
+	pDb, err = Open("testdb", "watchlogdb", WithChangeLog())
+	if err != nil {
+		t.Fatal("Reopen failed with:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := pDb.GetColl("logged").WatchFrom(ctx, nil, 2)
+	if err != nil {
+		t.Fatal("WatchFrom failed with:", err)
+	}
+	_ = pDb.GetColl("logged").Add(RecordInstance{"id": 5})
+
+	events := receiveEvents(t, ch, 4)
+	for i, e := range events {
+		if e.Token != ChangeToken(i+3) || e.Doc["id"] != float64(i+2) {
+			t.Errorf("Resumed event %d mismatch: %+v", i, e)
+		}
+	}
+}